@@ -17,10 +17,27 @@ NC='\033[0m' # No Color
 # Default values
 TARGET_DIR="."
 TEST_CERT_PATH=""
+CERT_ALIAS=""
 DEFAULT_CERT_PATH="/tmp/test-cert.pem"
+EST_URL=""
+EST_USER=""
+EST_CERT_PATH="/tmp/est-cert.pem"
+CERT_ENDPOINT=""
+ENDPOINT_CERT_PATH="/tmp/endpoint-cert.pem"
+ASSUME_YES=false
+CERT_KIND="ca"
+CERT_CN="Test Certificate"
+CERT_ORG="Trust Store Scanner"
+CERT_SANS=()
+CERT_DAYS=365
+KEY_TYPE="rsa"
+KEY_SIZE=4096
+KEY_CURVE="P-256"
+CERT_OPTIONS=false
 LOG_FILE="trust_store_scan_$(date +%Y%m%d_%H%M%S).log"
 VERBOSE=false
 BACKUP=true
+BACKUP_MODE="copy"
 RESTART_SERVICES=false
 COMMON_PASSWORDS=("changeit" "changeme" "password" "keystore" "truststore" "secret" "")
 SUMMARY_SUCCESS=0
@@ -28,16 +45,305 @@ SUMMARY_FAILURE=0
 KUBERNETES_MODE=false
 DOCKER_MODE=false
 BASELINE_URL=""
+ROOTS_DIR=""
+PRUNE=false
+NORMALIZE=false
+NEWLINE_FIX=true
+BASELINE_PROXY=""
+BASELINE_PINS=()
+DOWNLOAD_TIMEOUT=30
+EXPIRY_WARNING_DAYS=30
+LOCK_TIMEOUT=0
+RUN_LOCK_DIR=""
+# Empty until parse_args turns progress on when stderr is a terminal
+PROGRESS=""
+PROGRESS_SHOWN=false
+PROGRESS_REPORTED=0
+# Seconds between progress log lines when stderr is not a terminal
+PROGRESS_INTERVAL=10
 BASELINE_STORE="/tmp/baseline_trust_store_$(date +%s)"
 COMPARE_MODE=false
 NOOP_MODE=false
+NOOP_WOULD_MODIFY=false
+KEYTOOL_PATH=""
+KEYTOOL_SEARCHED=false
+OPENSSL_PATH=""
+PKCS12_COMPAT="preserve"
+BC_PROVIDER_PATH=""
+EXCLUDE_EXPIRED=false
+EXCLUDE_NOT_YET_VALID=false
+STORE_REFERENCES_FILE="/tmp/trust_store_references_$(date +%s)"
+STORE_CACHE_DIR="/tmp/trust_store_cache_$(date +%s)_$$"
+declare -A FILE_TYPE_CACHE=()
+STORE_RESULTS_FILE="/tmp/trust_store_results_$(date +%s)"
+STATE_FILE=""
+STATE_KEY=""
+declare -A STATE_STAMPS=()
+STATE_UPDATES_FILE="/tmp/trust_store_state_$(date +%s)_$$"
+STORE_SKIPPED=false
+LAST_ERROR_MESSAGE=""
+WEBHOOK_URL=""
+AUDIT_UPLOAD_URI=""
+HOSTS_FILE=""
+HOST_CONCURRENCY=4
+HOST_TIMEOUT=300
+HOST_SCAN_ARGS=()
+OTEL_ENDPOINT=""
+# When the store being processed started, in nanoseconds, for its span
+STORE_STARTED=""
+RUN_START=$(date +%s)
+COMMAND_ARGS=()
+SESSION_ID="$(date +%Y%m%d%H%M%S)-$$"
+MODIFIED_STORES=()
+MODIFIED_STORE_PATHS=()
+NOOP_MODIFIED_STORES=()
+NOOP_RESTARTS=()
+GLOB_PATTERNS=()
+REF_BASES=()
+EXCLUDE_PATTERNS=()
+ALLOWED_PATHS=()
+ONLY_TYPES=()
+MAX_DEPTH=""
+ALLOW_SYSTEM_STORE=false
+APPROVED_CA_PATTERNS=()
+FORCE=false
+FAIL_ON_CHANGE=false
+NON_COMPLIANT_STORES=()
+LAST_COMPARE_MISSING=()
+LAST_COMPARE_EXTRA=()
+LAST_TOOL_ERROR=""
+CSV_FILE=""
+DB_FILE=""
+# The certificates of every store, as CSV rows, for --db
+DB_CERTS_FILE="/tmp/trust_store_db_certs_$(date +%s)_$$"
+# Exit status of --fail-on-change when any store differs from the baseline
+EXIT_DRIFT=3
+# Redirects followed when downloading the baseline, so that a loop fails
+BASELINE_MAX_REDIRECTS=5
+# Config files larger than this are not searched for trust store references,
+# and longer lines are cut, so a stray log file cannot stall the scan
+MAX_CONFIG_FILE_SIZE=$((5 * 1024 * 1024))
+MAX_CONFIG_LINE_LENGTH=4096
 
-# Create a test certificate if none provided
+# Print the subject of generated and enrolled certificates
+certificate_subject() {
+    echo "/CN=$CERT_CN/O=$CERT_ORG/C=US"
+}
+
+# Print the --san names as a subjectAltName value, typing each bare name as
+# an IP address or a DNS name
+subject_alt_names() {
+    local sans=""
+    local san
+
+    for san in "${CERT_SANS[@]}"; do
+        case "$san" in
+            DNS:*|IP:*|URI:*|email:*) ;;
+            *:*) san="IP:$san" ;;
+            *[!0-9.]*) san="DNS:$san" ;;
+            *) san="IP:$san" ;;
+        esac
+        sans+="${sans:+,}$san"
+    done
+    echo "$sans"
+}
+
+# Print the openssl -addext arguments for the --cert-kind and --san options,
+# one per line. A CA certificate can sign and is what trust store tests need;
+# a leaf is a TLS server certificate for the --san names.
+certificate_extensions() {
+    local sans
+    sans=$(subject_alt_names)
+
+    if [ "$CERT_KIND" = "leaf" ]; then
+        printf '%s\n' -addext "basicConstraints=critical,CA:FALSE" \
+            -addext "keyUsage=critical,digitalSignature,keyEncipherment" \
+            -addext "extendedKeyUsage=serverAuth"
+    else
+        printf '%s\n' -addext "basicConstraints=critical,CA:TRUE" \
+            -addext "keyUsage=critical,keyCertSign,cRLSign"
+    fi
+    if [ -n "$sans" ]; then
+        printf '%s\n' -addext "subjectAltName=$sans"
+    fi
+}
+
+# Generate the private key of a generated or enrolled certificate. RSA and
+# Ed25519 keys are written as PKCS8 "PRIVATE KEY", ECDSA keys as "EC PRIVATE KEY".
+new_private_key() {
+    local out="$1"
+
+    case "$KEY_TYPE" in
+        rsa)
+            openssl genpkey -algorithm RSA -pkeyopt "rsa_keygen_bits:$KEY_SIZE" -out "$out" 2>/dev/null
+            ;;
+        ecdsa)
+            local curve="$KEY_CURVE"
+            case "$curve" in
+                P-256) curve="prime256v1" ;;
+                P-384) curve="secp384r1" ;;
+                P-521) curve="secp521r1" ;;
+            esac
+            openssl ecparam -name "$curve" -genkey -noout -out "$out" 2>/dev/null
+            ;;
+        ed25519)
+            openssl genpkey -algorithm ed25519 -out "$out" 2>/dev/null
+            ;;
+    esac
+}
+
+# Create a test certificate if none provided. A certificate left by an
+# earlier run is reused unless generation options were given.
 create_test_certificate() {
-    if [ ! -f "$DEFAULT_CERT_PATH" ]; then
-        log_info "Creating test certificate at $DEFAULT_CERT_PATH"
-        openssl req -x509 -newkey rsa:4096 -keyout /tmp/test-key.pem -out "$DEFAULT_CERT_PATH" -days 365 -nodes -subj "/CN=Test Certificate/O=Trust Store Scanner/C=US" 2>/dev/null
+    if [ ! -f "$DEFAULT_CERT_PATH" ] || [ "$CERT_OPTIONS" = true ]; then
+        log_info "Creating test $CERT_KIND certificate with a $KEY_TYPE key at $DEFAULT_CERT_PATH"
+        local extensions=()
+        mapfile -t extensions < <(certificate_extensions)
+        if ! new_private_key /tmp/test-key.pem ||
+            ! openssl req -x509 -key /tmp/test-key.pem -out "$DEFAULT_CERT_PATH" -days "$CERT_DAYS" \
+                -subj "$(certificate_subject)" "${extensions[@]}" 2>/dev/null; then
+            log_error "Failed to create test certificate at $DEFAULT_CERT_PATH"
+            exit 1
+        fi
+    fi
+}
+
+# Enroll the certificate to add through an EST server (RFC 7030) instead of
+# self-signing it: submit a new key's CSR to simpleenroll and keep the issued
+# certificate. The password for --est-user is read from $EST_PASSWORD.
+enroll_est_certificate() {
+    local key="${EST_CERT_PATH%.pem}-key.pem"
+    local csr
+    local response
+    csr=$(mktemp)
+    response=$(mktemp)
+
+    log_info "Enrolling certificate at $EST_CERT_PATH through EST server $EST_URL"
+
+    if ! command -v curl &> /dev/null; then
+        log_error "curl is required for EST enrollment"
+        return 1
+    fi
+
+    # The CA decides the issued certificate's extensions and validity, but the
+    # request carries the subject and any --san names
+    local extensions=()
+    if [ ${#CERT_SANS[@]} -gt 0 ]; then
+        extensions=(-addext "subjectAltName=$(subject_alt_names)")
+    fi
+    if ! new_private_key "$key" ||
+        ! openssl req -new -key "$key" -outform DER -out "$csr" \
+            -subj "$(certificate_subject)" "${extensions[@]}" 2>/dev/null; then
+        log_error "Failed to create a certificate signing request"
+        rm -f "$csr" "$response"
+        return 1
+    fi
+
+    # EST exchanges base64 DER: a PKCS10 request, and a certs-only PKCS7 reply
+    local credentials=()
+    if [ -n "$EST_USER" ]; then
+        credentials=(-u "$EST_USER:${EST_PASSWORD:-}")
+    fi
+    if openssl base64 -in "$csr" | curl -sS --fail "${credentials[@]}" \
+            -H "Content-Type: application/pkcs10" -H "Content-Transfer-Encoding: base64" \
+            --data-binary @- "${EST_URL%/}/simpleenroll" -o "$response" &&
+        tr -d '\r\n' < "$response" | openssl base64 -d -A |
+            openssl pkcs7 -inform DER -print_certs -out "$EST_CERT_PATH" 2>/dev/null &&
+        openssl x509 -noout -in "$EST_CERT_PATH" 2>/dev/null; then
+        log_success "Enrolled certificate: $(openssl x509 -noout -subject -issuer -in "$EST_CERT_PATH" | paste -sd ' ' -)"
+        rm -f "$csr" "$response"
+        return 0
+    fi
+
+    log_error "EST enrollment at $EST_URL failed"
+    rm -f "$csr" "$response"
+    return 1
+}
+
+# Save the top certificate of the chain that CERT_ENDPOINT presents: its root
+# when the server sends it, otherwise its top intermediate
+fetch_endpoint_certificate() {
+    local host port
+    if [[ "$CERT_ENDPOINT" =~ ^\[(.+)\](:([0-9]+))?$ ]] || [[ "$CERT_ENDPOINT" =~ ^([^:]+)(:([0-9]+))?$ ]]; then
+        host="${BASH_REMATCH[1]}"
+        port="${BASH_REMATCH[3]:-443}"
+    else
+        log_error "Invalid --cert-from-endpoint: $CERT_ENDPOINT (expected HOST, HOST:PORT or [IPv6]:PORT)"
+        return 1
+    fi
+
+    local connect="$host:$port"
+    local sni=(-servername "$host")
+    if [[ "$host" == *:* ]]; then
+        connect="[$host]:$port"
+    fi
+    if [[ "$host" == *:* || "$host" =~ ^[0-9.]+$ ]]; then
+        sni=()
+    fi
+
+    # timeout runs a program, not the openssl function
+    local client=(openssl)
+    if command -v timeout &> /dev/null; then
+        client=(timeout "$DOWNLOAD_TIMEOUT" "${OPENSSL_PATH:-openssl}")
+    fi
+    local chain
+    chain=$(mktemp)
+    log_info "Fetching the certificate chain presented by $connect"
+    "${client[@]}" s_client -connect "$connect" "${sni[@]}" -showcerts < /dev/null > "$chain" 2>/dev/null || true
+
+    local count
+    count=$(grep -c -- '-----BEGIN CERTIFICATE-----' "$chain") || true
+    if [ "$count" -eq 0 ]; then
+        log_error "$connect presented no certificates (is it a TLS endpoint?)"
+        rm -f "$chain"
+        return 1
+    fi
+    awk '/-----BEGIN CERTIFICATE-----/ { cert = "" } { cert = cert $0 "\n" } /-----END CERTIFICATE-----/ { last = cert } END { printf "%s", last }' \
+        "$chain" > "$ENDPOINT_CERT_PATH"
+    rm -f "$chain"
+
+    local subject issuer
+    subject=$(openssl x509 -noout -subject -nameopt RFC2253 -in "$ENDPOINT_CERT_PATH" | sed 's/^subject=//')
+    issuer=$(openssl x509 -noout -issuer -nameopt RFC2253 -in "$ENDPOINT_CERT_PATH" | sed 's/^issuer=//')
+    if [ "$count" -eq 1 ]; then
+        log_warning "$connect presented only its own certificate, $subject; that certificate would be trusted"
+    elif [ "$subject" = "$issuer" ]; then
+        log_info "$connect presented its root: $subject"
+    else
+        log_warning "$connect did not present its root; using its top intermediate, $subject, issued by $issuer"
+    fi
+}
+
+# Show the certificate from --cert-from-endpoint and ask before trusting it,
+# since the endpoint could present anything. --yes skips the question.
+confirm_endpoint_certificate() {
+    local subject fingerprint answer
+    subject=$(openssl x509 -noout -subject -nameopt RFC2253 -in "$ENDPOINT_CERT_PATH" | sed 's/^subject=//')
+    fingerprint=$(certificate_fingerprint "$ENDPOINT_CERT_PATH")
+    log_warning "Trusting whatever $CERT_ENDPOINT presents: check this certificate out of band before adding it"
+    log_info "  Subject: $subject"
+    log_info "  SHA-256 fingerprint: $fingerprint"
+
+    if [ "$ASSUME_YES" = true ]; then
+        log_info "Trusting it (--yes)"
+        return 0
+    fi
+    if [ "$NOOP_MODE" = true ]; then
+        log_noop "A real run would ask to confirm it (or take --yes)"
+        return 0
+    fi
+    if [ ! -t 0 ]; then
+        log_error "Not trusting the certificate from $CERT_ENDPOINT: no terminal to confirm it on (pass --yes after checking its fingerprint)"
+        return 1
     fi
+    read -r -p "Trust $subject in every trust store found? [y/N] " answer
+    case "$answer" in
+        [yY]|[yY][eE][sS])
+            return 0
+            ;;
+    esac
+    log_error "Not trusting the certificate from $CERT_ENDPOINT"
+    return 1
 }
 
 # Logging functions
@@ -47,7 +353,7 @@ log_info() {
 
 log_success() {
     echo -e "${GREEN}[SUCCESS]${NC} $1" | tee -a "$LOG_FILE"
-    ((SUMMARY_SUCCESS++))
+    SUMMARY_SUCCESS=$((SUMMARY_SUCCESS + 1))
 }
 
 log_warning() {
@@ -56,7 +362,8 @@ log_warning() {
 
 log_error() {
     echo -e "${RED}[ERROR]${NC} $1" | tee -a "$LOG_FILE"
-    ((SUMMARY_FAILURE++))
+    SUMMARY_FAILURE=$((SUMMARY_FAILURE + 1))
+    LAST_ERROR_MESSAGE="$1"
 }
 
 log_debug() {
@@ -82,6 +389,48 @@ log_noop_skip() {
     echo -e "${YELLOW}[NOOP]${NC} Skipping $target: $reason" | tee -a "$LOG_FILE"
 }
 
+# Report progress through a scan phase on stderr: a progress bar on a terminal,
+# otherwise a log line every PROGRESS_INTERVAL seconds. Discovery has no total.
+report_progress() {
+    local phase="$1"
+    local count="$2"
+    local total="$3"
+    local file="$4"
+    local line
+    if [ "$PROGRESS" != true ]; then
+        return 0
+    fi
+
+    if [ -n "$total" ]; then
+        line="$phase: $count/$total trust stores"
+    else
+        line="$phase: $count trust stores found"
+    fi
+    if [ -t 2 ]; then
+        if [ -n "$total" ] && [ "$total" -gt 0 ]; then
+            local width=20
+            local filled=$((count * width / total))
+            local bar
+            bar="$(printf '%*s' "$filled" '' | tr ' ' '#')$(printf '%*s' $((width - filled)) '' | tr ' ' '-')"
+            line="$phase: [$bar] $count/$total"
+        fi
+        line="$line $file"
+        printf '\r\033[K%s' "${line:0:${COLUMNS:-80}-1}" >&2
+        PROGRESS_SHOWN=true
+    elif [ $((SECONDS - PROGRESS_REPORTED)) -ge $PROGRESS_INTERVAL ]; then
+        log_info "$line, at $file" >&2
+        PROGRESS_REPORTED=$SECONDS
+    fi
+}
+
+# Erase the progress bar so that log lines do not run into it
+clear_progress() {
+    if [ "$PROGRESS_SHOWN" = true ]; then
+        printf '\r\033[K' >&2
+        PROGRESS_SHOWN=false
+    fi
+}
+
 # Display usage information
 usage() {
     cat << EOF
@@ -89,25 +438,131 @@ Usage: $0 [options]
 
 Options:
   -d, --directory DIR       Target directory to scan (default: current directory)
+      --glob PATTERN        Process only files matching PATTERN, relative to the
+                            target directory; ** matches any depth (repeatable)
+      --exclude PATTERN     Skip files matching PATTERN (repeatable)
+      --max-depth N         Descend at most N directories below the target directory
+                            when scanning (default: no limit; 0 scans only its files)
+      --only-type TYPE      Process only trust stores of TYPE: pem, jks, jceks, bks
+                            or pkcs12 (repeatable)
+      --allow-path DIR      Only modify trust stores under DIR; others are
+                            reported but never written (repeatable)
+      --allow-system-store  Also modify JRE cacerts stores, which every Java
+                            application on the host trusts
   -c, --certificate FILE    Path to certificate to append (default: auto-generated)
+      --alias NAME          Alias of the appended certificate in JKS, JCEKS and BKS
+                            stores (default: its CN and the start of its SHA-256
+                            fingerprint, such as corp-root-ca-3f2a9c1b)
+      --est-url URL         Enroll the certificate to append from this EST server
+                            (e.g. https://ca.example.com/.well-known/est) instead
+                            of generating a self-signed one
+      --est-user USER       EST user name; the password is read from \$EST_PASSWORD
+      --cert-from-endpoint HOST[:PORT]
+                            Append the root, or the top intermediate, of the chain
+                            that this TLS endpoint presents (default port: 443);
+                            asks for confirmation, since it trusts whatever is presented
+      --yes                 Trust the --cert-from-endpoint certificate without asking
+      --cert-kind KIND      Generated certificate: ca (default, for trust store
+                            tests) or leaf (a TLS server certificate)
+      --cn NAME             Common name of the generated certificate
+                            (default: Test Certificate)
+      --org NAME            Organization of the generated certificate
+                            (default: Trust Store Scanner)
+      --san NAME            Subject alternative name: a DNS name, an IP address
+                            or a typed name such as URI:spiffe://... (repeatable)
+      --validity-days N     Validity of the generated certificate (default: 365)
+      --key-type TYPE       Key of the generated or enrolled certificate: rsa
+                            (default), ecdsa or ed25519
+      --key-size BITS       RSA key size (default: 4096)
+      --curve NAME          ECDSA curve: P-256 (default), P-384 or P-521
   -l, --log FILE            Log file path (default: trust_store_scan_YYYYMMDD_HHMMSS.log)
   -p, --passwords "p1 p2"   Space-separated list of passwords to try (in quotes)
   -k, --kubernetes          Enable Kubernetes mode (scan ConfigMaps and Secrets)
   -D, --docker              Enable Docker mode (scan common Docker trust store locations)
   -r, --restart             Restart affected services after modification
   -n, --no-backup           Disable backup creation before modification
+      --state-file FILE     Record the stores that a run leaves compliant in FILE, and
+                            skip them on later runs while they are unchanged
+      --lock-timeout SECONDS
+                            Wait this long for another run that is modifying the
+                            same target to finish (default: 0, exit at once)
+      --backup-mode MODE    How backups are made: copy (default), hardlink (instant,
+                            falls back to copy across filesystems) or reflink (a
+                            copy-on-write clone, falls back to copy)
   -v, --verbose             Enable verbose output
+      --progress            Report the progress of a directory scan: a progress bar
+                            on a terminal, otherwise a log line every $PROGRESS_INTERVAL seconds
+                            (default: on when stderr is a terminal)
+      --no-progress         Do not report progress
   -b, --baseline URL        URL to download baseline trust store for comparison
+      --proxy URL           Proxy for the baseline download (default: the
+                            http_proxy, https_proxy and no_proxy variables)
+      --baseline-pin sha256:BASE64
+                            Only download the baseline from a server whose public key
+                            has this SHA-256 pin, as curl --pinnedpubkey takes it
+                            (repeatable, e.g. for a key rollover; needs curl)
+      --download-timeout SECONDS
+                            Give up on the baseline download after this long (default: 30)
+      --roots-dir DIR       Add every PEM or DER certificate in DIR that a store
+                            lacks, instead of appending one certificate
+      --prune               Also remove the certificates that are not in the baseline
+                            (-b or --roots-dir); the store is always backed up first
+      --normalize           Rewrite modified PEM stores as canonical PEM: certificates
+                            re-encoded, sorted by fingerprint and deduplicated
+      --no-newline-fix      Append to PEM stores as they are, without first ending
+                            a last line that lacks a newline
   -C, --compare-only        Only compare trust stores, don't modify them
+      --expiry-warning-days N
+                            Warn about certificates already in a store that expire
+                            within N days (default: 30); expired ones always warn
+      --exclude-expired     Don't add baseline certificates that have expired
+      --exclude-not-yet-valid
+                            Don't add baseline certificates that are not valid yet
       --noop, --dry-run     Show what changes would be made without implementing them
+      --fail-on-change      Check stores against the baseline (-b) without modifying
+                            them, and exit $EXIT_DRIFT if applying it would change any store
+      --keytool-path PATH   Use this keytool instead of searching for one
+      --openssl-path PATH   Use this openssl instead of the one on the PATH
+      --pkcs12-compat MODE  Encryption for rewritten PKCS12 stores: preserve (default),
+                            legacy (readable by Java 8) or modern (AES-256)
+      --bc-provider-path JAR
+                            BouncyCastle provider jar that keytool needs to read
+                            BKS stores; without it BKS stores are skipped
+      --approved-ca PATTERN Only add certificates whose subject or issuer matches
+                            this pattern, such as 'CN=Corp Root CA,*' (repeatable)
+      --approved-ca-file FILE
+                            Read approved CA patterns from FILE, one per line
+      --force               Add certificates that match no approved CA pattern
+      --ref-base DIR        Resolve relative trust store paths in config files against
+                            DIR first, such as \$CATALINA_HOME (repeatable)
+      --webhook URL         POST a JSON summary of the run, in the audit log format of
+                            the Go and enterprise managers, to URL when it ends
+                            (a bearer token is read from \$WEBHOOK_API_KEY)
+      --audit-upload URI    Upload the same audit log to object storage, at
+                            s3://bucket/prefix, gs://bucket/prefix or
+                            az://container/prefix, with the aws, gcloud or az CLI
+      --otel-endpoint URL   Export an OpenTelemetry trace of the run, with a span per
+                            trust store, to the OTLP/HTTP collector at URL
+                            (e.g. http://collector:4318)
+      --csv FILE            Write one CSV row per certificate in every trust store
+                            found to FILE, as read before any change
+      --db FILE             Record the stores, certificates and findings of the run
+                            in the SQLite database FILE, with the sqlite3 CLI
+      --hosts FILE          Dry-run the scan on every SSH target in FILE, one
+                            '[user@]host [directory]' per line, and report each host
+      --host-concurrency N  Scan at most N hosts at once (default: 4)
+      --host-timeout SECONDS
+                            Give up on a host after SECONDS (default: 300)
   -h, --help                Display this help message
 
 Examples:
   $0 --noop -d /path/to/project                     # Dry-run scan
+  $0 --noop -d /opt --glob '**/truststore.jks' --exclude 'backup/**'
   $0 -d /path/to/project -c /path/to/cert.pem       # Add certificate
   $0 --kubernetes --restart                         # Kubernetes mode
   $0 --docker -v                                    # Docker mode verbose
   $0 -b https://example.com/baseline.pem -C        # Compare with baseline
+  $0 -b https://example.com/baseline.pem --fail-on-change   # CI drift check
 EOF
     exit 1
 }
@@ -120,10 +575,94 @@ parse_args() {
                 TARGET_DIR="$2"
                 shift 2
                 ;;
+            --glob)
+                GLOB_PATTERNS+=("$2")
+                shift 2
+                ;;
+            --max-depth)
+                MAX_DEPTH="$2"
+                shift 2
+                ;;
+            --exclude)
+                EXCLUDE_PATTERNS+=("$2")
+                shift 2
+                ;;
+            --allow-path)
+                ALLOWED_PATHS+=("$2")
+                shift 2
+                ;;
+            --only-type)
+                ONLY_TYPES+=("$(echo "$2" | tr '[:lower:]' '[:upper:]')")
+                shift 2
+                ;;
+            --allow-system-store)
+                ALLOW_SYSTEM_STORE=true
+                shift
+                ;;
             -c|--certificate)
                 TEST_CERT_PATH="$2"
                 shift 2
                 ;;
+            --alias)
+                CERT_ALIAS="$2"
+                shift 2
+                ;;
+            --est-url)
+                EST_URL="$2"
+                shift 2
+                ;;
+            --cert-from-endpoint)
+                CERT_ENDPOINT="$2"
+                shift 2
+                ;;
+            --yes)
+                ASSUME_YES=true
+                shift
+                ;;
+            --est-user)
+                EST_USER="$2"
+                shift 2
+                ;;
+            --cert-kind)
+                CERT_KIND="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --cn)
+                CERT_CN="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --org)
+                CERT_ORG="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --san)
+                CERT_SANS+=("$2")
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --validity-days)
+                CERT_DAYS="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --key-type)
+                KEY_TYPE="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --key-size)
+                KEY_SIZE="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
+            --curve)
+                KEY_CURVE="$2"
+                CERT_OPTIONS=true
+                shift 2
+                ;;
             -l|--log)
                 LOG_FILE="$2"
                 shift 2
@@ -148,14 +687,62 @@ parse_args() {
                 BACKUP=false
                 shift
                 ;;
+            --backup-mode)
+                BACKUP_MODE="$2"
+                shift 2
+                ;;
             -v|--verbose)
                 VERBOSE=true
                 shift
                 ;;
+            --progress)
+                PROGRESS=true
+                shift
+                ;;
+            --no-progress)
+                PROGRESS=false
+                shift
+                ;;
             -b|--baseline)
                 BASELINE_URL="$2"
                 shift 2
                 ;;
+            --roots-dir)
+                ROOTS_DIR="$2"
+                shift 2
+                ;;
+            --prune)
+                PRUNE=true
+                shift
+                ;;
+            --normalize)
+                NORMALIZE=true
+                shift
+                ;;
+            --no-newline-fix)
+                NEWLINE_FIX=false
+                shift
+                ;;
+            --baseline-pin)
+                BASELINE_PINS+=("$2")
+                shift 2
+                ;;
+            --proxy)
+                BASELINE_PROXY="$2"
+                shift 2
+                ;;
+            --download-timeout)
+                DOWNLOAD_TIMEOUT="$2"
+                shift 2
+                ;;
+            --expiry-warning-days)
+                EXPIRY_WARNING_DAYS="$2"
+                shift 2
+                ;;
+            --lock-timeout)
+                LOCK_TIMEOUT="$2"
+                shift 2
+                ;;
             -C|--compare-only)
                 COMPARE_MODE=true
                 shift
@@ -164,6 +751,96 @@ parse_args() {
                 NOOP_MODE=true
                 shift
                 ;;
+            --fail-on-change)
+                FAIL_ON_CHANGE=true
+                shift
+                ;;
+            --exclude-expired)
+                EXCLUDE_EXPIRED=true
+                shift
+                ;;
+            --exclude-not-yet-valid)
+                EXCLUDE_NOT_YET_VALID=true
+                shift
+                ;;
+            --keytool-path)
+                KEYTOOL_PATH="$2"
+                shift 2
+                ;;
+            --openssl-path)
+                OPENSSL_PATH="$2"
+                shift 2
+                ;;
+            --pkcs12-compat)
+                PKCS12_COMPAT="$2"
+                shift 2
+                ;;
+            --bc-provider-path)
+                BC_PROVIDER_PATH="$2"
+                shift 2
+                ;;
+            --approved-ca)
+                APPROVED_CA_PATTERNS+=("$2")
+                shift 2
+                ;;
+            --approved-ca-file)
+                if [ ! -f "$2" ]; then
+                    log_error "Approved CA file does not exist: $2"
+                    exit 1
+                fi
+                # One pattern per line; blank lines and # comments are skipped
+                while IFS= read -r pattern || [ -n "$pattern" ]; do
+                    pattern="${pattern%$'\r'}"
+                    if [ -n "$pattern" ] && [[ "$pattern" != "#"* ]]; then
+                        APPROVED_CA_PATTERNS+=("$pattern")
+                    fi
+                done < "$2"
+                shift 2
+                ;;
+            --force)
+                FORCE=true
+                shift
+                ;;
+            --ref-base)
+                REF_BASES+=("$2")
+                shift 2
+                ;;
+            --webhook)
+                WEBHOOK_URL="$2"
+                shift 2
+                ;;
+            --audit-upload)
+                AUDIT_UPLOAD_URI="$2"
+                shift 2
+                ;;
+            --otel-endpoint)
+                OTEL_ENDPOINT="$2"
+                shift 2
+                ;;
+            --hosts)
+                HOSTS_FILE="$2"
+                shift 2
+                ;;
+            --host-concurrency)
+                HOST_CONCURRENCY="$2"
+                shift 2
+                ;;
+            --host-timeout)
+                HOST_TIMEOUT="$2"
+                shift 2
+                ;;
+            --state-file)
+                STATE_FILE="$2"
+                shift 2
+                ;;
+            --csv)
+                CSV_FILE="$2"
+                shift 2
+                ;;
+            --db)
+                DB_FILE="$2"
+                shift 2
+                ;;
             -h|--help)
                 usage
                 ;;
@@ -180,72 +857,369 @@ parse_args() {
         exit 1
     fi
 
-    # Use provided certificate or create a test one
-    if [ -z "$TEST_CERT_PATH" ]; then
-        TEST_CERT_PATH="$DEFAULT_CERT_PATH"
-        create_test_certificate
-    elif [ ! -f "$TEST_CERT_PATH" ]; then
-        log_error "Certificate file does not exist: $TEST_CERT_PATH"
+    local only_type
+    for only_type in "${ONLY_TYPES[@]}"; do
+        case "$only_type" in
+            PEM|JKS|JCEKS|BKS|PKCS12) ;;
+            *)
+                log_error "Invalid --only-type: $only_type (expected pem, jks, jceks, bks or pkcs12)"
+                exit 1
+                ;;
+        esac
+    done
+
+    case "$BACKUP_MODE" in
+        copy|hardlink|reflink) ;;
+        *)
+            log_error "Invalid --backup-mode: $BACKUP_MODE (expected copy, hardlink or reflink)"
+            exit 1
+            ;;
+    esac
+
+    case "$PKCS12_COMPAT" in
+        preserve|legacy|modern) ;;
+        *)
+            log_error "Invalid --pkcs12-compat mode: $PKCS12_COMPAT (expected preserve, legacy or modern)"
+            exit 1
+            ;;
+    esac
+
+    # Drift is measured against the baseline, so there must be one
+    if [ "$FAIL_ON_CHANGE" = true ] && ! has_baseline; then
+        log_error "--fail-on-change requires a baseline trust store (-b or --roots-dir)"
         exit 1
     fi
 
-    # Additional validation for baseline URL
-    if [ -n "$BASELINE_URL" ]; then
-        if ! download_baseline_store; then
+    for base in "${REF_BASES[@]}"; do
+        if [ ! -d "$base" ]; then
+            log_error "Reference base directory does not exist: $base"
             exit 1
         fi
+    done
+
+    if [ "$PRUNE" = true ] && ! has_baseline; then
+        log_error "--prune removes the certificates that are not in the baseline, so it requires -b or --roots-dir"
+        exit 1
     fi
-}
 
-# Check for required tools
-check_dependencies() {
-    local missing_deps=false
-    
-    # Check for basic dependencies
-    for cmd in openssl find grep sed awk; do
-        if ! command -v "$cmd" &> /dev/null; then
-            log_error "Required command not found: $cmd"
-            missing_deps=true
+    if [ -n "$ROOTS_DIR" ]; then
+        if [ ! -d "$ROOTS_DIR" ]; then
+            log_error "Roots directory does not exist: $ROOTS_DIR"
+            exit 1
+        fi
+        if [ -n "$BASELINE_URL" ]; then
+            log_error "--roots-dir and -b both set the certificates to add; use one of them"
+            exit 1
+        fi
+        if [ -n "$TEST_CERT_PATH" ] || [ -n "$EST_URL" ] || [ -n "$CERT_ENDPOINT" ] || [ "$CERT_OPTIONS" = true ]; then
+            log_error "--roots-dir adds its own certificates, so it cannot be combined with -c, --est-url, --cert-from-endpoint or certificate generation options"
+            exit 1
+        fi
+    fi
+
+    for tool_path in "$KEYTOOL_PATH" "$OPENSSL_PATH"; do
+        if [ -n "$tool_path" ] && [ ! -x "$tool_path" ]; then
+            log_error "Not an executable file: $tool_path"
+            exit 1
         fi
     done
-    
-    # Check for keytool specifically
-find_keytool() {
-    local keytool_path=""
-    
-    # Common JRE/JDK installation directories
-    local java_dirs=(
-        "/usr/lib/jvm"              # Linux default
-        "/usr/java"                 # Alternative Linux
-        "/usr/local/java"           # Local installations
-        "/Library/Java/JavaVirtualMachines"  # macOS
-        "/System/Library/Java/JavaVirtualMachines"  # macOS System
-        "/opt/java"                 # Optional installations
-        "/opt/jdk"
-        "/opt/openjdk"
-        "$HOME/.sdkman/candidates/java"  # SDKMAN installations
-        "/c/Program Files/Java"     # Windows (through WSL)
-        "/c/Program Files (x86)/Java"
-    )
-    
-    log_info "Searching for keytool utility..."
-    
-    # First check if keytool is already in PATH
-    if command -v keytool &> /dev/null; then
-        keytool_path=$(command -v keytool)
-        log_success "Found keytool in PATH: $keytool_path"
-        echo "$keytool_path"
-        return 0
+
+    if [ -n "$BC_PROVIDER_PATH" ] && [ ! -f "$BC_PROVIDER_PATH" ]; then
+        log_error "BouncyCastle provider jar does not exist: $BC_PROVIDER_PATH"
+        exit 1
     fi
-    
-    # Search in common Java directories
-    for base_dir in "${java_dirs[@]}"; do
-        if [ -d "$base_dir" ]; then
-            log_debug "Searching in $base_dir"
+
+    case "$CERT_KIND" in
+        ca|leaf) ;;
+        *)
+            log_error "Invalid --cert-kind: $CERT_KIND (expected ca or leaf)"
+            exit 1
+            ;;
+    esac
+
+    case "$KEY_TYPE" in
+        rsa|ecdsa|ed25519) ;;
+        *)
+            log_error "Invalid --key-type: $KEY_TYPE (expected rsa, ecdsa or ed25519)"
+            exit 1
+            ;;
+    esac
+
+    if ! [[ "$KEY_SIZE" =~ ^[0-9]+$ ]] || [ "$KEY_SIZE" -lt 2048 ]; then
+        log_error "Invalid --key-size: $KEY_SIZE (expected at least 2048 bits)"
+        exit 1
+    fi
+
+    if ! [[ "$DOWNLOAD_TIMEOUT" =~ ^[1-9][0-9]*$ ]]; then
+        log_error "Invalid --download-timeout: $DOWNLOAD_TIMEOUT (expected a positive number of seconds)"
+        exit 1
+    fi
+
+    if [ -n "$CERT_ALIAS" ] && ! [[ "$CERT_ALIAS" =~ ^[A-Za-z0-9._-]+$ ]]; then
+        log_error "Invalid --alias: $CERT_ALIAS (expected letters, digits, '.', '_' and '-')"
+        exit 1
+    fi
+
+    if [ -n "$AUDIT_UPLOAD_URI" ] && ! [[ "$AUDIT_UPLOAD_URI" =~ ^(s3|gs|az)://[^/]+ ]]; then
+        log_error "Invalid --audit-upload: $AUDIT_UPLOAD_URI (expected s3://, gs:// or az:// and a bucket or container)"
+        exit 1
+    fi
+
+    if [ -n "$HOSTS_FILE" ] && [ ! -r "$HOSTS_FILE" ]; then
+        log_error "Cannot read --hosts file: $HOSTS_FILE"
+        exit 1
+    fi
+    if ! [[ "$HOST_CONCURRENCY" =~ ^[1-9][0-9]*$ ]]; then
+        log_error "Invalid --host-concurrency: $HOST_CONCURRENCY (expected a positive number)"
+        exit 1
+    fi
+    if ! [[ "$HOST_TIMEOUT" =~ ^[1-9][0-9]*$ ]]; then
+        log_error "Invalid --host-timeout: $HOST_TIMEOUT (expected a positive number of seconds)"
+        exit 1
+    fi
+
+    local pin
+    for pin in "${BASELINE_PINS[@]}"; do
+        if ! [[ "$pin" =~ ^sha256:[A-Za-z0-9+/]{43}=$ ]]; then
+            log_error "Invalid --baseline-pin: $pin (expected sha256: and a base64 SHA-256 of the server's public key)"
+            exit 1
+        fi
+    done
+    if [ ${#BASELINE_PINS[@]} -gt 0 ] && [[ "$BASELINE_URL" != https://* ]]; then
+        log_error "--baseline-pin needs an https:// baseline URL (-b)"
+        exit 1
+    fi
+
+    if ! [[ "$LOCK_TIMEOUT" =~ ^[0-9]+$ ]]; then
+        log_error "Invalid --lock-timeout: $LOCK_TIMEOUT (expected a number of seconds)"
+        exit 1
+    fi
+
+    if [ -n "$MAX_DEPTH" ] && ! [[ "$MAX_DEPTH" =~ ^[0-9]+$ ]]; then
+        log_error "Invalid --max-depth: $MAX_DEPTH (expected a number of directories)"
+        exit 1
+    fi
+
+    if [ -z "$PROGRESS" ]; then
+        if [ -t 2 ]; then
+            PROGRESS=true
+        else
+            PROGRESS=false
+        fi
+    fi
+
+    if ! [[ "$EXPIRY_WARNING_DAYS" =~ ^[0-9]+$ ]]; then
+        log_error "Invalid --expiry-warning-days: $EXPIRY_WARNING_DAYS (expected a number of days)"
+        exit 1
+    fi
+
+    if ! [[ "$CERT_DAYS" =~ ^[1-9][0-9]*$ ]]; then
+        log_error "Invalid --validity-days: $CERT_DAYS (expected a positive number of days)"
+        exit 1
+    fi
+
+    if [ "$CERT_OPTIONS" = true ] && [ -n "$TEST_CERT_PATH" ]; then
+        log_error "Certificate generation options cannot be combined with -c"
+        exit 1
+    fi
+
+    if [ -n "$EST_URL" ] && [ -n "$TEST_CERT_PATH" ]; then
+        log_error "--est-url enrolls the certificate to append, so it cannot be combined with -c"
+        exit 1
+    fi
+
+    if [ -n "$CERT_ENDPOINT" ] && { [ -n "$TEST_CERT_PATH" ] || [ -n "$EST_URL" ] || [ "$CERT_OPTIONS" = true ]; }; then
+        log_error "--cert-from-endpoint sets the certificate to append, so it cannot be combined with -c, --est-url or certificate generation options"
+        exit 1
+    fi
+
+    # Use provided certificate, enroll one through EST, or create a test one.
+    # --roots-dir replaces the appended certificate with its own set.
+    if [ -n "$ROOTS_DIR" ]; then
+        if ! load_roots_dir; then
+            exit 1
+        fi
+    elif [ -n "$EST_URL" ]; then
+        TEST_CERT_PATH="$EST_CERT_PATH"
+        if ! enroll_est_certificate; then
+            exit 1
+        fi
+    elif [ -n "$CERT_ENDPOINT" ]; then
+        TEST_CERT_PATH="$ENDPOINT_CERT_PATH"
+        if ! fetch_endpoint_certificate || ! confirm_endpoint_certificate; then
+            exit 1
+        fi
+    elif [ -z "$TEST_CERT_PATH" ]; then
+        TEST_CERT_PATH="$DEFAULT_CERT_PATH"
+        create_test_certificate
+    elif [ ! -f "$TEST_CERT_PATH" ]; then
+        log_error "Certificate file does not exist: $TEST_CERT_PATH"
+        exit 1
+    fi
+
+    # Additional validation for baseline URL
+    if [ -n "$BASELINE_URL" ]; then
+        if ! download_baseline_store; then
+            exit 1
+        fi
+    fi
+}
+
+# Report whether stores are compared with a baseline: a downloaded one or the
+# certificates of --roots-dir
+has_baseline() {
+    [ -n "$BASELINE_URL" ] || [ -n "$ROOTS_DIR" ]
+}
+
+# Collect the certificates in --roots-dir into the baseline store, so that
+# each store gets the ones it lacks like it would from a downloaded baseline.
+# PEM files may hold several certificates; DER files hold one.
+load_roots_dir() {
+    local file
+    local count
+
+    log_info "Loading root certificates from $ROOTS_DIR"
+    : > "$BASELINE_STORE"
+    for file in "$ROOTS_DIR"/*; do
+        if [ ! -f "$file" ]; then
+            continue
+        fi
+        if awk '/-----BEGIN CERTIFICATE-----/ { found = 1; exit } END { exit !found }' "$file"; then
+            cat "$file" >> "$BASELINE_STORE"
+            echo >> "$BASELINE_STORE"
+        elif ! openssl x509 -inform DER -in "$file" >> "$BASELINE_STORE" 2>/dev/null; then
+            log_warning "Skipping $file: not a PEM or DER certificate"
+        fi
+    done
+
+    count=$(awk '/-----BEGIN CERTIFICATE-----/ { n++ } END { print n + 0 }' "$BASELINE_STORE")
+    if [ "$count" -eq 0 ]; then
+        log_error "No certificates found in $ROOTS_DIR"
+        return 1
+    fi
+    log_info "Loaded $count root certificates from $ROOTS_DIR"
+}
+
+# Run the selected keytool and openssl binaries, so that --keytool-path and
+# --openssl-path apply to every call in this script
+keytool() {
+    if [ -n "$KEYTOOL_PATH" ]; then
+        "$KEYTOOL_PATH" "$@"
+    else
+        command keytool "$@"
+    fi
+}
+
+openssl() {
+    if [ -n "$OPENSSL_PATH" ]; then
+        "$OPENSSL_PATH" "$@"
+    else
+        command openssl "$@"
+    fi
+}
+
+# Run a keytool or openssl command without showing its output. When it fails,
+# the last lines it printed are kept in LAST_TOOL_ERROR so that the caller
+# can say why, such as a wrong password or an unsupported algorithm.
+run_quiet() {
+    local output
+    local status=0
+    output=$("$@" 2>&1) || status=$?
+    if [ $status -eq 0 ]; then
+        LAST_TOOL_ERROR=""
+        return 0
+    fi
+    LAST_TOOL_ERROR=$(printf '%s\n' "$output" | sed '/^[[:space:]]*$/d' | tail -n 3 | awk '{ printf "%s%s", sep, $0; sep = "; " }')
+    return $status
+}
+
+# Look for keytool at most once per run. find_keytool may walk whole JRE
+# installation trees, so a failed search is remembered as well as a found path.
+locate_keytool() {
+    if [ -z "$KEYTOOL_PATH" ] && [ "$KEYTOOL_SEARCHED" = false ]; then
+        KEYTOOL_SEARCHED=true
+        KEYTOOL_PATH=$(find_keytool) || true
+    fi
+    [ -n "$KEYTOOL_PATH" ]
+}
+
+# Check for required tools
+check_dependencies() {
+    local missing_deps=false
+    
+    # sed and awk parse openssl output and the store references on every run.
+    # find is only needed to walk the target directory, which --glob,
+    # Kubernetes and Docker runs do not do.
+    local required=(sed awk)
+    if [ "$KUBERNETES_MODE" = false ] && [ "$DOCKER_MODE" = false ] && [ ${#GLOB_PATTERNS[@]} -eq 0 ]; then
+        required+=(find)
+    fi
+    for cmd in "${required[@]}"; do
+        if ! command -v "$cmd" &> /dev/null; then
+            log_error "Required command not found: $cmd"
+            missing_deps=true
+        fi
+    done
+    
+    # Explicit tool paths were checked in parse_args and bypass discovery
+    if [ -z "$OPENSSL_PATH" ] && ! type -P openssl &> /dev/null; then
+        log_error "Required command not found: openssl"
+        missing_deps=true
+    fi
+    
+    # keytool is optional: PEM and PKCS12 stores need only openssl, and JKS
+    # stores are refused one by one in process_trust_store. It is not looked
+    # for when --only-type selects no keytool store type.
+    if { type_selected JKS || type_selected JCEKS || type_selected BKS; } && ! locate_keytool; then
+        log_warning "keytool not found: JKS trust stores will be skipped"
+    fi
+    
+    if [ "$missing_deps" = true ]; then
+        log_error "Please install missing dependencies and try again."
+        exit 1
+    fi
+}
+
+# Find keytool on the PATH or in common JRE/JDK installation directories.
+# Only the path is written to stdout; progress messages go to stderr.
+find_keytool() {
+    local keytool_path=""
+    
+    # Common JRE/JDK installation directories
+    local java_dirs=(
+        "/usr/lib/jvm"              # Linux default
+        "/usr/java"                 # Alternative Linux
+        "/usr/local/java"           # Local installations
+        "/Library/Java/JavaVirtualMachines"  # macOS
+        "/System/Library/Java/JavaVirtualMachines"  # macOS System
+        "/opt/java"                 # Optional installations
+        "/opt/jdk"
+        "/opt/openjdk"
+        "$HOME/.sdkman/candidates/java"  # SDKMAN installations
+        "/c/Program Files/Java"     # Windows (through WSL)
+        "/c/Program Files (x86)/Java"
+    )
+    
+    log_info "Searching for keytool utility..." >&2
+    
+    # First check if keytool is already in PATH
+    if keytool_path=$(type -P keytool); then
+        log_success "Found keytool in PATH: $keytool_path" >&2
+        echo "$keytool_path"
+        return 0
+    fi
+    
+    # Search in common Java directories
+    if ! command -v find &> /dev/null; then
+        java_dirs=()
+    fi
+    for base_dir in "${java_dirs[@]}"; do
+        if [ -d "$base_dir" ]; then
+            log_debug "Searching in $base_dir" >&2
             # Find all keytool executables
             while IFS= read -r path; do
                 if [ -x "$path" ]; then
-                    log_success "Found keytool: $path"
+                    log_success "Found keytool: $path" >&2
                     echo "$path"
                     return 0
                 fi
@@ -253,127 +1227,944 @@ find_keytool() {
         fi
     done
     
-    KEYTOOL_PATH=$(find_keytool)
-    if [ -z "$KEYTOOL_PATH" ]; then
-        missing_deps=true
-    else
-        # Export the keytool path for use in other functions
-        export KEYTOOL_PATH
-        # Create an alias to ensure we use the found keytool
-        alias keytool="$KEYTOOL_PATH"
-    fi
+    # If no keytool found, try to help user install Java
+    {
+        log_warning "Could not find keytool utility"
+        log_info "To process JKS trust stores, install a Java Runtime Environment (JRE) or Java Development Kit (JDK)"
+        log_info "or point --keytool-path at an existing keytool"
+        log_info "You can install Java using one of these methods:"
+        log_info "- macOS: brew install openjdk"
+        log_info "- Ubuntu/Debian: sudo apt-get install default-jre"
+        log_info "- CentOS/RHEL: sudo yum install java-11-openjdk"
+        log_info "- Manual download: https://adoptium.net/temurin/releases/"
+    } >&2
     
-    if [ "$missing_deps" = true ]; then
-        log_error "Please install missing dependencies and try again."
-        exit 1
-    fi
+    return 1
 }
 
-# Create backup of a file
+# Create backup of a file and print its path. A hardlink backup shares the
+# store's inode, which is safe because stores are only ever replaced by a
+# rename (see begin_store_rewrite), never written in place.
 create_backup() {
     local file="$1"
     local backup_file="${file}.bak.$(date +%Y%m%d_%H%M%S)"
     
     if [ "$BACKUP" = true ]; then
-        cp "$file" "$backup_file"
-        log_debug "Created backup: $backup_file"
+        case "$BACKUP_MODE" in
+            hardlink)
+                if ! ln "$(store_write_path "$file")" "$backup_file" 2>/dev/null; then
+                    log_debug "Cannot hardlink $file, copying it instead" >&2
+                    cp "$file" "$backup_file"
+                fi
+                ;;
+            reflink)
+                local clone=(cp --reflink=always)
+                if [ "$(uname -s)" = "Darwin" ]; then
+                    clone=(cp -c)
+                fi
+                if ! "${clone[@]}" "$file" "$backup_file" 2>/dev/null; then
+                    log_debug "Cannot clone $file, copying it instead" >&2
+                    cp "$file" "$backup_file"
+                fi
+                ;;
+            *)
+                cp "$file" "$backup_file"
+                ;;
+        esac
+        log_debug "Created backup: $backup_file" >&2
         echo "$backup_file"
     else
-        log_debug "Backup disabled, skipping backup creation for $file"
+        log_debug "Backup disabled, skipping backup creation for $file" >&2
         echo ""
     fi
 }
 
-# Detect file type
+# Print the path that rewrites of a store rename over: the store itself, or
+# the file a symlinked store points to, so that the link is kept
+store_write_path() {
+    if [ -L "$1" ]; then
+        canonical_path "$1"
+    else
+        echo "$1"
+    fi
+}
+
+# Start rewriting a store: print the path of its new version, file.tmp, which
+# keeps the store's mode and owner. The new version starts as a copy of the
+# store, or empty with "empty" for writers that replace the whole contents.
+begin_store_rewrite() {
+    local target
+    target=$(store_write_path "$1")
+
+    if [ "$2" = "empty" ] && cp -p --attributes-only "$target" "$target.tmp" 2>/dev/null; then
+        : > "$target.tmp"
+    elif ! cp -p "$target" "$target.tmp"; then
+        rm -f "$target.tmp"
+        log_error "Could not copy $1 to rewrite it" >&2
+        return 1
+    fi
+    echo "$target.tmp"
+}
+
+# Replace a store with the new version from begin_store_rewrite in one rename,
+# so the store's old inode, which a hardlink backup may share, is never written
+finish_store_rewrite() {
+    mv -f "$2" "$(store_write_path "$1")"
+}
+
+# Print the first 16 bytes of a file as lowercase hex
+file_magic() {
+    od -An -tx1 -N16 "$1" 2>/dev/null | tr -d ' \n'
+}
+
+# Report whether a file header, in hex, opens a PKCS12 PFX: a DER SEQUENCE
+# whose first element is the version INTEGER 3
+is_pfx_magic() {
+    local magic="$1"
+    local offset=4
+
+    [[ "$magic" == 30* ]] && [ ${#magic} -ge 4 ] || return 1
+    # Skip the SEQUENCE length, in short form or long form
+    local length=$((16#${magic:2:2}))
+    if [ "$length" -ge 128 ]; then
+        offset=$((offset + (length - 128) * 2))
+    fi
+    [ "${magic:$offset:6}" = "020103" ]
+}
+
+# Print an identity for a file's current contents: its inode, modification
+# time and size. A store that is appended to or renamed over gets a new one.
+file_stamp() {
+    stat -c '%i.%Y.%s' "$1" 2>/dev/null || stat -f '%i.%m.%z' "$1" 2>/dev/null
+}
+
+# Print the path prefix under STORE_CACHE_DIR that caches data about a file
+cache_path() {
+    mkdir -p -m 700 "$STORE_CACHE_DIR"
+    echo "$STORE_CACHE_DIR/$(printf '%s' "$1" | cksum | cut -d ' ' -f 1)"
+}
+
+# Detect a file's type once for the run. Later detect_file_type calls, which
+# run in command substitutions, reuse it while the file is unchanged.
+remember_file_type() {
+    local file="$1"
+    FILE_TYPE_CACHE["$file"]="$(file_stamp "$file") $(probe_file_type "$file")"
+}
+
+# Detect file type, from the remembered type while the file is unchanged
 detect_file_type() {
+    local file="$1"
+    local cached="${FILE_TYPE_CACHE["$file"]}"
+
+    if [ -n "$cached" ] && [ "${cached% *}" = "$(file_stamp "$file")" ]; then
+        echo "${cached##* }"
+        return
+    fi
+    probe_file_type "$file"
+}
+
+# Detect file type. JKS, JCEKS and PKCS12 stores are recognized by their
+# header whatever their name; BKS has no distinctive header, so it is only
+# recognized by extension.
+probe_file_type() {
     local file="$1"
     local file_type=""
+    local magic
+    magic=$(file_magic "$file")
     
-    # Check file extension
-    case "$file" in
-        *.jks|*.keystore|*.truststore)
+    case "$magic" in
+        feedfeed*)
             file_type="JKS"
             ;;
-        *.p12|*.pfx)
-            file_type="PKCS12"
-            ;;
-        *.pem|*.crt|*.cer|*.cert)
-            file_type="PEM"
+        cececece*)
+            file_type="JCEKS"
             ;;
-        *)
-            # Try to determine by content
-            if file "$file" | grep -q "Java KeyStore"; then
-                file_type="JKS"
-            elif file "$file" | grep -q "PKCS12"; then
-                file_type="PKCS12"
-            elif grep -q "BEGIN CERTIFICATE" "$file" 2>/dev/null; then
+        1f8b*)
+            # A gzip-compressed bundle, such as ca-bundle.crt.gz
+            if gzip -dc "$file" 2>/dev/null | awk '/BEGIN CERTIFICATE/ { found = 1; exit } END { exit !found }'; then
                 file_type="PEM"
             else
                 file_type="UNKNOWN"
             fi
             ;;
+        *)
+            if is_pfx_magic "$magic"; then
+                file_type="PKCS12"
+            fi
+            ;;
     esac
     
+    # Check file extension
+    if [ -z "$file_type" ]; then
+        case "$file" in
+            *.jks|*.keystore|*.truststore)
+                file_type="JKS"
+                ;;
+            *.jceks)
+                file_type="JCEKS"
+                ;;
+            *.bks|*.ubr)
+                file_type="BKS"
+                ;;
+            *.p12|*.pfx)
+                file_type="PKCS12"
+                ;;
+            *.pem|*.crt|*.cer|*.cert)
+                # A DER certificate shares these extensions, and appending PEM
+                # text to it would corrupt it
+                if [[ "$magic" == 30* ]]; then
+                    file_type="UNKNOWN"
+                else
+                    file_type="PEM"
+                fi
+                ;;
+            *)
+                # Try to determine by content
+                if awk '/BEGIN CERTIFICATE/ { found = 1; exit } END { exit !found }' "$file" 2>/dev/null; then
+                    file_type="PEM"
+                else
+                    file_type="UNKNOWN"
+                fi
+                ;;
+        esac
+    fi
+    
     echo "$file_type"
 }
 
-# Handle JKS trust store
+# Report whether a file is gzip-compressed
+is_gzip() {
+    [[ "$(file_magic "$1")" == 1f8b* ]]
+}
+
+# Copy a PEM trust store to out, decompressing it if it is gzipped
+read_pem_store() {
+    local file="$1"
+    local out="$2"
+
+    if is_gzip "$file"; then
+        gzip -dc "$file" > "$out"
+    else
+        cp "$file" "$out"
+    fi
+}
+
+# Report whether a PEM file, gzipped or not, ends its lines with CRLF, as
+# files saved by Windows tools do
+pem_uses_crlf() {
+    local file="$1"
+
+    if is_gzip "$file"; then
+        gzip -dc "$file" 2>/dev/null | head -n 1
+    else
+        head -n 1 "$file" 2>/dev/null
+    fi | grep -q $'\r$'
+}
+
+# Print a PEM file with CRLF line endings if crlf is true, and LF ones otherwise
+with_line_endings() {
+    awk -v crlf="$2" '{ sub(/\r$/, ""); print $0 (crlf == "true" ? "\r" : "") }' "$1"
+}
+
+# Append the PEM file certs to the PEM file pem. A last line of pem that
+# lacks a newline is ended first, so that the certificate does not run into
+# it, unless --no-newline-fix is given; an empty pem gets no leading newline.
+append_pem() {
+    local pem="$1"
+    local certs="$2"
+
+    if [ "$NEWLINE_FIX" = true ] && [ -s "$pem" ] && [ -n "$(tail -c 1 "$pem")" ]; then
+        echo >> "$pem"
+    fi
+    cat "$certs" >> "$pem"
+}
+
+# Append PEM certificates to a PEM trust store. A gzipped store is
+# decompressed, appended to and compressed again, and then replaces the
+# original in one rename.
+append_pem_store() {
+    local file="$1"
+    local certs="$2"
+    local temp_pem
+    temp_pem=$(mktemp)
+
+    if read_pem_store "$file" "$temp_pem" && append_pem "$temp_pem" "$certs" &&
+        write_pem_store "$file" "$temp_pem"; then
+        rm -f "$temp_pem"
+        return 0
+    fi
+    rm -f "$temp_pem"
+    return 1
+}
+
+# Replace the contents of a PEM trust store with the PEM file src, keeping the
+# store gzipped if it was, and keeping its line endings: CRLF if its first
+# line ends with CRLF, LF otherwise
+write_pem_store() {
+    local file="$1"
+    local src="$2"
+    local crlf=false
+    local work
+    if pem_uses_crlf "$file"; then
+        crlf=true
+    fi
+    work=$(begin_store_rewrite "$file" empty) || return 1
+
+    if is_gzip "$file"; then
+        with_line_endings "$src" "$crlf" | gzip -c > "$work"
+    else
+        with_line_endings "$src" "$crlf" > "$work"
+    fi && finish_store_rewrite "$file" "$work" && return 0
+    rm -f "$work"
+    return 1
+}
+
+# Report whether a trust store type is read and written with keytool
+is_keytool_type() {
+    case "$1" in
+        JKS|JCEKS|BKS) return 0 ;;
+    esac
+    return 1
+}
+
+# Print the keytool options that select a store's type, one per line. keytool
+# opens JKS stores by default, but JCEKS and BKS stores must be named, and BKS
+# also needs the BouncyCastle provider.
+keytool_store_options() {
+    case "$1" in
+        JCEKS)
+            printf '%s\n' -storetype JCEKS
+            ;;
+        BKS)
+            printf '%s\n' -storetype BKS -providerclass org.bouncycastle.jce.provider.BouncyCastleProvider \
+                -providerpath "$BC_PROVIDER_PATH"
+            ;;
+    esac
+}
+
+# Report whether a trust store is a JRE's cacerts or jssecacerts. Stores copied
+# out of containers and clusters keep the name as a suffix.
+is_system_store() {
+    case "$(basename "$1")" in
+        cacerts|jssecacerts|*_cacerts|*_jssecacerts)
+            return 0
+            ;;
+    esac
+    return 1
+}
+
+# Print the passwords to try for a store, one per line. A JRE's cacerts
+# almost always uses Java's default password, so it is tried first there.
+store_passwords() {
+    local file="$1"
+    local password
+
+    if is_system_store "$file"; then
+        echo "changeit"
+    fi
+    for password in "${COMMON_PASSWORDS[@]}"; do
+        if ! is_system_store "$file" || [ "$password" != "changeit" ]; then
+            echo "$password"
+        fi
+    done
+}
+
+# Check a certificate before it is added to any store. Leaf certificates get a
+# warning, and when approved CA patterns are configured, a certificate whose
+# subject and issuer both match none of them is refused unless --force is
+# given. Names are compared in RFC 2253 form, such as "CN=Corp Root CA,O=Corp".
+vet_certificate() {
+    local cert="$1"
+    local subject
+    local issuer
+    subject=$(openssl x509 -noout -subject -nameopt RFC2253 -in "$cert" 2>/dev/null) || {
+        log_error "Cannot read certificate $cert"
+        return 1
+    }
+    subject="${subject#subject=}"
+    issuer=$(openssl x509 -noout -issuer -nameopt RFC2253 -in "$cert" 2>/dev/null)
+    issuer="${issuer#issuer=}"
+
+    if ! [[ "$(openssl x509 -noout -ext basicConstraints -in "$cert" 2>/dev/null)" =~ CA:TRUE ]]; then
+        log_warning "$subject is not a CA certificate; trust stores normally hold only CA certificates"
+    fi
+
+    if [ ${#APPROVED_CA_PATTERNS[@]} -eq 0 ]; then
+        return 0
+    fi
+    for pattern in "${APPROVED_CA_PATTERNS[@]}"; do
+        if [[ "$subject" == $pattern || "$issuer" == $pattern ]]; then
+            log_debug "$subject is approved by pattern: $pattern"
+            return 0
+        fi
+    done
+
+    if [ "$FORCE" = true ]; then
+        log_warning "Adding $subject although neither it nor its issuer ($issuer) is an approved CA (--force)"
+        return 0
+    fi
+    log_error "Refusing to add $subject: neither it nor its issuer ($issuer) matches an approved CA pattern (use --force to add it anyway)"
+    return 1
+}
+
+# Handle a JKS trust store, or a JCEKS or BKS store when store_type says so
 handle_jks() {
     local file="$1"
+    local store_type="${2:-JKS}"
     local success=false
-    local alias="trust-store-scanner-$(date +%s)"
+    local accessed=false
+    local alias="${CERT_ALIAS:-$(certificate_alias "$TEST_CERT_PATH")}"
+    local store_options=()
+    mapfile -t store_options < <(keytool_store_options "$store_type")
+    local passwords=()
+    mapfile -t passwords < <(store_passwords "$file")
     
-    log_info "Processing JKS trust store: $file"
+    log_info "Processing $store_type trust store: $file"
     
     # Try each password
-    for password in "${COMMON_PASSWORDS[@]}"; do
+    for password in "${passwords[@]}"; do
         log_debug "Trying password: ${password:-<empty>}"
         
-        if keytool -list -keystore "$file" -storepass "$password" &>/dev/null; then
-            log_success "Successfully accessed JKS with password: ${password:-<empty>}"
+        if run_quiet keytool -list -keystore "$file" "${store_options[@]}" -storepass "$password"; then
+            log_success "Successfully accessed $store_type with password: ${password:-<empty>}"
+            accessed=true
             
             # Create backup
-            local backup_file=$(create_backup "$file")
+            create_backup "$file" > /dev/null
+            
+            # keytool writes in place, so the import and its check run on a
+            # copy that replaces the store only once verified
+            local work
+            if ! work=$(begin_store_rewrite "$file"); then
+                break
+            fi
             
             # Try to import the certificate
-            if keytool -importcert -noprompt -keystore "$file" -storepass "$password" -alias "$alias" -file "$TEST_CERT_PATH" &>/dev/null; then
+            if run_quiet keytool -importcert -noprompt -keystore "$work" "${store_options[@]}" -storepass "$password" -alias "$alias" -file "$TEST_CERT_PATH"; then
                 log_success "Successfully imported certificate to $file with alias $alias"
                 
                 # Verify the import
-                if keytool -list -keystore "$file" -storepass "$password" -alias "$alias" &>/dev/null; then
+                if ! run_quiet keytool -list -keystore "$work" "${store_options[@]}" -storepass "$password" -alias "$alias"; then
+                    log_error "Failed to verify certificate import to $file, leaving it unchanged: $LAST_TOOL_ERROR"
+                elif ! finish_store_rewrite "$file" "$work"; then
+                    log_error "Failed to replace $file with its updated copy"
+                else
                     log_success "Verified certificate import to $file"
                     success=true
+                    log_modified_store "$file"
                     
                     # Generate command to remove the test certificate if needed
                     echo "# To remove the test certificate:" >> "$LOG_FILE"
-                    echo "keytool -delete -keystore \"$file\" -storepass \"$password\" -alias \"$alias\"" >> "$LOG_FILE"
-                else
-                    log_error "Failed to verify certificate import to $file"
-                    # Restore from backup if available
-                    if [ -n "$backup_file" ]; then
-                        cp "$backup_file" "$file"
-                        log_info "Restored from backup: $backup_file"
-                    fi
+                    echo "keytool -delete -keystore \"$file\" ${store_options[*]} -storepass \"$password\" -alias \"$alias\"" >> "$LOG_FILE"
                 fi
             else
-                log_error "Failed to import certificate to $file"
+                log_error "Failed to import certificate to $file: $LAST_TOOL_ERROR"
             fi
+            rm -f "$work"
             
             break
         fi
     done
     
-    if [ "$success" = false ]; then
-        log_error "Could not access JKS file $file with any of the provided passwords"
+    if [ "$accessed" = false ]; then
+        log_error "Could not access $store_type file $file with any of the provided passwords: $LAST_TOOL_ERROR"
     fi
     
-    return $success
+    [ "$success" = true ]
+}
+
+# Extract the certificates of a PKCS12 file to PEM, retrying with the legacy
+# provider that OpenSSL 3 needs to read RC2-encrypted stores. On failure
+# LAST_TOOL_ERROR explains the first attempt, which names the real problem.
+pkcs12_to_pem() {
+    local file="$1"
+    local password="$2"
+    local out="$3"
+
+    run_quiet openssl pkcs12 -in "$file" -nokeys -passin "pass:$password" -out "$out" && return 0
+    local error="$LAST_TOOL_ERROR"
+    run_quiet openssl pkcs12 -legacy -in "$file" -nokeys -passin "pass:$password" -out "$out" && return 0
+    LAST_TOOL_ERROR="$error"
+    return 1
+}
+
+# Print the encryption of a PKCS12 file's certificates, such as
+# "PBES2, PBKDF2, AES-256-CBC" or "pbeWithSHA1And40BitRC2-CBC"
+pkcs12_encryption() {
+    local file="$1"
+    local password="$2"
+
+    openssl pkcs12 -in "$file" -info -noout -passin "pass:$password" 2>&1 |
+        sed -n 's/^PKCS7 Encrypted data: \(.*\), Iteration.*/\1/p' | head -n 1
+}
+
+# Print the openssl pkcs12 -export flags used to rewrite file. legacy stores
+# use SHA1 and 3DES, which Java 8 and OpenSSL 1.x can read; modern stores use
+# AES-256 and SHA-256, the OpenSSL 3 default. Under preserve the mode follows
+# the file's current encryption.
+pkcs12_export_flags() {
+    local file="$1"
+    local password="$2"
+    local mode="$PKCS12_COMPAT"
+
+    if [ "$mode" = "preserve" ]; then
+        case "$(pkcs12_encryption "$file" "$password")" in
+            "") mode="" ;;
+            PBES2*) mode="modern" ;;
+            *) mode="legacy" ;;
+        esac
+    fi
+
+    case "$mode" in
+        legacy) echo "-certpbe PBE-SHA1-3DES -keypbe PBE-SHA1-3DES -macalg sha1" ;;
+        modern) echo "-certpbe AES-256-CBC -keypbe AES-256-CBC -macalg sha256" ;;
+    esac
+}
+
+# Write the certificates of a trust store to out as PEM. The export, the
+# expiry check, the comparison and the dry-run diff all read the same store,
+# and the baseline is read for every store compared, so the PEM is cached for
+# the run and reused while the file is unchanged.
+store_to_pem() {
+    local file="$1"
+    local file_type="$2"
+    local out="$3"
+    local stamp
+    local cached
+    stamp="$file_type $(file_stamp "$file") $file"
+    cached=$(cache_path "$file")
+
+    if [ -f "$cached.pem" ] && [ "$(cat "$cached.stamp" 2>/dev/null)" = "$stamp" ]; then
+        cp "$cached.pem" "$out"
+        return
+    fi
+    convert_store_to_pem "$file" "$file_type" "$out" || return 1
+    cp "$out" "$cached.pem" && echo "$stamp" > "$cached.stamp"
+    rm -f "$cached.fingerprints"
+    return 0
+}
+
+# Print the SHA-256 fingerprint of every certificate in a trust store, one per
+# line, cached like store_to_pem
+store_fingerprints() {
+    local file="$1"
+    local file_type="$2"
+    local temp_pem
+    local cached
+    temp_pem=$(mktemp)
+    cached=$(cache_path "$file")
+
+    if store_to_pem "$file" "$file_type" "$temp_pem"; then
+        if [ ! -f "$cached.fingerprints" ]; then
+            bundle_fingerprints "$temp_pem" > "$cached.fingerprints"
+        fi
+        cat "$cached.fingerprints"
+    fi
+    rm -f "$temp_pem"
+}
+
+# Report whether a trust store already holds the certificate in cert
+store_has_certificate() {
+    local fingerprint
+    fingerprint=$(certificate_fingerprint "$3")
+    [ -n "$fingerprint" ] && store_fingerprints "$1" "$2" | grep -qxF "$fingerprint"
+}
+
+# Print the SHA-256 fingerprint of every certificate in a PEM bundle, in the
+# format of certificate_fingerprint. One openssl x509 per certificate takes
+# seconds on a bundle of a hundred or so, so each certificate is decoded to DER
+# with base64 and a single openssl dgst hashes them all.
+bundle_fingerprints() {
+    local pem="$1"
+    local dir
+    dir=$(mktemp -d)
+
+    awk -v dir="$dir" '
+        { sub(/\r$/, "") }
+        $0 == "-----BEGIN CERTIFICATE-----" { file = sprintf("%s/%06d", dir, ++n); in_cert = 1; next }
+        $0 == "-----END CERTIFICATE-----" { close(file); in_cert = 0; next }
+        in_cert { print > file }
+    ' "$pem"
+
+    local body
+    local ders=()
+    for body in "$dir"/*; do
+        if [ -f "$body" ] && base64 -d < "$body" > "$body.der" 2>/dev/null && [ -s "$body.der" ]; then
+            ders+=("$body.der")
+        fi
+    done
+    if [ ${#ders[@]} -gt 0 ]; then
+        openssl dgst -sha256 -r "${ders[@]}" |
+            awk '{ hex = toupper($1); fp = substr(hex, 1, 2); for (i = 3; i < length(hex); i += 2) fp = fp ":" substr(hex, i, 2); print fp }'
+    fi
+    rm -rf "$dir"
+}
+
+# Write the certificates of a trust store to out as PEM, trying each password.
+# keytool and openssl put each entry's alias ("Alias name:" or "friendlyName:")
+# before its certificate.
+convert_store_to_pem() {
+    local file="$1"
+    local file_type="$2"
+    local out="$3"
+
+    case "$file_type" in
+        "JKS"|"JCEKS"|"BKS")
+            local store_options=()
+            mapfile -t store_options < <(keytool_store_options "$file_type")
+            for password in "${COMMON_PASSWORDS[@]}"; do
+                if keytool -list -rfc -keystore "$file" "${store_options[@]}" -storepass "$password" > "$out" 2>/dev/null; then
+                    return 0
+                fi
+            done
+            ;;
+        "PKCS12")
+            for password in "${COMMON_PASSWORDS[@]}"; do
+                if pkcs12_to_pem "$file" "$password" "$out"; then
+                    return 0
+                fi
+            done
+            ;;
+        "PEM")
+            read_pem_store "$file" "$out"
+            return
+            ;;
+    esac
+    return 1
+}
+
+# Quote a CSV field, doubling any quotes inside it
+csv_field() {
+    printf '"%s"' "${1//\"/\"\"}"
+}
+
+# Print the CSV row of one PEM certificate in a trust store
+csv_row() {
+    local file="$1"
+    local file_type="$2"
+    local alias="$3"
+    local cert="$4"
+    local subject="" issuer="" serial="" sha256="" not_before="" not_after="" days=""
+    local line
+
+    while IFS= read -r line; do
+        case "$line" in
+            subject=*) subject="${line#subject=}" ;;
+            issuer=*) issuer="${line#issuer=}" ;;
+            serial=*) serial="${line#serial=}" ;;
+            *"Fingerprint="*) sha256="${line#*Fingerprint=}" ;;
+            notBefore=*) not_before="${line#notBefore=}" ;;
+            notAfter=*) not_after="${line#notAfter=}" ;;
+        esac
+    done < <(openssl x509 -noout -subject -issuer -serial -sha256 -fingerprint -startdate -enddate \
+        -nameopt RFC2253 -in "$cert" 2>/dev/null)
+
+    if [ -z "$sha256" ]; then
+        log_warning "Skipping unreadable certificate in $file for the CSV export"
+        return 0
+    fi
+    if [ -n "$not_after" ]; then
+        days=$((($(date_to_epoch "$not_after") - $(date +%s)) / 86400))
+    fi
+
+    local row=""
+    for field in "$file" "$file_type" "$alias" "$subject" "$issuer" "$serial" "$sha256" "$not_before" "$not_after" "$days"; do
+        row+="${row:+,}$(csv_field "$field")"
+    done
+    echo "$row"
+}
+
+# Run a command for every certificate in a PEM file, appending the entry's
+# alias and a file holding the certificate to its arguments. keytool and
+# openssl put each entry's alias ("Alias name:" or "friendlyName:") before
+# its certificate. Certificates are read one at a time, so large stores are
+# never held in memory.
+for_each_certificate() {
+    local pem="$1"
+    shift
+    local temp_cert
+    local alias=""
+    local in_cert=false
+    local line
+    temp_cert=$(mktemp)
+
+    while IFS= read -r line; do
+        line="${line%$'\r'}"
+        case "$line" in
+            "Alias name: "*) alias="${line#Alias name: }" ;;
+            *"friendlyName: "*) alias="${line#*friendlyName: }" ;;
+            "-----BEGIN CERTIFICATE-----") in_cert=true; : > "$temp_cert" ;;
+        esac
+        if [ "$in_cert" = true ]; then
+            echo "$line" >> "$temp_cert"
+        fi
+        if [ "$line" = "-----END CERTIFICATE-----" ]; then
+            in_cert=false
+            "$@" "$alias" "$temp_cert"
+            alias=""
+        fi
+    done < "$pem"
+
+    rm -f "$temp_cert"
+}
+
+# Warn about each certificate in a PEM bundle that has expired or expires
+# within EXPIRY_WARNING_DAYS. warn_if_expiring runs several openssl commands
+# per certificate, which takes seconds on a bundle of a hundred or so, so only
+# the certificates that expiring_certificates finds are passed to it.
+warn_if_bundle_expiring() {
+    local pem="$1"
+    local file="$2"
+    local expiring
+    local selected
+
+    if ! expiring=$(expiring_certificates "$pem"); then
+        for_each_certificate "$pem" warn_if_expiring "$file"
+        return
+    fi
+    if [ -z "$expiring" ]; then
+        return
+    fi
+
+    # Keep each selected certificate with the alias line before it
+    selected=$(mktemp)
+    awk -v expiring=" $(echo $expiring) " '
+        { line = $0; sub(/\r$/, "", line) }
+        line ~ /^Alias name: / || line ~ /friendlyName: / { alias = $0; next }
+        line == "-----BEGIN CERTIFICATE-----" {
+            keep = index(expiring, " " (++n) " ") > 0
+            if (keep && alias != "") print alias
+            alias = ""
+        }
+        keep { print }
+        line == "-----END CERTIFICATE-----" { keep = 0 }
+    ' "$pem" > "$selected"
+    for_each_certificate "$selected" warn_if_expiring "$file"
+    rm -f "$selected"
+}
+
+# Print the position in a PEM bundle of each certificate that expires within
+# EXPIRY_WARNING_DAYS, read from a single openssl pkcs7 listing. Fails if the
+# listing does not hold the bundle's certificates in the bundle's order.
+expiring_certificates() {
+    local pem="$1"
+    local limit=$(($(date +%s) + EXPIRY_WARNING_DAYS * 86400))
+    limit=$(date -u -d "@$limit" +%Y%m%d%H%M%S 2>/dev/null || date -u -r "$limit" +%Y%m%d%H%M%S) || return 1
+
+    openssl crl2pkcs7 -nocrl -certfile "$pem" 2>/dev/null | openssl pkcs7 -print_certs -text 2>/dev/null |
+        awk -v limit="$limit" '
+            BEGIN { split("Jan Feb Mar Apr May Jun Jul Aug Sep Oct Nov Dec", names, " "); for (i = 1; i <= 12; i++) month[names[i]] = sprintf("%02d", i) }
+            { sub(/\r$/, "") }
+            $0 == "-----BEGIN CERTIFICATE-----" { n[FILENAME]++; in_cert = 1; next }
+            $0 == "-----END CERTIFICATE-----" { in_cert = 0; next }
+            in_cert { body[FILENAME, n[FILENAME]] = body[FILENAME, n[FILENAME]] $0; next }
+            FILENAME != ARGV[1] && /Not After *:/ {
+                sub(/.*Not After *: */, "")
+                gsub(/:/, "", $3)
+                until[n[FILENAME] + 1] = $4 month[$1] sprintf("%02d", $2) $3
+            }
+            END {
+                if (n[ARGV[1]] == 0 || n[ARGV[1]] != n[ARGV[2]]) exit 1
+                for (i = 1; i <= n[ARGV[1]]; i++) {
+                    if (body[ARGV[1], i] != body[ARGV[2], i] || until[i] == "") exit 1
+                }
+                for (i = 1; i <= n[ARGV[1]]; i++) {
+                    if (until[i] <= limit) print i
+                }
+            }' "$pem" -
+}
+
+# Warn if a certificate in a store has expired or expires within
+# EXPIRY_WARNING_DAYS
+warn_if_expiring() {
+    local file="$1"
+    local alias="$2"
+    local cert="$3"
+    local subject
+    local not_after
+
+    subject=$(openssl x509 -noout -subject -nameopt RFC2253 -in "$cert" 2>/dev/null) || return 0
+    subject="${subject#subject=}${alias:+ (alias $alias)}"
+    not_after=$(openssl x509 -noout -enddate -in "$cert" | sed 's/^notAfter=//')
+
+    if ! openssl x509 -noout -checkend 0 -in "$cert" > /dev/null; then
+        log_warning "$file holds an expired certificate: $subject, expired $not_after"
+    elif ! openssl x509 -noout -checkend $((EXPIRY_WARNING_DAYS * 86400)) -in "$cert" > /dev/null; then
+        log_warning "$file holds a certificate that expires within $EXPIRY_WARNING_DAYS days: $subject, expires $not_after"
+    fi
+}
+
+# Check the expiry of every certificate a trust store already holds, so that
+# each scan is also a health check of the store
+check_store_expiry() {
+    local file="$1"
+    local file_type="$2"
+    local temp_pem
+    temp_pem=$(mktemp)
+
+    if store_to_pem "$file" "$file_type" "$temp_pem"; then
+        warn_if_bundle_expiring "$temp_pem" "$file"
+    else
+        log_debug "Could not read $file to check the expiry of its certificates"
+    fi
+
+    rm -f "$temp_pem"
+}
+
+# Append a CSV row for every certificate in a trust store to CSV_FILE, and
+# to DB_CERTS_FILE for --db
+write_csv_rows() {
+    local file="$1"
+    local file_type="$2"
+    local temp_pem
+    temp_pem=$(mktemp)
+    local rows
+    rows=$(mktemp)
+
+    if store_to_pem "$file" "$file_type" "$temp_pem"; then
+        for_each_certificate "$temp_pem" csv_row "$file" "$file_type" > "$rows"
+        if [ -n "$CSV_FILE" ]; then
+            cat "$rows" >> "$CSV_FILE"
+        fi
+        if [ -n "$DB_FILE" ]; then
+            cat "$rows" >> "$DB_CERTS_FILE"
+        fi
+    else
+        log_warning "Could not read $file for the CSV export"
+    fi
+
+    rm -f "$temp_pem" "$rows"
+}
+
+# Print the SHA-256 fingerprint of a PEM certificate
+certificate_fingerprint() {
+    openssl x509 -noout -sha256 -fingerprint -in "$1" 2>/dev/null | sed 's/.*=//'
+}
+
+# Print the alias to import a certificate under in a keytool store: its CN in
+# keytool-safe characters and the start of its SHA-256 fingerprint, such as
+# corp-root-ca-3f2a9c1b. It stays the same across runs, so the keytool -delete
+# command in the log does too, and no two certificates share it.
+certificate_alias() {
+    local cert="$1"
+    local name
+    local hash
+    name=$(openssl x509 -noout -subject -nameopt multiline,utf8,-esc_msb -in "$cert" 2>/dev/null |
+        sed -n 's/^ *commonName *= *//p' | head -n 1 |
+        LC_ALL=C tr '[:upper:]' '[:lower:]' | LC_ALL=C tr -cs 'a-z0-9._-' '-' | cut -c 1-48 | sed 's/^-*//; s/-*$//')
+    hash=$(certificate_fingerprint "$cert" | tr -d ':' | tr '[:upper:]' '[:lower:]' | cut -c 1-8)
+    echo "${name:-cert}-$hash"
+}
+
+# Print a certificate's SHA-256 fingerprint and its PEM re-encoded by openssl,
+# with "|" in place of newlines, on one line. An unreadable certificate
+# prints "!" instead.
+normalized_certificate_line() {
+    local fingerprint
+    fingerprint=$(certificate_fingerprint "$2")
+    if [ -z "$fingerprint" ]; then
+        echo "!"
+        return
+    fi
+    printf '%s\t%s\n' "$fingerprint" "$(openssl x509 -in "$2" -outform PEM | paste -sd '|' -)"
+}
+
+# Write the certificates in a PEM file to out as canonical PEM: each one is
+# re-encoded from its DER form, so line wrapping is uniform and text between
+# certificates is dropped, and they are sorted by SHA-256 fingerprint without
+# duplicates. Fails without writing out if a certificate cannot be parsed.
+normalize_pem() {
+    local pem="$1"
+    local out="$2"
+    local lines
+    lines=$(mktemp)
+
+    for_each_certificate "$pem" normalized_certificate_line > "$lines"
+    if grep -q '^!$' "$lines"; then
+        rm -f "$lines"
+        return 1
+    fi
+    sort -u -t $'\t' -k1,1 "$lines" | cut -f2 | tr '|' '\n' > "$out"
+    rm -f "$lines"
+}
+
+# Rewrite a PEM trust store as canonical PEM, keeping it gzipped if it was
+# and keeping its line endings. A store that also holds something other than certificates, such as a
+# private key, is left as it is.
+normalize_pem_store() {
+    local file="$1"
+    local temp_pem
+    local normalized
+    temp_pem=$(mktemp)
+    normalized=$(mktemp)
+
+    if ! read_pem_store "$file" "$temp_pem"; then
+        log_warning "Could not read $file to normalize it"
+    elif grep -- '-----BEGIN ' "$temp_pem" | grep -qv -- '-----BEGIN CERTIFICATE-----'; then
+        log_warning "Not normalizing $file: it holds PEM blocks other than certificates"
+    elif ! normalize_pem "$temp_pem" "$normalized"; then
+        log_warning "Not normalizing $file: it holds a certificate that cannot be parsed"
+    elif with_line_endings "$temp_pem" false | cmp -s - "$normalized"; then
+        log_debug "$file is already normalized"
+    elif write_pem_store "$file" "$normalized"; then
+        log_info "Normalized $file"
+    else
+        log_error "Failed to normalize $file"
+    fi
+
+    rm -f "$temp_pem" "$normalized"
+}
+
+# Print a certificate's subject and SHA-256 fingerprint on one line. The
+# alias argument of for_each_certificate is not shown.
+certificate_listing_line() {
+    openssl x509 -noout -subject -sha256 -fingerprint -nameopt RFC2253 -in "$2" 2>/dev/null |
+        awk '/^subject=/ { subject = substr($0, 9) } /Fingerprint=/ { sub(/.*Fingerprint=/, ""); print subject " (SHA256 " $0 ")" }'
+}
+
+# Print one line per certificate in a PEM bundle: its subject and SHA-256
+# fingerprint
+certificate_listing() {
+    for_each_certificate "$1" certificate_listing_line
+}
+
+# Show the change a real run would make to a store as a unified diff of its
+# certificate listing, before and after the certificates in removals are
+# removed and those in additions are added. The diff goes to stdout
+# unprefixed, so it can be piped to review tools.
+preview_store_diff() {
+    local file="$1"
+    local file_type="$2"
+    local additions="$3"
+    local removals="$4"
+
+    if ! command -v diff &> /dev/null; then
+        log_debug "diff not found, so the changes to $file are not shown"
+        return 0
+    fi
+
+    local temp_pem=$(mktemp)
+    local before=$(mktemp)
+    local after=$(mktemp)
+    if store_to_pem "$file" "$file_type" "$temp_pem"; then
+        certificate_listing "$temp_pem" > "$before"
+        {
+            certificate_listing "$removals" | awk 'NR == FNR { drop[$0]; next } !($0 in drop)' - "$before"
+            certificate_listing "$additions"
+        } > "$after"
+        diff -u --label "$file" --label "$file" "$before" "$after" | tee -a "$LOG_FILE" || true
+    else
+        log_noop "Cannot read $file to show its changes"
+    fi
+
+    rm -f "$temp_pem" "$before" "$after"
 }
 
 # Handle PKCS12 trust store
 handle_pkcs12() {
     local file="$1"
     local success=false
+    local accessed=false
     local temp_pem="/tmp/pkcs12_extract_$(date +%s).pem"
     
     log_info "Processing PKCS12 trust store: $file"
@@ -382,29 +2173,42 @@ handle_pkcs12() {
     for password in "${COMMON_PASSWORDS[@]}"; do
         log_debug "Trying password: ${password:-<empty>}"
         
-        if openssl pkcs12 -in "$file" -nokeys -passin "pass:$password" -out "$temp_pem" &>/dev/null; then
+        if pkcs12_to_pem "$file" "$password" "$temp_pem"; then
             log_success "Successfully accessed PKCS12 with password: ${password:-<empty>}"
+            accessed=true
             
             # Create backup
-            local backup_file=$(create_backup "$file")
+            create_backup "$file" > /dev/null
             
             # Extract certificates to PEM
-            openssl pkcs12 -in "$file" -nokeys -passin "pass:$password" -out "$temp_pem" &>/dev/null
+            pkcs12_to_pem "$file" "$password" "$temp_pem"
             
             # Append new certificate
             cat "$TEST_CERT_PATH" >> "$temp_pem"
             
-            # Convert back to PKCS12
-            if openssl pkcs12 -export -in "$temp_pem" -nokeys -passout "pass:$password" -out "$file" &>/dev/null; then
+            # Convert back to PKCS12 with the encryption chosen by --pkcs12-compat
+            local export_flags
+            local original_encryption
+            export_flags=$(pkcs12_export_flags "$file" "$password")
+            original_encryption=$(pkcs12_encryption "$file" "$password")
+            log_debug "PKCS12 export flags: ${export_flags:-<openssl defaults>}"
+            local work
+            if work=$(begin_store_rewrite "$file" empty) &&
+                run_quiet openssl pkcs12 -export -in "$temp_pem" -nokeys $export_flags -passout "pass:$password" -out "$work" &&
+                finish_store_rewrite "$file" "$work"; then
                 log_success "Successfully updated PKCS12 file $file"
                 success=true
-            else
-                log_error "Failed to update PKCS12 file $file"
-                # Restore from backup if available
-                if [ -n "$backup_file" ]; then
-                    cp "$backup_file" "$file"
-                    log_info "Restored from backup: $backup_file"
+                log_modified_store "$file"
+
+                # Clients that could read the old encryption may not read the new one
+                local new_encryption
+                new_encryption=$(pkcs12_encryption "$file" "$password")
+                if [ "$new_encryption" != "$original_encryption" ]; then
+                    log_warning "PKCS12 encryption of $file changed from ${original_encryption:-unknown} to ${new_encryption:-unknown}; clients that read the original store, such as Java 8, may not read it (see --pkcs12-compat)"
                 fi
+            else
+                rm -f "$work"
+                log_error "Failed to update PKCS12 file $file, leaving it unchanged: $LAST_TOOL_ERROR"
             fi
             
             # Clean up
@@ -413,11 +2217,11 @@ handle_pkcs12() {
         fi
     done
     
-    if [ "$success" = false ]; then
-        log_error "Could not access PKCS12 file $file with any of the provided passwords"
+    if [ "$accessed" = false ]; then
+        log_error "Could not access PKCS12 file $file with any of the provided passwords: $LAST_TOOL_ERROR"
     fi
     
-    return $success
+    [ "$success" = true ]
 }
 
 # Handle PEM trust store
@@ -433,115 +2237,254 @@ handle_pem() {
     fi
     
     # Create backup
-    local backup_file=$(create_backup "$file")
+    create_backup "$file" > /dev/null
     
-    # Append certificate
-    if cat "$TEST_CERT_PATH" >> "$file"; then
+    # Append certificate. The store is replaced in one rename, so a failed
+    # append leaves it unchanged.
+    if append_pem_store "$file" "$TEST_CERT_PATH"; then
         log_success "Successfully appended certificate to PEM file $file"
+        log_modified_store "$file"
         return 0
     else
-        log_error "Failed to append certificate to PEM file $file"
-        # Restore from backup if available
-        if [ -n "$backup_file" ]; then
-            cp "$backup_file" "$file"
-            log_info "Restored from backup: $backup_file"
-        fi
+        log_error "Failed to append certificate to PEM file $file, leaving it unchanged"
         return 1
     fi
 }
 
-# Extract trust store paths from configuration files
+# Resolve a path so that references and scanned files compare equal
+canonical_path() {
+    realpath -m "$1" 2>/dev/null || echo "$1"
+}
+
+# Remember that a configuration file references a trust store. References are
+# kept in a file because the config scan runs in subshells.
+record_store_reference() {
+    local path="$1"
+    local config="$2"
+
+    printf '%s\t%s\n' "$(canonical_path "$path")" "$config" >> "$STORE_REFERENCES_FILE"
+}
+
+# Print the configuration files that reference a trust store, one per line
+store_reference_files() {
+    local path
+    path=$(canonical_path "$1")
+
+    [ -f "$STORE_REFERENCES_FILE" ] || return 0
+    awk -F '\t' -v path="$path" '$1 == path { print $2 }' "$STORE_REFERENCES_FILE" | sort -u
+}
+
+# Print the configuration files that reference a trust store, comma-separated
+store_references() {
+    store_reference_files "$1" | paste -sd ',' - | sed 's/,/, /g'
+}
+
+# Report whether a trust store may be modified: any store when no --allow-path
+# is given, otherwise only stores under one of the allowed directories. Paths
+# are resolved first so that ".." and symlinks cannot escape the allowlist.
+write_allowed() {
+    local file
+    local allowed
+    file=$(canonical_path "$1")
+
+    if [ ${#ALLOWED_PATHS[@]} -eq 0 ]; then
+        return 0
+    fi
+    for allowed in "${ALLOWED_PATHS[@]}"; do
+        allowed=$(canonical_path "$allowed")
+        if [ "$file" = "$allowed" ] || [[ "$file" == "${allowed%/}/"* ]]; then
+            return 0
+        fi
+    done
+    return 1
+}
+
+# Log a modified trust store with the configuration files that reference it,
+# so the operator can see which applications a change affects
+log_modified_store() {
+    local file="$1"
+    local references
+    references=$(store_references "$file")
+
+    MODIFIED_STORES+=("$file${references:+, referenced by $references}")
+    MODIFIED_STORE_PATHS+=("$file")
+    log_info "Modified $file${references:+, referenced by $references}"
+}
+
+# List the files under dir that match the given find name tests, which may be
+# joined with -o. node_modules and .git directories are not entered, nor
+# directories deeper than --max-depth.
+find_files() {
+    local dir="$1"
+    shift
+    local depth=()
+    if [ -n "$MAX_DEPTH" ]; then
+        depth=(-maxdepth $((MAX_DEPTH + 1)))
+    fi
+
+    find "$dir" "${depth[@]}" \( -name node_modules -o -name .git \) -prune -o -type f \( "$@" \) -print 2>/dev/null
+}
+
+# Print the lines of a config file, each cut to MAX_CONFIG_LINE_LENGTH bytes.
+# Files over MAX_CONFIG_FILE_SIZE, such as logs that happen to end in .conf,
+# are skipped.
+config_lines() {
+    local file="$1"
+    local size
+    size=$(wc -c < "$file" 2>/dev/null) || return 0
+
+    if [ "$size" -gt "$MAX_CONFIG_FILE_SIZE" ]; then
+        log_debug "Skipping $file: larger than $((MAX_CONFIG_FILE_SIZE / 1024 / 1024)) MB" >&2
+        return 0
+    fi
+    cut -c "1-$MAX_CONFIG_LINE_LENGTH" "$file"
+}
+
+# Expand the environment variables in a trust store path: ${VAR}, $VAR and
+# the Windows form %VAR%. Only the environment is consulted, never this
+# script's own variables, and a variable that is not set is left as written.
+expand_path_variables() {
+    local path="$1"
+    local result=""
+    local pattern='^([^$%]*)(\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)|%([A-Za-z_][A-Za-z0-9_]*)%)(.*)$'
+    local name
+    local value
+
+    while [[ "$path" =~ $pattern ]]; do
+        result+="${BASH_REMATCH[1]}"
+        name="${BASH_REMATCH[3]}${BASH_REMATCH[4]}${BASH_REMATCH[5]}"
+        # Windows variable names are case-insensitive, so %JAVA_HOME% and
+        # %java_home% both find JAVA_HOME
+        if value=$(printenv "$name") || value=$(printenv "${name^^}"); then
+            result+="$value"
+        else
+            log_debug "$name is not set, so ${BASH_REMATCH[2]} is left in $1" >&2
+            result+="${BASH_REMATCH[2]}"
+        fi
+        path="${BASH_REMATCH[6]}"
+    done
+    echo "$result$path"
+}
+
+# Print the path that a trust store reference in a config file names, with
+# its environment variables expanded. A relative path is tried against each --ref-base, the config file's
+# directory, the scan root and the working directory, in that order, and the
+# first that exists wins. Java resolves trust store paths against the
+# working directory of the JVM, which is rarely the config file's directory.
+resolve_reference() {
+    local path="$1"
+    local config_file="$2"
+    local scan_root="$3"
+    local base
+    path=$(expand_path_variables "$path")
+
+    if [[ "$path" = /* ]]; then
+        echo "$path"
+        return 0
+    fi
+
+    for base in "${REF_BASES[@]}" "$(dirname "$config_file")" "$scan_root" "$PWD"; do
+        if [ -f "$base/$path" ]; then
+            log_debug "Resolved $path in $config_file against $base" >&2
+            echo "$base/$path"
+            return 0
+        fi
+    done
+
+    log_debug "Could not resolve $path in $config_file against ${REF_BASES[*]:+${REF_BASES[*]}, }the config directory, $scan_root or $PWD" >&2
+    echo "$(dirname "$config_file")/$path"
+}
+
+# Extract trust store paths from configuration files. stdout carries the
+# paths, so log to stderr.
 extract_config_paths() {
     local dir="$1"
     local found_paths=()
     
-    log_info "Extracting trust store paths from configuration files in $dir"
+    log_info "Extracting trust store paths from configuration files in $dir" >&2
     
     # Java properties files
     while IFS= read -r file; do
-        log_debug "Checking Java properties file: $file"
+        log_debug "Checking Java properties file: $file" >&2
         
         # Extract paths from properties files
+        local line_number=0
         while IFS= read -r line; do
+            line_number=$((line_number + 1))
             if [[ "$line" =~ (trustStore|trust-store|truststore).*=(.+) ]]; then
                 path=$(echo "${BASH_REMATCH[2]}" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-                # Handle relative paths
-                if [[ ! "$path" = /* ]]; then
-                    path="$(dirname "$file")/$path"
-                fi
-                log_debug "Found trust store path in config: $path"
-                found_paths+=("$path")
+                path=$(resolve_reference "$path" "$file" "$dir")
+                log_debug "Found trust store path in config: $path" >&2
+                record_store_reference "$path" "$file"
+                found_paths+=("$path"$'\t'"$file:$line_number")
             fi
-        done < "$file"
-    done < <(find "$dir" -type f -name "*.properties" -o -name "*.conf" -o -name "*.xml" -o -name "*.yaml" -o -name "*.yml" | grep -v "node_modules" | grep -v ".git")
+        done < <(config_lines "$file")
+    done < <(find_files "$dir" -name "*.properties" -o -name "*.conf" -o -name "*.xml" -o -name "*.yaml" -o -name "*.yml")
     
     # Environment files
     while IFS= read -r file; do
-        log_debug "Checking environment file: $file"
+        log_debug "Checking environment file: $file" >&2
         
         # Extract paths from .env files
+        local line_number=0
         while IFS= read -r line; do
+            line_number=$((line_number + 1))
             if [[ "$line" =~ (TRUSTSTORE|TRUST_STORE).*=(.+) ]]; then
                 path=$(echo "${BASH_REMATCH[2]}" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//')
-                # Handle relative paths
-                if [[ ! "$path" = /* ]]; then
-                    path="$(dirname "$file")/$path"
-                fi
-                log_debug "Found trust store path in env file: $path"
-                found_paths+=("$path")
+                path=$(resolve_reference "$path" "$file" "$dir")
+                log_debug "Found trust store path in env file: $path" >&2
+                record_store_reference "$path" "$file"
+                found_paths+=("$path"$'\t'"$file:$line_number")
             fi
-        done < "$file"
-    done < <(find "$dir" -type f -name ".env*" | grep -v "node_modules" | grep -v ".git")
+        done < <(config_lines "$file")
+    done < <(find_files "$dir" -name ".env*")
     
     # Node.js files
     while IFS= read -r file; do
-        log_debug "Checking Node.js file: $file"
+        log_debug "Checking Node.js file: $file" >&2
         
         # Extract paths from Node.js files
-        grep -o "NODE_EXTRA_CA_CERTS.*=.*" "$file" 2>/dev/null | while read -r line; do
+        local line_number=0
+        while IFS= read -r line; do
+            line_number=$((line_number + 1))
             if [[ "$line" =~ NODE_EXTRA_CA_CERTS.*=(.+) ]]; then
                 path=$(echo "${BASH_REMATCH[1]}" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//' | tr -d "'\"")
-                # Handle relative paths
-                if [[ ! "$path" = /* ]]; then
-                    path="$(dirname "$file")/$path"
-                fi
-                log_debug "Found trust store path in Node.js file: $path"
-                found_paths+=("$path")
+                path=$(resolve_reference "$path" "$file" "$dir")
+                log_debug "Found trust store path in Node.js file: $path" >&2
+                record_store_reference "$path" "$file"
+                found_paths+=("$path"$'\t'"$file:$line_number")
             fi
-        done
-    done < <(find "$dir" -type f -name "*.js" -o -name "*.json" | grep -v "node_modules" | grep -v ".git")
+        done < <(config_lines "$file")
+    done < <(find_files "$dir" -name "*.js" -o -name "*.json")
     
     # Web server config files
     while IFS= read -r file; do
-        log_debug "Checking web server config file: $file"
+        log_debug "Checking web server config file: $file" >&2
         
         # Extract paths from Nginx/Apache config files
-        grep -o "ssl_trusted_certificate.*;" "$file" 2>/dev/null | while read -r line; do
-            if [[ "$line" =~ ssl_trusted_certificate[[:space:]]+(.+)\; ]]; then
+        local line_number=0
+        while IFS= read -r line; do
+            line_number=$((line_number + 1))
+            if [[ "$line" =~ ssl_trusted_certificate[[:space:]]+([^;]+)\; ]]; then
                 path=$(echo "${BASH_REMATCH[1]}" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//' | tr -d "'\"")
-                # Handle relative paths
-                if [[ ! "$path" = /* ]]; then
-                    path="$(dirname "$file")/$path"
-                fi
-                log_debug "Found trust store path in web server config: $path"
-                found_paths+=("$path")
+                path=$(resolve_reference "$path" "$file" "$dir")
+                log_debug "Found trust store path in web server config: $path" >&2
+                record_store_reference "$path" "$file"
+                found_paths+=("$path"$'\t'"$file:$line_number")
             fi
-        done
-        
-        grep -o "SSLCACertificateFile.*" "$file" 2>/dev/null | while read -r line; do
+            
             if [[ "$line" =~ SSLCACertificateFile[[:space:]]+(.+) ]]; then
                 path=$(echo "${BASH_REMATCH[1]}" | sed 's/^[[:space:]]*//;s/[[:space:]]*$//' | tr -d "'\"")
-                # Handle relative paths
-                if [[ ! "$path" = /* ]]; then
-                    path="$(dirname "$file")/$path"
-                fi
-                log_debug "Found trust store path in web server config: $path"
-                found_paths+=("$path")
+                path=$(resolve_reference "$path" "$file" "$dir")
+                log_debug "Found trust store path in web server config: $path" >&2
+                record_store_reference "$path" "$file"
+                found_paths+=("$path"$'\t'"$file:$line_number")
             fi
-        done
-    done < <(find "$dir" -type f -name "*.conf" -o -name "httpd.conf" -o -name "apache2.conf" -o -name "nginx.conf" | grep -v "node_modules" | grep -v ".git")
+        done < <(config_lines "$file")
+    done < <(find_files "$dir" -name "*.conf")
     
-    # Return unique paths
+    # Return unique paths, each followed by a tab and the file:line that
+    # references it
     printf '%s\n' "${found_paths[@]}" | sort -u
 }
 
@@ -550,22 +2493,345 @@ scan_directory() {
     local dir="$1"
     local trust_stores=()
     
-    log_info "Scanning directory: $dir"
+    # stdout carries the list of stores, so log to stderr
+    log_info "Scanning directory: $dir" >&2
     
+    # Why each store was included, logged in verbose mode
+    local -A reasons=()
+
     # Find files by extension
     while IFS= read -r file; do
         trust_stores+=("$file")
-    done < <(find "$dir" -type f \( -name "*.jks" -o -name "*.keystore" -o -name "*.truststore" -o -name "*.p12" -o -name "*.pfx" -o -name "*.pem" -o -name "*.crt" -o -name "*.cer" -o -name "*.cert" \) 2>/dev/null | grep -v "node_modules" | grep -v ".git")
+        reasons["$file"]=$(name_match_reason "$file")
+        report_progress "Discovery" "${#trust_stores[@]}" "" "$file"
+    done < <(find_files "$dir" -name "*.jks" -o -name "*.keystore" -o -name "*.truststore" -o -name "*.p12" -o -name "*.pfx" -o -name "*.pem" -o -name "*.crt" -o -name "*.cer" -o -name "*.cert" -o -name "*.pem.gz" -o -name "*.crt.gz" -o -name cacerts -o -name jssecacerts)
+    
+    clear_progress
     
     # Extract paths from configuration files
-    while IFS= read -r path; do
+    local reference
+    while IFS=$'\t' read -r path reference; do
         if [ -f "$path" ]; then
             trust_stores+=("$path")
+            reasons["$path"]+="${reasons["$path"]:+, }referenced in $reference"
         fi
     done < <(extract_config_paths "$dir")
     
     # Return unique paths
-    printf '%s\n' "${trust_stores[@]}" | sort -u
+    while IFS= read -r path; do
+        if [ -z "$path" ]; then
+            continue
+        fi
+        log_debug "Included $path: ${reasons["$path"]}" >&2
+        echo "$path"
+    done < <(printf '%s\n' "${trust_stores[@]}" | sort -u)
+}
+
+# Print each PEM bundle embedded in a YAML file as a block scalar, such as the
+# ca.crt of a ConfigMap: the first and last lines of the block, its
+# indentation and its key, separated by \x1f
+yaml_embedded_bundles() {
+    awk '
+        function flush() {
+            if (key != "" && pem) {
+                printf "%d\x1f%d\x1f%d\x1f%s\n", first, last, indent, key
+            }
+            key = ""
+            pem = 0
+        }
+        {
+            line = $0
+            sub(/\r$/, "", line)
+            if (key != "") {
+                if (line ~ /^[ \t]*$/) {
+                    next
+                }
+                content = line
+                sub(/^ */, "", content)
+                if (length(line) - length(content) > key_indent) {
+                    if (indent < 0) {
+                        indent = length(line) - length(content)
+                    }
+                    if (content ~ /-----BEGIN CERTIFICATE-----/) {
+                        pem = 1
+                    }
+                    last = NR
+                    next
+                }
+                flush()
+            }
+            if (line ~ /^ *(- +)?[^ #:][^:#]*: *[|][-+]? *$/) {
+                key = line
+                sub(/^ */, "", key)
+                sub(/^- +/, "", key)
+                key_indent = length(line) - length(key)
+                sub(/: *[|][-+]? *$/, "", key)
+                gsub(/^["\x27]|["\x27]$/, "", key)
+                first = NR + 1
+                indent = -1
+            }
+        }
+        END {
+            flush()
+        }
+    ' "$1"
+}
+
+# Print ! for a certificate given by for_each_certificate that openssl cannot read
+print_unreadable_certificate() {
+    if ! openssl x509 -noout -in "$2" 2> /dev/null; then
+        echo '!'
+    fi
+}
+
+# Validate a PEM bundle embedded in a YAML or JSON file, warn about its
+# expiring certificates, and report whether this run appends the certificate
+# to it. Any other outcome is recorded here.
+embedded_bundle_needs_certificate() {
+    local file="$1"
+    local location="$2"
+    local pem="$3"
+    local status="unchanged"
+    local message=""
+
+    log_info "Processing PEM bundle embedded in $location"
+    LAST_COMPARE_MISSING=()
+    if [ -n "$(for_each_certificate "$pem" print_unreadable_certificate)" ]; then
+        message="$location holds a certificate that cannot be read, leaving it unchanged"
+        log_error "$message"
+        status="failed"
+    else
+        warn_if_bundle_expiring "$pem" "$location"
+        if [ -n "$ROOTS_DIR" ] || { [ "$COMPARE_MODE" = true ] && [ "$NOOP_WOULD_MODIFY" = false ]; }; then
+            log_debug "Not modifying $location: only trust stores are compared or synced"
+        elif store_has_certificate "$pem" "PEM" "$TEST_CERT_PATH"; then
+            log_info "$location already holds the certificate, leaving it unchanged"
+        elif ! write_allowed "$file"; then
+            log_warning "Refusing to modify $location: it is outside the allowed paths (${ALLOWED_PATHS[*]})"
+            status="skipped"
+        elif [ "$NOOP_MODE" = true ]; then
+            log_noop_action "append the certificate to" "$location"
+            NOOP_MODIFIED_STORES+=("$file")
+            status="noop"
+        else
+            return 0
+        fi
+    fi
+    record_store_result "$location" "$status" "$message" "PEM"
+    return 1
+}
+
+# Replace lines first to last of a YAML file with the lines of pem, indented
+# by indent spaces
+rewrite_yaml_block() {
+    local work="$1"
+    local first="$2"
+    local last="$3"
+    local indent="$4"
+    local pem="$5"
+    local out
+    out=$(mktemp)
+
+    {
+        head -n $((first - 1)) "$work"
+        sed "/./s/^/$(printf '%*s' "$indent" '')/" "$pem"
+        tail -n +$((last + 1)) "$work"
+    } > "$out" && cat "$out" > "$work"
+    local result=$?
+    rm -f "$out"
+    return $result
+}
+
+# Replace the JSON string at path, a jq path array, with the contents of pem.
+# The encoded string is replaced where it appears so that the rest of the file
+# keeps its layout; jq rewrites the file when it is escaped differently.
+rewrite_json_string() {
+    local work="$1"
+    local path="$2"
+    local pem="$3"
+    local old new content
+    old=$(jq -c --argjson p "$path" 'getpath($p)' "$work") || return 1
+    new=$(jq -Rs . < "$pem") || return 1
+    content=$(cat "$work"; echo x)
+    content="${content%x}"
+
+    if [[ "$content" == *"$old"* ]]; then
+        printf '%s' "${content/"$old"/"$new"}" > "$work"
+        return
+    fi
+    local out
+    out=$(mktemp)
+    jq --argjson p "$path" --rawfile v "$pem" 'setpath($p; $v)' "$work" > "$out" && cat "$out" > "$work"
+    local result=$?
+    rm -f "$out"
+    return $result
+}
+
+# Write pem over a bundle that process_embedded_bundles found in file, in its
+# copy work
+rewrite_embedded_bundle() {
+    local file="$1"
+    local work="$2"
+    local bundle="$3"
+    local pem="$4"
+    local first last indent key
+
+    if [[ "$file" == *.json ]]; then
+        rewrite_json_string "$work" "$bundle" "$pem"
+    else
+        IFS=$'\x1f' read -r first last indent key <<< "$bundle"
+        rewrite_yaml_block "$work" "$first" "$last" "$indent" "$pem"
+    fi
+}
+
+# Process the PEM bundles embedded in a YAML or JSON file, such as the ca.crt
+# of a Kubernetes ConfigMap. The certificate is appended to each bundle that
+# lacks it, and the file is backed up once and rewritten in one rename.
+process_embedded_bundles() {
+    local file="$1"
+    local bundles=()
+    local appended=()
+    local work=""
+    local -A started=()
+    local bundle pem location first last indent key
+
+    if [[ "$file" == *.json ]]; then
+        mapfile -t bundles < <(jq -c 'paths(strings) as $p | select(getpath($p) | contains("-----BEGIN CERTIFICATE-----")) | $p' "$file" 2>/dev/null)
+    else
+        # Bottom up, so that rewriting a block leaves the lines of those above it
+        mapfile -t bundles < <(yaml_embedded_bundles "$file" | sort -t $'\x1f' -k1,1nr)
+    fi
+
+    for bundle in "${bundles[@]}"; do
+        STORE_STARTED=$(span_clock)
+        pem=$(mktemp)
+        if [[ "$file" == *.json ]]; then
+            location="$file ($(jq -r 'map(tostring) | join(".")' <<< "$bundle"))"
+            jq -j --argjson p "$bundle" 'getpath($p)' "$file" > "$pem"
+        else
+            IFS=$'\x1f' read -r first last indent key <<< "$bundle"
+            location="$file ($key)"
+            sed -n "${first},${last}p" "$file" | sed "s/^ \{$indent\}//" > "$pem"
+        fi
+
+        if embedded_bundle_needs_certificate "$file" "$location" "$pem"; then
+            local crlf=false
+            if pem_uses_crlf "$pem"; then
+                crlf=true
+            fi
+            append_pem "$pem" "$TEST_CERT_PATH"
+            with_line_endings "$pem" "$crlf" > "$pem.eol" && mv "$pem.eol" "$pem"
+            if [ -z "$work" ] && ! work=$(begin_store_rewrite "$file"); then
+                work=""
+                log_error "Could not copy $file to append the certificate to $location"
+                record_store_result "$location" "failed" "$LAST_ERROR_MESSAGE" "PEM"
+            elif ! rewrite_embedded_bundle "$file" "$work" "$bundle" "$pem"; then
+                log_error "Failed to append the certificate to $location, leaving it unchanged"
+                record_store_result "$location" "failed" "$LAST_ERROR_MESSAGE" "PEM"
+            else
+                appended+=("$location")
+                started["$location"]="$STORE_STARTED"
+            fi
+        fi
+        rm -f "$pem"
+    done
+
+    if [ ${#appended[@]} -eq 0 ]; then
+        rm -f "$work"
+        return 0
+    fi
+    create_backup "$file" > /dev/null
+    if ! finish_store_rewrite "$file" "$work"; then
+        rm -f "$work"
+        for location in "${appended[@]}"; do
+            log_error "Failed to replace $file with its updated copy, leaving $location unchanged"
+            record_store_result "$location" "failed" "$LAST_ERROR_MESSAGE" "PEM"
+        done
+        return 1
+    fi
+    for location in "${appended[@]}"; do
+        log_success "Appended the certificate to the PEM bundle embedded in $location"
+        STORE_STARTED="${started["$location"]}"
+        record_store_result "$location" "success" "" "PEM"
+    done
+    log_modified_store "$file"
+}
+
+# Process the PEM bundles embedded in the YAML and JSON files under dir. They
+# are PEM stores as far as --only-type is concerned.
+scan_embedded_bundles() {
+    local dir="$1"
+    local file
+    if ! type_selected "PEM"; then
+        return 0
+    fi
+
+    while IFS= read -r file; do
+        if is_excluded "$file" || [ "$(wc -c < "$file")" -gt "$MAX_CONFIG_FILE_SIZE" ] ||
+            ! grep -q -- '-----BEGIN CERTIFICATE-----' "$file"; then
+            continue
+        fi
+        if [[ "$file" == *.json ]] && ! command -v jq &> /dev/null; then
+            log_warning "jq not found: skipping the PEM bundles embedded in $file"
+            continue
+        fi
+        process_embedded_bundles "$file" || true
+    done < <(find_files "$dir" -name "*.yaml" -o -name "*.yml" -o -name "*.json")
+}
+
+# Describe the name rule that made find_files pick up a file in scan_directory
+name_match_reason() {
+    local name="${1##*/}"
+
+    case "$name" in
+        cacerts|jssecacerts) echo "named $name" ;;
+        *.gz) name="${name%.gz}"; echo "extension .${name##*.}.gz" ;;
+        *) echo "extension .${name##*.}" ;;
+    esac
+}
+
+# List the files matching the --glob patterns. Relative patterns are matched
+# under the target directory, and globstar lets ** match any number of
+# directories.
+expand_globs() {
+    (
+        # The log path may be relative to the directory the script started in
+        LOG_FILE=$(canonical_path "$LOG_FILE")
+        cd "$TARGET_DIR" || exit 1
+        shopt -s globstar nullglob
+        # Expand each pattern without splitting it on spaces
+        IFS=
+        for pattern in "${GLOB_PATTERNS[@]}"; do
+            for file in $pattern; do
+                if [ ! -f "$file" ]; then
+                    continue
+                fi
+                if [[ "$file" != /* ]]; then
+                    file="$TARGET_DIR/$file"
+                fi
+                log_debug "Included $file: matches --glob $pattern" >&2
+                echo "$file"
+            done
+        done
+    ) | sort -u
+}
+
+# Report whether a file matches an --exclude pattern, checked against both its
+# full path and its path under the target directory
+is_excluded() {
+    local file="$1"
+    local relative="${file#"$TARGET_DIR"/}"
+
+    for pattern in "${EXCLUDE_PATTERNS[@]}"; do
+        if [[ "$file" == $pattern || "$relative" == $pattern ]]; then
+            return 0
+        fi
+        # A leading **/ also matches files directly in the target directory
+        if [[ "$pattern" == "**/"* && "$relative" == ${pattern#"**/"} ]]; then
+            return 0
+        fi
+    done
+    return 1
 }
 
 # Scan Kubernetes resources for trust stores
@@ -627,7 +2893,7 @@ scan_kubernetes() {
     
     # Process found trust stores
     for file in "${trust_stores[@]}"; do
-        process_trust_store "$file"
+        process_trust_store "$file" || true
     done
     
     # Clean up
@@ -674,7 +2940,16 @@ scan_docker() {
                     docker cp "$container_id:$file" "$temp_file"
                     
                     # Process the trust store
+                    local noop_modified=${#NOOP_MODIFIED_STORES[@]}
                     if process_trust_store "$temp_file"; then
+                        # A dry run copies nothing back and restarts nothing
+                        if [ "$NOOP_MODE" = true ]; then
+                            if [ "$RESTART_SERVICES" = true ] && [ ${#NOOP_MODIFIED_STORES[@]} -gt $noop_modified ]; then
+                                log_noop_action "restart container" "$container_id"
+                            fi
+                            continue
+                        fi
+                        
                         # Copy back to container if successful
                         docker cp "$temp_file" "$container_id:$file"
                         log_success "Updated trust store in container $container_id: $file"
@@ -694,84 +2969,1005 @@ scan_docker() {
     rm -rf "$temp_dir"
 }
 
-# Process a single trust store file
+# Report whether --only-type selects a trust store type. Every type is
+# selected when it is not given.
+type_selected() {
+    local type
+    if [ ${#ONLY_TYPES[@]} -eq 0 ]; then
+        return 0
+    fi
+    for type in "${ONLY_TYPES[@]}"; do
+        if [ "$type" = "$1" ]; then
+            return 0
+        fi
+    done
+    return 1
+}
+
+# Process a single trust store file and record its result for the summary:
+# success when it was modified, failed when an error was logged, skipped
+# when it was refused or not selected, noop when a dry run would modify it,
+# and unchanged otherwise
 process_trust_store() {
+    local file="$1"
+    local failures_before=$SUMMARY_FAILURE
+    local modified_before=${#MODIFIED_STORES[@]}
+    local noop_modified_before=${#NOOP_MODIFIED_STORES[@]}
+    local result=0
+    STORE_SKIPPED=false
+    LAST_COMPARE_MISSING=()
+    STORE_STARTED=$(span_clock)
+
+    remember_file_type "$file"
+    if ! type_selected "$(detect_file_type "$file")"; then
+        log_debug "Skipping $file: its type is not selected by --only-type"
+        record_store_result "$file" "skipped" ""
+        return 0
+    fi
+
+    if state_enabled && state_unchanged "$file"; then
+        log_info "Skipping $file: unchanged since a run left it compliant (--state-file)"
+        record_store_result "$file" "unchanged" ""
+        return 0
+    fi
+
+    update_trust_store "$file" || result=$?
+    if [ "$NORMALIZE" = true ] && [ ${#MODIFIED_STORES[@]} -gt $modified_before ] &&
+        [ "$(detect_file_type "$file")" = "PEM" ]; then
+        normalize_pem_store "$file"
+    fi
+
+    local status="unchanged"
+    local message=""
+    if [ ${#MODIFIED_STORES[@]} -gt $modified_before ]; then
+        status="success"
+    elif [ $SUMMARY_FAILURE -gt $failures_before ]; then
+        status="failed"
+        message="$LAST_ERROR_MESSAGE"
+    elif [ "$STORE_SKIPPED" = true ]; then
+        status="skipped"
+    elif [ ${#NOOP_MODIFIED_STORES[@]} -gt $noop_modified_before ]; then
+        status="noop"
+    fi
+    record_store_result "$file" "$status" "$message"
+    if state_enabled; then
+        if [ "$status" = "success" ] || [ "$status" = "unchanged" ]; then
+            record_state "$file"
+        else
+            record_state "$file" stale
+        fi
+    fi
+
+    return $result
+}
+
+# Report whether --state-file applies: to runs that modify the stores of a
+# directory, whose paths stay the same from one run to the next
+state_enabled() {
+    [ -n "$STATE_FILE" ] && [ "$COMPARE_MODE" = false ] &&
+        [ "$KUBERNETES_MODE" = false ] && [ "$DOCKER_MODE" = false ]
+}
+
+# Print a key for what a run makes the stores hold: the certificate to append,
+# the baseline, and the options that change which certificates are added. A
+# state recorded under another key is stale.
+desired_state_key() {
+    {
+        echo "roots=${ROOTS_DIR:+yes} prune=$PRUNE normalize=$NORMALIZE exclude=$EXCLUDE_EXPIRED,$EXCLUDE_NOT_YET_VALID"
+        if [ -z "$ROOTS_DIR" ]; then
+            certificate_fingerprint "$TEST_CERT_PATH"
+        fi
+        if has_baseline; then
+            store_fingerprints "$BASELINE_STORE" "$(detect_file_type "$BASELINE_STORE")" | sort
+        fi
+    } | cksum | cut -d ' ' -f 1
+}
+
+# Load the stores that --state-file recorded as compliant, unless it was
+# recorded for another certificate or baseline
+load_state() {
+    local path stamp fingerprints
+    STATE_KEY=$(desired_state_key)
+    if [ ! -f "$STATE_FILE" ]; then
+        return 0
+    fi
+    if [ "$(head -n 1 "$STATE_FILE")" != "# trust store state $STATE_KEY" ]; then
+        log_info "Ignoring $STATE_FILE: it was recorded for another certificate or baseline"
+        return 0
+    fi
+
+    while IFS=$'\x1f' read -r path stamp fingerprints; do
+        STATE_STAMPS["$path"]="$stamp"
+    done < <(tail -n +2 "$STATE_FILE")
+    log_info "Loaded the state of ${#STATE_STAMPS[@]} trust stores from $STATE_FILE"
+}
+
+# Report whether a store is unchanged, by inode, modification time and size,
+# since a run recorded it as compliant
+state_unchanged() {
+    local path
+    path=$(canonical_path "$1")
+    [ -n "${STATE_STAMPS["$path"]}" ] && [ "$(file_stamp "$1")" = "${STATE_STAMPS["$path"]}" ]
+}
+
+# Record the fingerprints that a store holds after this run, or with stale,
+# that this run did not leave it compliant
+record_state() {
+    local file="$1"
+    local path
+    path=$(canonical_path "$file")
+
+    if [ "$2" = "stale" ]; then
+        printf '%s\x1f\x1f\n' "$path" >> "$STATE_UPDATES_FILE"
+        return
+    fi
+    printf '%s\x1f%s\x1f%s\n' "$path" "$(file_stamp "$file")" \
+        "$(store_fingerprints "$file" "$(detect_file_type "$file")" | paste -sd , -)" >> "$STATE_UPDATES_FILE"
+}
+
+# Write --state-file: the stores recorded by this run, then those recorded
+# before that this run did not process. Stale stores are dropped.
+save_state() {
+    local out="$STATE_FILE.tmp"
+    touch "$STATE_UPDATES_FILE"
+    {
+        echo "# trust store state $STATE_KEY"
+        {
+            cat "$STATE_UPDATES_FILE"
+            if [ "$(head -n 1 "$STATE_FILE" 2>/dev/null)" = "# trust store state $STATE_KEY" ]; then
+                tail -n +2 "$STATE_FILE" | awk -F '\x1f' 'FILENAME == ARGV[1] { seen[$1]; next } !($1 in seen)' "$STATE_UPDATES_FILE" -
+            fi
+        } | awk -F '\x1f' '$2 != ""'
+    } > "$out" && mv -f "$out" "$STATE_FILE"
+    log_info "Saved the state of the trust stores to $STATE_FILE"
+}
+
+# Print the time in nanoseconds when --otel-endpoint needs it for a span
+span_clock() {
+    if [ -z "$OTEL_ENDPOINT" ]; then
+        return 0
+    fi
+    if [ -n "$EPOCHREALTIME" ]; then
+        echo "${EPOCHREALTIME/[.,]/}000"
+    else
+        date +%s%N
+    fi
+}
+
+# Append a store's result to STORE_RESULTS_FILE, which outlives the
+# subshells of the Docker scan. The certificates added, or that a dry run
+# would add, are the missing baseline certificates and the appended one.
+# The span of the store runs from STORE_STARTED until now.
+# Fields are separated by \x1f, which unlike a tab is not IFS whitespace,
+# so an empty message does not merge with its neighbours when read back.
+record_store_result() {
+    local file="$1"
+    local status="$2"
+    local message="$3"
+    local file_type="${4:-$(detect_file_type "$file")}"
+    local operation="compare"
+    local added=()
+
+    if [ -n "$ROOTS_DIR" ] && { [ "$COMPARE_MODE" = false ] || [ "$NOOP_WOULD_MODIFY" = true ]; }; then
+        operation="sync"
+    elif [ "$COMPARE_MODE" = false ] || [ "$NOOP_WOULD_MODIFY" = true ]; then
+        operation="append"
+    fi
+    if [ "$status" = "success" ] || [ "$status" = "noop" ]; then
+        if [ "$operation" != "compare" ]; then
+            added+=("${LAST_COMPARE_MISSING[@]}")
+        fi
+        if [ "$operation" = "append" ]; then
+            local subject
+            subject=$(openssl x509 -noout -subject -in "$TEST_CERT_PATH" 2>/dev/null) || true
+            added+=("${subject#subject=}")
+        fi
+    fi
+
+    printf '%s\x1f%s\x1f%s\x1f%s\x1f%s\x1f%s\x1f%s\x1f%s\x1f%s\n' "$file" "$file_type" "$operation" "$status" \
+        "$(date -u +%Y-%m-%dT%H:%M:%SZ)" "$message" "$(IFS=$'\x1e'; echo "${added[*]}")" \
+        "$STORE_STARTED" "$(span_clock)" >> "$STORE_RESULTS_FILE"
+}
+
+# Print how many stores STORE_RESULTS_FILE records with a status
+store_result_count() {
+    if [ ! -f "$STORE_RESULTS_FILE" ]; then
+        echo 0
+        return
+    fi
+    awk -F '\x1f' -v status="$1" '$4 == status { n++ } END { print n + 0 }' "$STORE_RESULTS_FILE"
+}
+
+# Print a string as a JSON string literal
+json_string() {
+    local value="$1"
+    value="${value//\\/\\\\}"
+    value="${value//\"/\\\"}"
+    value="${value//$'\n'/\\n}"
+    value="${value//$'\r'/\\r}"
+    value="${value//$'\t'/\\t}"
+    printf '"%s"' "$value"
+}
+
+# Print arguments as a JSON array of strings
+json_array() {
+    local items=()
+    local item
+    for item in "$@"; do
+        items+=("$(json_string "$item")")
+    done
+    printf '[%s]' "$(IFS=,; echo "${items[*]}")"
+}
+
+# Print the run as the AuditLog JSON that the Go manager and the enterprise
+# script send, with one modification per trust store
+audit_log_json() {
+    local modifications=()
+    local successful=0
+    local failed=0
+    local file file_type operation status timestamp message added
+    if [ -f "$STORE_RESULTS_FILE" ]; then
+        while IFS=$'\x1f' read -r file file_type operation status timestamp message added _; do
+            local added_list=()
+            if [ -n "$added" ]; then
+                IFS=$'\x1e' read -r -a added_list <<< "$added"
+            fi
+            case "$status" in
+                success) successful=$((successful + 1)) ;;
+                failed) failed=$((failed + 1)) ;;
+            esac
+            modifications+=("{\"file_path\":$(json_string "$file"),\"file_type\":$(json_string "$file_type"),\"operation\":$(json_string "$operation"),\"status\":$(json_string "$status"),\"timestamp\":$(json_string "$timestamp"),\"error_message\":$(json_string "$message"),\"certificates_added\":$(json_array "${added_list[@]}")}")
+        done < "$STORE_RESULTS_FILE"
+    fi
+
+    local git_dir="$TARGET_DIR"
+    local project="" branch="" commit="" repository="" dirty=false
+    if command -v git &> /dev/null && git -C "$git_dir" rev-parse --is-inside-work-tree &> /dev/null; then
+        project=$(basename "$(git -C "$git_dir" rev-parse --show-toplevel)")
+        branch=$(git -C "$git_dir" rev-parse --abbrev-ref HEAD 2>/dev/null) || true
+        commit=$(git -C "$git_dir" rev-parse HEAD 2>/dev/null) || true
+        repository=$(git -C "$git_dir" config --get remote.origin.url 2>/dev/null) || true
+        if [ -n "$(git -C "$git_dir" status --porcelain 2>/dev/null)" ]; then
+            dirty=true
+        fi
+    fi
+
+    local addresses=()
+    if command -v hostname &> /dev/null; then
+        read -r -a addresses <<< "$(hostname -I 2>/dev/null)" || true
+    fi
+    local machine_id=""
+    if [ -r /etc/machine-id ]; then
+        machine_id=$(cat /etc/machine-id)
+    fi
+
+    cat <<EOF
+{
+  "machine_ip": $(json_string "${addresses[0]}"),
+  "machine_id": $(json_string "$machine_id"),
+  "user": {"username": $(json_string "$(id -un)"), "user_id": $(json_string "$(id -u)"), "home_dir": $(json_string "$HOME")},
+  "git_project": {"project_name": $(json_string "$project"), "branch_name": $(json_string "$branch"), "commit_hash": $(json_string "$commit"), "repository_url": $(json_string "$repository"), "is_dirty": $dirty, "working_dir": $(json_string "$TARGET_DIR")},
+  "modifications": [$(IFS=,; echo "${modifications[*]}")],
+  "timestamp": $(json_string "$(date -u -d "@$RUN_START" +%Y-%m-%dT%H:%M:%SZ 2>/dev/null || date -u -r "$RUN_START" +%Y-%m-%dT%H:%M:%SZ)"),
+  "session_id": $(json_string "$SESSION_ID"),
+  "command": $(json_string "$0 ${COMMAND_ARGS[*]}"),
+  "system_info": {"hostname": $(json_string "$(uname -n)"), "os": $(json_string "$(uname -s | tr '[:upper:]' '[:lower:]')"), "arch": $(json_string "$(uname -m)"), "ip_addresses": $(json_array "${addresses[@]}")},
+  "duration": "$(($(date +%s) - RUN_START))s",
+  "summary": {"total_modifications": ${#modifications[@]}, "successful_modifications": $successful, "failed_modifications": $failed}
+}
+EOF
+}
+
+# POST the audit log of the run to --webhook
+send_webhook_summary() {
+    local payload
+    payload=$(audit_log_json)
+    echo "[AUDIT_LOG] $payload" >> "$LOG_FILE"
+
+    local headers=(-H "Content-Type: application/json")
+    if [ -n "$WEBHOOK_API_KEY" ]; then
+        headers+=(-H "Authorization: Bearer $WEBHOOK_API_KEY")
+    fi
+    if ! command -v curl &> /dev/null; then
+        log_warning "curl not found: the run summary was not sent to $WEBHOOK_URL"
+    elif run_quiet curl -sS --fail --max-time "$DOWNLOAD_TIMEOUT" -X POST "${headers[@]}" --data-binary @- "$WEBHOOK_URL" <<< "$payload"; then
+        log_info "Sent the run summary to $WEBHOOK_URL"
+    else
+        log_warning "Failed to send the run summary to $WEBHOOK_URL: $LAST_TOOL_ERROR"
+    fi
+}
+
+# Upload the audit log of the run to --audit-upload as PREFIX/HOST-TIME.json,
+# with the CLI of the object store. The CLI finds its credentials as usual,
+# such as from $AWS_PROFILE, $GOOGLE_APPLICATION_CREDENTIALS or
+# $AZURE_STORAGE_CONNECTION_STRING.
+upload_audit_log() {
+    local uri="${AUDIT_UPLOAD_URI%/}"
+    local started
+    started=$(date -u -d "@$RUN_START" +%Y%m%dT%H%M%SZ 2>/dev/null || date -u -r "$RUN_START" +%Y%m%dT%H%M%SZ)
+    local object="$uri/$(uname -n)-$started.json"
+    local payload
+    payload=$(mktemp)
+    audit_log_json > "$payload"
+
+    local command=()
+    case "$uri" in
+        s3://*)
+            command=(aws s3 cp --only-show-errors --content-type application/json "$payload" "$object")
+            ;;
+        gs://*)
+            command=(gcloud storage cp --content-type=application/json "$payload" "$object")
+            ;;
+        az://*)
+            local container="${uri#az://}"
+            container="${container%%/*}"
+            command=(az storage blob upload --only-show-errors --overwrite --container-name "$container"
+                --name "${object#az://$container/}" --file "$payload" --content-type application/json)
+            ;;
+    esac
+
+    if ! command -v "${command[0]}" &> /dev/null; then
+        log_warning "${command[0]} not found: the audit log was not uploaded to $object"
+    elif run_quiet "${command[@]}"; then
+        log_info "Uploaded the audit log to $object"
+    else
+        log_warning "Failed to upload the audit log to $object: $LAST_TOOL_ERROR"
+    fi
+    rm -f "$payload"
+}
+
+# Set HOST_SCAN_ARGS to the options of this run that each host's scan gets:
+# all but those of --hosts, the directory and log, and those that pick the
+# certificate, which was resolved here and is sent along instead
+host_scan_args() {
+    HOST_SCAN_ARGS=()
+    local i=0
+    while [ $i -lt ${#COMMAND_ARGS[@]} ]; do
+        case "${COMMAND_ARGS[$i]}" in
+            -d|--directory|-l|--log|-c|--certificate|--est-url|--est-user|--cert-from-endpoint|\
+            --cert-kind|--cn|--org|--san|--validity-days|--key-type|--key-size|--curve|\
+            --hosts|--host-concurrency|--host-timeout)
+                i=$((i + 2))
+                ;;
+            --yes|--noop|--dry-run)
+                i=$((i + 1))
+                ;;
+            *)
+                HOST_SCAN_ARGS+=("${COMMAND_ARGS[$i]}")
+                i=$((i + 1))
+                ;;
+        esac
+    done
+}
+
+# Run this script as a dry run on one SSH target. The script and the
+# certificate are copied to a temporary directory on the host, which is
+# removed when the scan ends. The host needs bash, openssl and a POSIX login
+# shell; SSH must log in without a prompt.
+scan_host() {
+    local target="$1"
+    local dir="$2"
+    local remote="d=\$(mktemp -d) && trap 'rm -rf \"\$d\"' EXIT && cat > \"\$d/scan.sh\""
+    local cert_arg=""
+    if [ -z "$ROOTS_DIR" ] && [ -n "$TEST_CERT_PATH" ]; then
+        remote+=" && printf '%s\\n' '$(with_line_endings "$TEST_CERT_PATH" false)' > \"\$d/cert.pem\""
+        cert_arg=" -c \"\$d/cert.pem\""
+    fi
+    remote+=" && bash \"\$d/scan.sh\"$(printf ' %q' --noop -d "$dir" -l /dev/null "${HOST_SCAN_ARGS[@]}")$cert_arg"
+
+    local command=(ssh -o BatchMode=yes -o ConnectTimeout=10 "$target" "$remote")
+    if command -v timeout &> /dev/null; then
+        command=(timeout "$HOST_TIMEOUT" "${command[@]}")
+    fi
+    "${command[@]}" < "${BASH_SOURCE[0]}"
+}
+
+# Scan every host of --hosts, HOST_CONCURRENCY at a time, without modifying
+# anything. Each host's output is appended to the log file, and its summary
+# is reported here. Fails when any host could not be scanned.
+scan_hosts() {
+    local hosts=()
+    local dirs=()
+    local line target dir
+    while IFS= read -r line || [ -n "$line" ]; do
+        line="${line%%#*}"
+        read -r target dir <<< "$line" || true
+        if [ -n "$target" ]; then
+            hosts+=("$target")
+            dirs+=("${dir:-$TARGET_DIR}")
+        fi
+    done < "$HOSTS_FILE"
+    if [ ${#hosts[@]} -eq 0 ]; then
+        log_error "No hosts in $HOSTS_FILE"
+        return 1
+    fi
+
+    host_scan_args
+    log_info "Scanning ${#hosts[@]} hosts from $HOSTS_FILE in dry-run mode, $HOST_CONCURRENCY at a time"
+    local results
+    results=$(mktemp -d)
+    local i
+    local running=0
+    for i in "${!hosts[@]}"; do
+        if [ $running -ge "$HOST_CONCURRENCY" ]; then
+            wait -n || true
+            running=$((running - 1))
+        fi
+        (
+            status=0
+            scan_host "${hosts[$i]}" "${dirs[$i]}" > "$results/$i.out" 2>&1 || status=$?
+            echo "$status" > "$results/$i.status"
+        ) &
+        running=$((running + 1))
+    done
+    wait
+
+    local failed=0
+    local status output scanned would store_failures
+    for i in "${!hosts[@]}"; do
+        status=$(cat "$results/$i.status" 2>/dev/null) || status=1
+        output=$(sed 's/\x1b\[[0-9;]*m//g' "$results/$i.out")
+        {
+            echo "======== ${hosts[$i]}:${dirs[$i]} ========"
+            echo "$output"
+        } >> "$LOG_FILE"
+        scanned=$(sed -n 's/^Trust stores scanned: //p' <<< "$output")
+        would=$(sed -n 's/^  Would be modified: //p' <<< "$output")
+        store_failures=$(sed -n 's/^  Failed: //p' <<< "$output")
+        if [ "$status" = 0 ] && [ -n "$scanned" ]; then
+            log_info "${hosts[$i]}: $scanned trust stores scanned, $would would be modified, $store_failures failed"
+        elif [ "$status" = 124 ]; then
+            log_error "${hosts[$i]}: timed out after ${HOST_TIMEOUT}s"
+            failed=$((failed + 1))
+        elif [ "$status" = 255 ]; then
+            log_error "${hosts[$i]}: unreachable: $(tail -n 1 <<< "$output")"
+            failed=$((failed + 1))
+        else
+            log_error "${hosts[$i]}: scan failed with status $status: $(tail -n 1 <<< "$output")"
+            failed=$((failed + 1))
+        fi
+    done
+    rm -rf "$results"
+
+    echo
+    echo "======== Host Scan Summary ========"
+    echo "Hosts scanned: $((${#hosts[@]} - failed))"
+    echo "Hosts failed: $failed"
+    echo "Log file: $LOG_FILE"
+    echo "==================================="
+    [ $failed -eq 0 ]
+}
+
+# Print a string as an SQL string literal
+sql_string() {
+    printf "'%s'" "${1//\'/\'\'}"
+}
+
+# Upsert the results of the run into the SQLite database of --db, keyed by
+# host, so that one database collects the runs of many hosts. A store keeps
+# the time it was first scanned and records when it was last scanned; its
+# certificates and findings record when they were first and last seen, so
+# those still in a store are the ones last seen when it was last scanned.
+# The findings are certificates that have expired or expire within
+# --expiry-warning-days, and stores that failed.
+write_results_db() {
+    if ! command -v sqlite3 &> /dev/null; then
+        log_warning "sqlite3 not found: the results were not written to $DB_FILE"
+        return
+    fi
+
+    local host
+    host=$(sql_string "$(uname -n)")
+    local scanned
+    scanned=$(sql_string "$(date -u -d "@$RUN_START" +%Y-%m-%dT%H:%M:%SZ 2>/dev/null || date -u -r "$RUN_START" +%Y-%m-%dT%H:%M:%SZ)")
+    touch "$DB_CERTS_FILE"
+    local sql
+    sql=$(mktemp)
+
+    {
+        cat <<EOF
+BEGIN;
+CREATE TABLE IF NOT EXISTS stores (
+    host TEXT NOT NULL,
+    path TEXT NOT NULL,
+    type TEXT,
+    operation TEXT,
+    status TEXT,
+    error_message TEXT,
+    first_scanned TEXT,
+    last_scanned TEXT,
+    session_id TEXT,
+    PRIMARY KEY (host, path)
+);
+CREATE TABLE IF NOT EXISTS certificates (
+    host TEXT NOT NULL,
+    store TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    alias TEXT,
+    subject TEXT,
+    issuer TEXT,
+    serial TEXT,
+    not_before TEXT,
+    not_after TEXT,
+    first_seen TEXT,
+    last_seen TEXT,
+    PRIMARY KEY (host, store, sha256)
+);
+CREATE TABLE IF NOT EXISTS findings (
+    host TEXT NOT NULL,
+    store TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    subject TEXT,
+    detail TEXT,
+    first_seen TEXT,
+    last_seen TEXT,
+    PRIMARY KEY (host, store, kind, sha256)
+);
+CREATE TEMP TABLE scan_certificates (store, type, alias, subject, issuer, serial, sha256, not_before, not_after, days_to_expiry);
+.import --csv $(sql_string "$DB_CERTS_FILE") scan_certificates
+EOF
+
+        local file file_type operation status timestamp message
+        if [ -f "$STORE_RESULTS_FILE" ]; then
+            while IFS=$'\x1f' read -r file file_type operation status timestamp message _; do
+                echo "INSERT INTO stores VALUES ($host, $(sql_string "$file"), $(sql_string "$file_type"),"\
+                    "$(sql_string "$operation"), $(sql_string "$status"), $(sql_string "$message"), $scanned, $scanned,"\
+                    "$(sql_string "$SESSION_ID")) ON CONFLICT (host, path) DO UPDATE SET type = excluded.type,"\
+                    "operation = excluded.operation, status = excluded.status, error_message = excluded.error_message,"\
+                    "last_scanned = excluded.last_scanned, session_id = excluded.session_id;"
+                if [ "$status" = "failed" ]; then
+                    echo "INSERT INTO findings VALUES ($host, $(sql_string "$file"), 'failed', '', '', $(sql_string "$message"),"\
+                        "$scanned, $scanned) ON CONFLICT (host, store, kind, sha256) DO UPDATE SET detail = excluded.detail,"\
+                        "last_seen = excluded.last_seen;"
+                fi
+            done < "$STORE_RESULTS_FILE"
+        fi
+
+        cat <<EOF
+INSERT INTO certificates
+    SELECT $host, store, sha256, alias, subject, issuer, serial, not_before, not_after, $scanned, $scanned
+    FROM scan_certificates WHERE true
+    ON CONFLICT (host, store, sha256) DO UPDATE SET alias = excluded.alias, subject = excluded.subject,
+        issuer = excluded.issuer, serial = excluded.serial, not_before = excluded.not_before,
+        not_after = excluded.not_after, last_seen = excluded.last_seen;
+INSERT INTO findings
+    SELECT $host, store, CASE WHEN CAST(days_to_expiry AS INTEGER) < 0 THEN 'expired' ELSE 'expiring' END,
+        sha256, subject, 'expires ' || not_after, $scanned, $scanned
+    FROM scan_certificates WHERE days_to_expiry != '' AND CAST(days_to_expiry AS INTEGER) < $EXPIRY_WARNING_DAYS
+    ON CONFLICT (host, store, kind, sha256) DO UPDATE SET subject = excluded.subject, detail = excluded.detail,
+        last_seen = excluded.last_seen;
+COMMIT;
+EOF
+    } > "$sql"
+
+    if run_quiet sqlite3 -bail "$DB_FILE" < "$sql"; then
+        log_info "Recorded the results in $DB_FILE"
+    else
+        log_warning "Failed to record the results in $DB_FILE: $LAST_TOOL_ERROR"
+    fi
+    rm -f "$sql"
+}
+
+# Print an OTLP attribute with a string value
+otel_attribute() {
+    printf '{"key":%s,"value":{"stringValue":%s}}' "$(json_string "$1")" "$(json_string "$2")"
+}
+
+# Print the run as an OTLP/JSON trace: a root span for the run, from the
+# start that its duration is measured from, and a child span per trust store
+otel_trace_json() {
+    local trace_id run_span_id end
+    trace_id=$(openssl rand -hex 16)
+    run_span_id=$(openssl rand -hex 8)
+    end=$(span_clock)
+
+    local spans=()
+    local file file_type operation status timestamp message added started ended
+    if [ -f "$STORE_RESULTS_FILE" ]; then
+        while IFS=$'\x1f' read -r file file_type operation status timestamp message added started ended; do
+            local code=1
+            if [ "$status" = "failed" ]; then
+                code=2
+            fi
+            spans+=("{\"traceId\":\"$trace_id\",\"spanId\":\"$(openssl rand -hex 8)\",\"parentSpanId\":\"$run_span_id\",\"name\":\"process trust store\",\"kind\":1,\"startTimeUnixNano\":\"${started:-$ended}\",\"endTimeUnixNano\":\"$ended\",\"attributes\":[$(otel_attribute file.path "$file"),$(otel_attribute trust_store.type "$file_type"),$(otel_attribute trust_store.operation "$operation"),$(otel_attribute trust_store.result "$status")],\"status\":{\"code\":$code,\"message\":$(json_string "$message")}}")
+        done < "$STORE_RESULTS_FILE"
+    fi
+    spans+=("{\"traceId\":\"$trace_id\",\"spanId\":\"$run_span_id\",\"name\":\"trust store scan\",\"kind\":1,\"startTimeUnixNano\":\"${RUN_START}000000000\",\"endTimeUnixNano\":\"$end\",\"attributes\":[$(otel_attribute command "$0 ${COMMAND_ARGS[*]}"),$(otel_attribute session.id "$SESSION_ID")],\"status\":{\"code\":$([ "$SUMMARY_FAILURE" -gt 0 ] && echo 2 || echo 1)}}")
+
+    cat <<EOF
+{"resourceSpans":[{"resource":{"attributes":[$(otel_attribute service.name trust-store-manager),$(otel_attribute host.name "$(uname -n)")]},"scopeSpans":[{"scope":{"name":"auto_trust_store_manager.sh"},"spans":[$(IFS=,; echo "${spans[*]}")]}]}]}
+EOF
+}
+
+# POST the trace of the run to the collector at --otel-endpoint
+send_otel_trace() {
+    local url="${OTEL_ENDPOINT%/}/v1/traces"
+    if ! command -v curl &> /dev/null; then
+        log_warning "curl not found: the trace was not sent to $url"
+    elif otel_trace_json | run_quiet curl -sS --fail --max-time "$DOWNLOAD_TIMEOUT" -X POST -H "Content-Type: application/json" --data-binary @- "$url"; then
+        log_info "Sent the trace of the run to $url"
+    else
+        log_warning "Failed to send the trace of the run to $url: $LAST_TOOL_ERROR"
+    fi
+}
+
+# Modify a single trust store, or compare it with the baseline
+update_trust_store() {
     local file="$1"
     local file_type=$(detect_file_type "$file")
-    local result=false
+    local result=0
+    
+    log_info "Processing trust store: $file (Type: $file_type)"
+    
+    if is_keytool_type "$file_type" && [ -z "$KEYTOOL_PATH" ]; then
+        log_error "Cannot process $file_type trust store $file: keytool not found (install a JRE or use --keytool-path)"
+        if has_baseline; then
+            NON_COMPLIANT_STORES+=("$file: could not be compared with the baseline (keytool not found)")
+        fi
+        return 0
+    fi
     
-    log_info "Processing trust store: $file (Type: $file_type)"
+    if [ "$file_type" = "BKS" ] && [ -z "$BC_PROVIDER_PATH" ]; then
+        log_error "Cannot process BKS trust store $file: keytool needs the BouncyCastle provider (use --bc-provider-path)"
+        if has_baseline; then
+            NON_COMPLIANT_STORES+=("$file: could not be compared with the baseline (no BouncyCastle provider)")
+        fi
+        return 0
+    fi
+    
+    # The export lists each store as found, before this run changes it
+    if { [ -n "$CSV_FILE" ] || [ -n "$DB_FILE" ]; } && [ "$file_type" != "UNKNOWN" ]; then
+        write_csv_rows "$file" "$file_type"
+    fi
+    if [ "$file_type" != "UNKNOWN" ]; then
+        check_store_expiry "$file" "$file_type"
+    fi
     
     # If in noop mode, just show what would be done
     if [ "$NOOP_MODE" = true ]; then
         log_noop_action "process trust store" "$file (Type: $file_type)"
+        local references=$(store_references "$file")
+        if [ -n "$references" ]; then
+            log_noop "$file is referenced by $references"
+        fi
+        if is_system_store "$file" && [ "$ALLOW_SYSTEM_STORE" = false ]; then
+            log_noop "$file is a JRE system trust store and would only be modified with --allow-system-store"
+        fi
+        
+        # The certificates a real run would add, in the order it adds them
+        local additions=""
+        local removals=""
+        if [ "$NOOP_WOULD_MODIFY" = true ] && [ "$file_type" != "UNKNOWN" ] && write_allowed "$file" &&
+            { ! is_system_store "$file" || [ "$ALLOW_SYSTEM_STORE" = true ]; }; then
+            additions=$(mktemp)
+            removals=$(mktemp)
+        fi
         
         # Still do comparison if baseline is provided
-        if [ -n "$BASELINE_URL" ]; then
-            compare_trust_stores "$file"
-            if [ $? -ne 0 ]; then
+        if has_baseline; then
+            if ! COMPARE_MISSING_PEM="$additions" COMPARE_EXTRA_PEM="$removals" compare_trust_stores "$file"; then
                 log_noop_skip "comparison failed" "$file"
+                if [ ${#LAST_COMPARE_MISSING[@]} -gt 0 ]; then
+                    NON_COMPLIANT_STORES+=("$file: missing ${#LAST_COMPARE_MISSING[@]} baseline certificates ($(IFS=';'; echo "${LAST_COMPARE_MISSING[*]}"))")
+                elif [ ${#LAST_COMPARE_EXTRA[@]} -gt 0 ]; then
+                    NON_COMPLIANT_STORES+=("$file: holds ${#LAST_COMPARE_EXTRA[@]} certificates that are not in the baseline ($(IFS=';'; echo "${LAST_COMPARE_EXTRA[*]}"))")
+                else
+                    NON_COMPLIANT_STORES+=("$file: could not be compared with the baseline")
+                fi
             fi
         fi
+        
+        if [ -n "$additions" ]; then
+            if [ -z "$ROOTS_DIR" ] && ! store_has_certificate "$file" "$file_type" "$TEST_CERT_PATH"; then
+                cat "$TEST_CERT_PATH" >> "$additions"
+            fi
+            if [ -s "$additions" ] || [ -s "$removals" ]; then
+                NOOP_MODIFIED_STORES+=("$file")
+            fi
+            preview_store_diff "$file" "$file_type" "$additions" "$removals"
+            rm -f "$additions" "$removals"
+        fi
         return 0
     fi
     
-    # If baseline store is provided, compare first
-    if [ -n "$BASELINE_URL" ]; then
-        compare_trust_stores "$file"
+    # Every Java application on the host trusts a JRE's cacerts, so it is only
+    # modified on request
+    if is_system_store "$file"; then
+        if [ "$ALLOW_SYSTEM_STORE" = false ]; then
+            log_warning "Refusing to modify $file: it is a JRE system trust store used by every Java application on this host (pass --allow-system-store to modify it)"
+            STORE_SKIPPED=true
+            if has_baseline; then
+                COMPARE_MODE=true compare_trust_stores "$file" || true
+            fi
+            return 0
+        fi
+        if [ ! -w "$file" ]; then
+            log_error "Cannot modify JRE system trust store $file: it is not writable by $(id -un) (it is usually owned by root)"
+            return 1
+        fi
+        log_warning "Modifying JRE system trust store $file: the change affects every Java application on this host"
+    fi
+    
+    # Stores outside the allowlist are reported but never modified
+    if ! write_allowed "$file"; then
+        log_warning "Refusing to modify $file: it is outside the allowed paths (${ALLOWED_PATHS[*]})"
+        STORE_SKIPPED=true
+        if has_baseline; then
+            COMPARE_MODE=true compare_trust_stores "$file" || true
+        fi
+        return 0
+    fi
+
+    # If baseline store is provided, compare first. --roots-dir runs only add
+    # the baseline certificates.
+    if has_baseline; then
+        compare_trust_stores "$file" || result=$?
         if [ "$COMPARE_MODE" = true ]; then
-            return $?
+            return $result
         fi
+        result=0
+        if [ -n "$ROOTS_DIR" ]; then
+            return 0
+        fi
+    fi
+    
+    # A store that already trusts the certificate is already compliant
+    if [ "$file_type" != "UNKNOWN" ] && store_has_certificate "$file" "$file_type" "$TEST_CERT_PATH"; then
+        log_info "$file already holds the certificate, leaving it unchanged"
+        return 0
     fi
     
-    # Continue with existing processing if not in compare-only mode
+    # Continue with existing processing if not in compare-only mode. A failed
+    # store is logged and counted, and must not end the run under set -e.
     case "$file_type" in
-        "JKS")
-            handle_jks "$file"
-            result=$?
+        "JKS"|"JCEKS"|"BKS")
+            handle_jks "$file" "$file_type" || result=$?
             ;;
         "PKCS12")
-            handle_pkcs12 "$file"
-            result=$?
+            handle_pkcs12 "$file" || result=$?
             ;;
         "PEM")
-            handle_pem "$file"
-            result=$?
+            handle_pem "$file" || result=$?
             ;;
         "UNKNOWN")
             log_warning "Unknown file type for $file, skipping"
+            STORE_SKIPPED=true
             ;;
     esac
     
     return $result
 }
 
-# Restart services if needed
-restart_affected_services() {
-    if [ "$RESTART_SERVICES" = true ]; then
-        log_info "Checking for services that need to be restarted"
-        
-        # Check for common services
-        for service in tomcat apache2 httpd nginx wildfly jboss; do
-            if systemctl is-active --quiet "$service"; then
-                log_info "Restarting service: $service"
-                systemctl restart "$service"
-                if [ $? -eq 0 ]; then
-                    log_success "Successfully restarted $service"
-                else
-                    log_error "Failed to restart $service"
-                fi
+# Take the lock that keeps two runs, such as overlapping cron jobs, from
+# modifying the stores of the same target at once. flock releases it when the
+# script exits. Without flock (macOS), the lock is a directory holding the
+# owner's PID, and a lock left by a run that was killed is taken over.
+acquire_run_lock() {
+    local target
+    if [ "$KUBERNETES_MODE" = true ]; then
+        target="kubernetes"
+    elif [ "$DOCKER_MODE" = true ]; then
+        target="docker"
+    else
+        target=$(canonical_path "$TARGET_DIR")
+    fi
+    local lock_file="${TMPDIR:-/tmp}/trust_store_manager_$(printf '%s' "$target" | cksum | cut -d ' ' -f 1).lock"
+    local busy="Another instance is modifying the trust stores of $target; try again later or pass --lock-timeout (lock: $lock_file)"
+
+    if command -v flock &> /dev/null; then
+        local lock_fd
+        if ! exec {lock_fd}>> "$lock_file"; then
+            log_error "Cannot open the lock file $lock_file"
+            exit 1
+        fi
+        if ! flock -w "$LOCK_TIMEOUT" "$lock_fd"; then
+            log_error "$busy"
+            exit 1
+        fi
+        return 0
+    fi
+
+    local waited=0
+    local owner
+    until mkdir "$lock_file.d" 2>/dev/null; do
+        owner=$(cat "$lock_file.d/pid" 2>/dev/null) || true
+        if [ -n "$owner" ] && ! ps -p "$owner" > /dev/null 2>&1; then
+            log_warning "Taking over the lock left by run $owner, which is no longer running"
+            rm -rf "$lock_file.d"
+            continue
+        fi
+        if [ $waited -ge "$LOCK_TIMEOUT" ]; then
+            log_error "$busy"
+            exit 1
+        fi
+        sleep 1
+        waited=$((waited + 1))
+    done
+    echo $$ > "$lock_file.d/pid"
+    RUN_LOCK_DIR="$lock_file.d"
+    trap 'rm -rf "$RUN_LOCK_DIR"' EXIT
+}
+
+# Print the known service that a file belongs to, judged by the directories
+# in its path, such as /etc/nginx/nginx.conf or /opt/tomcat9/conf/server.xml
+service_for_path() {
+    case "/$1" in
+        */nginx/*) echo "nginx" ;;
+        */apache2/*) echo "apache2" ;;
+        */httpd/*) echo "httpd" ;;
+        */tomcat*/*) echo "tomcat" ;;
+        */wildfly*/*) echo "wildfly" ;;
+        */jboss*/*) echo "jboss" ;;
+        */inetpub/*) echo "iis" ;;
+    esac
+}
+
+# Print the Windows service name, which may be a wildcard, of a known service.
+# Windows installers name services after their version, as in Tomcat9 or
+# Apache2.4, and IIS runs as the World Wide Web Publishing Service.
+windows_service_pattern() {
+    case "$1" in
+        tomcat) echo "Tomcat*" ;;
+        apache2|httpd) echo "Apache*" ;;
+        wildfly) echo "WildFly*" ;;
+        jboss) echo "JBoss*" ;;
+        iis) echo "W3SVC" ;;
+        *) echo "$1" ;;
+    esac
+}
+
+# Print the running units of a known service, one per line, as the platform's
+# service manager names them: a systemd unit on Linux, a launchd job label
+# such as homebrew.mxcl.nginx on macOS, or a service name on Windows (Git
+# Bash, MSYS2 or Cygwin)
+running_service_units() {
+    local service="$1"
+
+    case "$(uname -s)" in
+        Darwin)
+            local pattern="$service"
+            if [ "$service" = "apache2" ]; then
+                pattern="httpd"
             fi
-        done
+            # Jobs that are loaded but not running have "-" for a PID
+            launchctl list 2>/dev/null |
+                awk -v pattern="$pattern" 'NR > 1 && $1 != "-" && tolower($3) ~ pattern { print $3 }'
+            ;;
+        MINGW*|MSYS*|CYGWIN*)
+            powershell.exe -NoProfile -NonInteractive -Command \
+                "Get-Service -Name '$(windows_service_pattern "$service")' -ErrorAction SilentlyContinue | Where-Object Status -eq 'Running' | ForEach-Object Name" 2>/dev/null |
+                tr -d '\r'
+            ;;
+        *)
+            if systemctl is-active --quiet "$service" 2>/dev/null; then
+                echo "$service"
+            fi
+            ;;
+    esac
+}
+
+# Restart a unit printed by running_service_units. launchctl kickstart -k
+# restarts a job in place: in the system domain when run as root, otherwise
+# in the user's GUI domain, where Homebrew services run.
+restart_service_unit() {
+    local unit="$1"
+
+    case "$(uname -s)" in
+        Darwin)
+            local domain="gui/$(id -u)"
+            if [ "$(id -u)" -eq 0 ]; then
+                domain="system"
+            fi
+            run_quiet launchctl kickstart -k "$domain/$unit"
+            ;;
+        MINGW*|MSYS*|CYGWIN*)
+            run_quiet powershell.exe -NoProfile -NonInteractive -Command "Restart-Service -Name '$unit' -Force"
+            ;;
+        *)
+            run_quiet systemctl restart "$unit"
+            ;;
+    esac
+}
+
+# Print the services affected by the given stores, one per line: those whose
+# directories hold one of the stores or a configuration file that the config
+# scan found referencing one
+affected_services() {
+    local store
+    local config
+    for store in "$@"; do
+        service_for_path "$(canonical_path "$store")"
+        while IFS= read -r config; do
+            service_for_path "$config"
+        done < <(store_reference_files "$store")
+    done | sort -u
+}
+
+# Restart the services that use a modified trust store. When no modified
+# store can be matched to a service, every known service that is running
+# is restarted. A dry run only logs the services that it would restart, for
+# the stores that it would modify.
+restart_affected_services() {
+    local stores=("${MODIFIED_STORE_PATHS[@]}")
+    if [ "$NOOP_MODE" = true ]; then
+        stores=("${NOOP_MODIFIED_STORES[@]}")
     fi
+    if [ "$RESTART_SERVICES" != true ] || [ ${#stores[@]} -eq 0 ]; then
+        return 0
+    fi
+    log_info "Checking for services that need to be restarted"
+
+    local services=()
+    local service
+    while IFS= read -r service; do
+        services+=("$service")
+    done < <(affected_services "${stores[@]}")
+    if [ ${#services[@]} -eq 0 ]; then
+        log_warning "No service could be matched to the modified trust stores, restarting every running known service"
+        services=(tomcat apache2 httpd nginx wildfly jboss iis)
+    fi
+
+    # apache2 and httpd can name the same unit outside Linux
+    local -A restarted=()
+    local units
+    local unit
+    for service in "${services[@]}"; do
+        units=$(running_service_units "$service")
+        if [ -z "$units" ]; then
+            log_debug "Service $service is not running, not restarting it"
+            continue
+        fi
+        while IFS= read -r unit; do
+            if [ -n "${restarted[$unit]}" ]; then
+                continue
+            fi
+            restarted[$unit]=1
+            if [ "$NOOP_MODE" = true ]; then
+                log_noop_action "restart service" "$unit"
+                NOOP_RESTARTS+=("$unit")
+                continue
+            fi
+            log_info "Restarting service: $unit"
+            if restart_service_unit "$unit"; then
+                log_success "Successfully restarted $unit"
+            else
+                log_error "Failed to restart $unit: $LAST_TOOL_ERROR"
+            fi
+        done <<< "$units"
+    done
 }
 
 # Print summary
 print_summary() {
     echo
     echo "======== Trust Store Scan Summary ========"
+    local scanned=0
+    if [ -f "$STORE_RESULTS_FILE" ]; then
+        scanned=$(wc -l < "$STORE_RESULTS_FILE" | tr -d ' ')
+    fi
+    echo "Trust stores scanned: $scanned"
+    if [ "$NOOP_MODE" = true ]; then
+        echo "  Would be modified: $(store_result_count noop)"
+    else
+        echo "  Modified: $(store_result_count success)"
+    fi
+    echo "  Unchanged: $(store_result_count unchanged)"
+    echo "  Failed: $(store_result_count failed)"
+    echo "  Skipped: $(store_result_count skipped)"
     echo "Total successful operations: $SUMMARY_SUCCESS"
     echo "Total failed operations: $SUMMARY_FAILURE"
+    if [ ${#MODIFIED_STORES[@]} -gt 0 ]; then
+        echo "Modified trust stores:"
+        printf '  %s\n' "${MODIFIED_STORES[@]}"
+    fi
+    if [ ${#NOOP_RESTARTS[@]} -gt 0 ]; then
+        echo "Services that would be restarted:"
+        printf '  %s\n' "${NOOP_RESTARTS[@]}"
+    fi
+    if [ -n "$CSV_FILE" ]; then
+        echo "Certificate CSV: $CSV_FILE"
+    fi
     echo "Log file: $LOG_FILE"
     echo "=========================================="
 }
@@ -781,32 +3977,89 @@ main() {
     # Initialize log file
     echo "Trust Store Scan Log - $(date)" > "$LOG_FILE"
     echo "Command: $0 $*" >> "$LOG_FILE"
+    COMMAND_ARGS=("$@")
     echo "----------------------------------------" >> "$LOG_FILE"
     
     # Parse command line arguments
     parse_args "$@"
+
+    # A fleet scan only runs the scan on each host
+    if [ -n "$HOSTS_FILE" ]; then
+        scan_hosts || exit 1
+        exit 0
+    fi
     
     # Check dependencies
     check_dependencies
     
-    # If noop mode is enabled, force compare-only and disable restarts/backups
+    # Drift detection never modifies anything
+    if [ "$FAIL_ON_CHANGE" = true ]; then
+        NOOP_MODE=true
+    fi
+
+    # If noop mode is enabled, force compare-only and disable backups. Restarts
+    # are only logged.
     if [ "$NOOP_MODE" = true ]; then
         log_noop "Running in dry-run mode - no changes will be made"
+        # The same run without --noop would modify stores, so preview its changes
+        if [ "$COMPARE_MODE" = false ] && [ "$FAIL_ON_CHANGE" = false ]; then
+            NOOP_WOULD_MODIFY=true
+        fi
         COMPARE_MODE=true
-        RESTART_SERVICES=false
         BACKUP=false
     fi
     
+    if [ -n "$CSV_FILE" ]; then
+        echo "store,type,alias,subject,issuer,serial,sha256,not_before,not_after,days_to_expiry" > "$CSV_FILE"
+    fi
+
+    # Runs that modify stores hold the target's lock until they exit
+    if [ "$COMPARE_MODE" = false ]; then
+        acquire_run_lock
+    fi
+
+    # Vet the certificate to append before any store is touched. A dry run
+    # shows the refusal that a real run would stop on.
+    if [ -z "$ROOTS_DIR" ] && { [ "$COMPARE_MODE" = false ] || [ "$NOOP_MODE" = true ]; } &&
+        ! vet_certificate "$TEST_CERT_PATH"; then
+        exit 1
+    fi
+    
+    if state_enabled; then
+        load_state
+    fi
+    
     # Scan for trust stores
     if [ "$KUBERNETES_MODE" = true ]; then
         scan_kubernetes
     elif [ "$DOCKER_MODE" = true ]; then
         scan_docker
     else
-        # Scan directory for trust stores
-        while IFS= read -r file; do
-            process_trust_store "$file"
-        done < <(scan_directory "$TARGET_DIR")
+        # Scan directory for trust stores, or only the files matching --glob
+        local find_stores="scan_directory"
+        if [ ${#GLOB_PATTERNS[@]} -gt 0 ]; then
+            find_stores="expand_globs"
+        fi
+        local stores=()
+        mapfile -t stores < <($find_stores "$TARGET_DIR")
+        if [ "$PROGRESS" = true ]; then
+            log_info "Discovered ${#stores[@]} trust stores"
+        fi
+        local processed=0
+        for file in "${stores[@]}"; do
+            processed=$((processed + 1))
+            clear_progress
+            if is_excluded "$file"; then
+                log_debug "Excluded: $file"
+            else
+                process_trust_store "$file" || true
+            fi
+            report_progress "Processing" "$processed" "${#stores[@]}" "$file"
+        done
+        clear_progress
+        if [ ${#GLOB_PATTERNS[@]} -eq 0 ]; then
+            scan_embedded_bundles "$TARGET_DIR"
+        fi
     fi
     
     # Restart services if needed
@@ -814,6 +4067,33 @@ main() {
     
     # Print summary
     print_summary
+    if [ -n "$WEBHOOK_URL" ]; then
+        send_webhook_summary
+    fi
+    if [ -n "$AUDIT_UPLOAD_URI" ]; then
+        upload_audit_log
+    fi
+    if [ -n "$OTEL_ENDPOINT" ]; then
+        send_otel_trace
+    fi
+    if [ -n "$DB_FILE" ]; then
+        write_results_db
+    fi
+    rm -f "$STORE_REFERENCES_FILE" "$STORE_RESULTS_FILE" "$DB_CERTS_FILE"
+    if state_enabled; then
+        save_state
+    fi
+    rm -f "$STATE_UPDATES_FILE"
+    rm -rf "$STORE_CACHE_DIR"
+
+    if [ "$FAIL_ON_CHANGE" = true ]; then
+        if [ ${#NON_COMPLIANT_STORES[@]} -gt 0 ]; then
+            echo "Non-compliant trust stores (${#NON_COMPLIANT_STORES[@]}):"
+            printf '  %s\n' "${NON_COMPLIANT_STORES[@]}"
+            exit $EXIT_DRIFT
+        fi
+        echo "All trust stores match the baseline."
+    fi
 }
 
 # Add new functions after the check_dependencies function
@@ -822,16 +4102,39 @@ main() {
 download_baseline_store() {
     log_info "Downloading baseline trust store from $BASELINE_URL"
     
-    # Check if wget or curl is available
-    if command -v wget &> /dev/null; then
-        if wget -q "$BASELINE_URL" -O "$BASELINE_STORE"; then
+    # Both clients use the proxy variables of the environment unless --proxy
+    # overrides them
+    local wget_options=(-q --tries=1 --timeout="$DOWNLOAD_TIMEOUT")
+    local curl_options=(-sS --max-time "$DOWNLOAD_TIMEOUT")
+    if [ -n "$BASELINE_PROXY" ]; then
+        wget_options+=(-e use_proxy=yes -e "http_proxy=$BASELINE_PROXY" -e "https_proxy=$BASELINE_PROXY")
+        curl_options+=(--proxy "$BASELINE_PROXY")
+    fi
+
+    # Only curl checks a pinned key, on every connection including redirects,
+    # so a pin bypasses wget
+    if [ ${#BASELINE_PINS[@]} -gt 0 ]; then
+        if ! command -v curl &> /dev/null; then
+            log_error "--baseline-pin needs curl to check the baseline server's key"
+            return 1
+        fi
+        local pins=("${BASELINE_PINS[@]/#sha256:/sha256//}")
+        curl_options+=(--pinnedpubkey "$(IFS=';'; echo "${pins[*]}")")
+    fi
+
+    # Check if wget or curl is available. Both follow a limited number of
+    # redirects and fail on HTTP errors; curl also undoes Content-Encoding.
+    if command -v wget &> /dev/null && [ ${#BASELINE_PINS[@]} -eq 0 ]; then
+        if wget "${wget_options[@]}" --max-redirect="$BASELINE_MAX_REDIRECTS" "$BASELINE_URL" -O "$BASELINE_STORE"; then
             log_success "Successfully downloaded baseline trust store using wget"
-            return 0
+            check_baseline_store
+            return
         fi
     elif command -v curl &> /dev/null; then
-        if curl -s "$BASELINE_URL" -o "$BASELINE_STORE"; then
+        if curl "${curl_options[@]}" --fail -L --max-redirs "$BASELINE_MAX_REDIRECTS" --compressed "$BASELINE_URL" -o "$BASELINE_STORE"; then
             log_success "Successfully downloaded baseline trust store using curl"
-            return 0
+            check_baseline_store
+            return
         fi
     else
         log_error "Neither wget nor curl is available"
@@ -842,6 +4145,102 @@ download_baseline_store() {
     return 1
 }
 
+# Make sure the downloaded baseline holds certificates. A body that is still
+# gzipped is decompressed, and DER certificates and PKCS7 bundles are
+# converted to PEM. Anything else, such as the HTML of a login page, is
+# rejected before it can make every comparison fail.
+check_baseline_store() {
+    local converted="$BASELINE_STORE.converted"
+
+    if is_gzip "$BASELINE_STORE"; then
+        if ! gzip -dc "$BASELINE_STORE" > "$converted"; then
+            log_error "The baseline download from $BASELINE_URL is corrupt gzip data"
+            rm -f "$converted"
+            return 1
+        fi
+        mv "$converted" "$BASELINE_STORE"
+    fi
+
+    if [ "$(detect_file_type "$BASELINE_STORE")" != "UNKNOWN" ]; then
+        return 0
+    fi
+
+    if openssl x509 -inform DER -in "$BASELINE_STORE" -out "$converted" 2>/dev/null ||
+        openssl pkcs7 -inform DER -print_certs -in "$BASELINE_STORE" -out "$converted" 2>/dev/null ||
+        openssl pkcs7 -print_certs -in "$BASELINE_STORE" -out "$converted" 2>/dev/null; then
+        mv "$converted" "$BASELINE_STORE"
+        log_debug "Converted the baseline trust store to PEM"
+        return 0
+    fi
+    rm -f "$converted"
+
+    if awk 'tolower($0) ~ /<html|<!doctype/ { found = 1; exit } END { exit !found }' "$BASELINE_STORE" 2>/dev/null; then
+        log_error "The baseline URL returned an HTML page instead of certificates (a login or error page?): $BASELINE_URL"
+    else
+        log_error "The baseline download from $BASELINE_URL holds no certificates (expected PEM, DER, PKCS7, PKCS12 or JKS)"
+    fi
+    return 1
+}
+
+# Convert an openssl date such as "Jun  1 12:00:00 2030 GMT" to epoch seconds
+date_to_epoch() {
+    # GNU date, then BSD date
+    date -d "$1" +%s 2>/dev/null ||
+        date -j -f "%b %e %T %Y %Z" "$1" +%s 2>/dev/null || echo 0
+}
+
+# Print "expired" or "not yet valid" if a PEM certificate is outside its
+# validity window and the matching --exclude option is set
+excluded_validity() {
+    local cert="$1"
+    local not_before
+
+    if [ "$EXCLUDE_EXPIRED" = true ] && openssl x509 -noout -in "$cert" &>/dev/null &&
+        ! openssl x509 -checkend 0 -noout -in "$cert" &>/dev/null; then
+        echo "expired"
+        return
+    fi
+
+    if [ "$EXCLUDE_NOT_YET_VALID" = true ]; then
+        not_before=$(openssl x509 -startdate -noout -in "$cert" 2>/dev/null | cut -d= -f2)
+        if [ -n "$not_before" ]; then
+            not_before=$(date_to_epoch "$not_before")
+            if [ "$not_before" -gt "$(date +%s)" ]; then
+                echo "not yet valid"
+            fi
+        fi
+    fi
+}
+
+# Split a PEM file into one file per certificate in dir. The text before the
+# first certificate, such as the header of keytool -list -rfc, gets a piece
+# of its own, which is removed so it is not taken for a certificate.
+split_certificates() {
+    local pem="$1"
+    local dir="$2"
+    local piece
+
+    csplit -s -z -f "$dir/cert-" "$pem" '/-----BEGIN CERTIFICATE-----/' '{*}' 2>/dev/null || true
+    for piece in "$dir"/cert-*; do
+        if [ -f "$piece" ] && ! grep -q -- '-----BEGIN CERTIFICATE-----' "$piece"; then
+            rm -f "$piece"
+        fi
+    done
+}
+
+# Count the certificates that csplit wrote to a directory
+count_split_certs() {
+    local count=0
+    local cert
+
+    for cert in "$1"/cert-*; do
+        if [ -e "$cert" ]; then
+            count=$((count + 1))
+        fi
+    done
+    echo "$count"
+}
+
 # Compare trust stores
 compare_trust_stores() {
     local file="$1"
@@ -849,42 +4248,48 @@ compare_trust_stores() {
     local temp_baseline="/tmp/baseline_$(date +%s).pem"
     local temp_target="/tmp/target_$(date +%s).pem"
     local missing_certs=0
+    LAST_COMPARE_MISSING=()
+    local skipped_certs=0
     local temp_cert="/tmp/missing_cert_$(date +%s).pem"
-    local alias_prefix="added-cert-$(date +%s)"
-    local alias_counter=0
+    local pkcs12_additions="/tmp/pkcs12_additions_$(date +%s).pem"
+    local keytool_additions="/tmp/keytool_additions_$(date +%s).pem"
+    local backed_up=false
+    local pruned_certs=0
+    local kept_certs="/tmp/kept_certs_$(date +%s).pem"
+    local pkcs12_base="$temp_target"
+    local rewrite_pkcs12=false
+    local keytool_work=""
+    LAST_COMPARE_EXTRA=()
+    : > "$pkcs12_additions"
+    : > "$keytool_additions"
     
     log_info "Comparing trust store: $file with baseline"
     
-    # Convert baseline to PEM format if needed
-    case $(detect_file_type "$BASELINE_STORE") in
-        "JKS")
-            for password in "${COMMON_PASSWORDS[@]}"; do
-                if keytool -exportcert -keystore "$BASELINE_STORE" -storepass "$password" -rfc > "$temp_baseline" 2>/dev/null; then
-                    break
-                fi
-            done
-            ;;
-        "PKCS12")
-            for password in "${COMMON_PASSWORDS[@]}"; do
-                if openssl pkcs12 -in "$BASELINE_STORE" -nokeys -passin "pass:$password" -out "$temp_baseline" 2>/dev/null; then
-                    break
-                fi
-            done
-            ;;
-        "PEM")
-            cp "$BASELINE_STORE" "$temp_baseline"
+    local store_options=()
+    mapfile -t store_options < <(keytool_store_options "$file_type")
+    
+    # Convert baseline to PEM format if needed. keytool -list -rfc writes every
+    # entry, where -exportcert without -alias writes only "mykey".
+    local baseline_type=$(detect_file_type "$BASELINE_STORE")
+    case "$baseline_type" in
+        "JKS"|"JCEKS"|"BKS")
+            if [ -z "$KEYTOOL_PATH" ]; then
+                log_error "Cannot read $baseline_type baseline trust store: keytool not found"
+                return 1
+            fi
             ;;
-        *)
+        "UNKNOWN")
             log_error "Unknown baseline trust store format"
             return 1
             ;;
     esac
+    store_to_pem "$BASELINE_STORE" "$baseline_type" "$temp_baseline" || true
     
     # Convert target to PEM format for comparison
     case "$file_type" in
-        "JKS")
+        "JKS"|"JCEKS"|"BKS")
             for password in "${COMMON_PASSWORDS[@]}"; do
-                if keytool -exportcert -keystore "$file" -storepass "$password" -rfc > "$temp_target" 2>/dev/null; then
+                if keytool -list -rfc -keystore "$file" "${store_options[@]}" -storepass "$password" > "$temp_target" 2>/dev/null; then
                     export STORE_PASSWORD="$password"  # Save password for later use
                     break
                 fi
@@ -892,14 +4297,14 @@ compare_trust_stores() {
             ;;
         "PKCS12")
             for password in "${COMMON_PASSWORDS[@]}"; do
-                if openssl pkcs12 -in "$file" -nokeys -passin "pass:$password" -out "$temp_target" 2>/dev/null; then
+                if pkcs12_to_pem "$file" "$password" "$temp_target"; then
                     export STORE_PASSWORD="$password"  # Save password for later use
                     break
                 fi
             done
             ;;
         "PEM")
-            cp "$file" "$temp_target"
+            read_pem_store "$file" "$temp_target"
             ;;
         *)
             log_error "Unknown target trust store format"
@@ -911,96 +4316,260 @@ compare_trust_stores() {
     local baseline_dir=$(mktemp -d)
     local target_dir=$(mktemp -d)
     
-    # Split baseline certificates
-    csplit -z -f "$baseline_dir/cert-" "$temp_baseline" '/-----BEGIN CERTIFICATE-----/' '{*}' 2>/dev/null
-    
-    # Split target certificates
-    csplit -z -f "$target_dir/cert-" "$temp_target" '/-----BEGIN CERTIFICATE-----/' '{*}' 2>/dev/null
+    split_certificates "$temp_baseline" "$baseline_dir"
+    split_certificates "$temp_target" "$target_dir"
     
     # Compare certificates
-    local total_baseline=$(find "$baseline_dir" -type f | wc -l)
-    local total_target=$(find "$target_dir" -type f | wc -l)
+    local total_baseline=$(count_split_certs "$baseline_dir")
+    local total_target=$(count_split_certs "$target_dir")
     
     log_info "Baseline contains $total_baseline certificates"
     log_info "Target contains $total_target certificates"
+
+    # The target's fingerprints are read once, with one openssl run, rather
+    # than two openssl runs for every pair of certificates
+    local -A target_fingerprints=()
+    local target_fingerprint
+    while IFS= read -r target_fingerprint; do
+        target_fingerprints["$target_fingerprint"]=1
+    done < <(bundle_fingerprints "$temp_target")
     
-    # Check for missing certificates
-    for baseline_cert in "$baseline_dir"/cert-*; do
-        local found=false
+    # --prune removes the target certificates that are not in the baseline,
+    # before the missing ones are added
+    if [ "$PRUNE" = true ]; then
+        local -A baseline_fingerprints=()
+        local extra_fingerprints=()
+        : > "$kept_certs"
+        local baseline_fingerprint
+        while IFS= read -r baseline_fingerprint; do
+            baseline_fingerprints["$baseline_fingerprint"]=1
+        done < <(store_fingerprints "$BASELINE_STORE" "$baseline_type")
         for target_cert in "$target_dir"/cert-*; do
-            if openssl x509 -fingerprint -noout -in "$baseline_cert" 2>/dev/null | \
-               cmp -s - <(openssl x509 -fingerprint -noout -in "$target_cert" 2>/dev/null); then
-                found=true
-                break
+            if [ ! -f "$target_cert" ]; then
+                continue
+            fi
+            local fingerprint=$(certificate_fingerprint "$target_cert")
+            if [ -z "$fingerprint" ] || [ -n "${baseline_fingerprints["$fingerprint"]}" ]; then
+                cat "$target_cert" >> "$kept_certs"
+                continue
+            fi
+            pruned_certs=$((pruned_certs + 1))
+            extra_fingerprints+=("$fingerprint")
+            local subject=$(openssl x509 -noout -subject -in "$target_cert" 2>/dev/null)
+            log_warning "Certificate not in the baseline: $subject"
+            LAST_COMPARE_EXTRA+=("${subject#subject=}")
+            if [ -n "$COMPARE_EXTRA_PEM" ]; then
+                cat "$target_cert" >> "$COMPARE_EXTRA_PEM"
             fi
         done
+
+        # Pruning cannot be undone without a backup, so --no-backup is ignored
+        if [ $pruned_certs -gt 0 ] && [ "$COMPARE_MODE" = false ]; then
+            BACKUP=true create_backup "$file" > /dev/null
+            backed_up=true
+            log_info "Pruning $pruned_certs certificates from $file"
+            case "$file_type" in
+                "JKS"|"JCEKS"|"BKS")
+                    # keytool writes in place, so it works on a copy that
+                    # replaces the store at the end
+                    keytool_work=$(begin_store_rewrite "$file") &&
+                        for_each_certificate "$temp_target" prune_keytool_entry "$file"
+                    ;;
+                "PKCS12")
+                    pkcs12_base="$kept_certs"
+                    rewrite_pkcs12=true
+                    ;;
+                "PEM")
+                    if ! write_pem_store "$file" "$kept_certs"; then
+                        log_error "Failed to prune certificates from $file"
+                    fi
+                    ;;
+            esac
+        fi
+    fi
+    
+    # Check for missing certificates
+    for baseline_cert in "$baseline_dir"/cert-*; do
+        local found=false
+        local excluded=$(excluded_validity "$baseline_cert")
+        if [ -n "$excluded" ]; then
+            skipped_certs=$((skipped_certs + 1))
+            log_info "Skipped $excluded baseline certificate: $(openssl x509 -noout -subject -in "$baseline_cert" 2>/dev/null)"
+            continue
+        fi
+        local fingerprint=$(certificate_fingerprint "$baseline_cert")
+        if [ -n "$fingerprint" ] && [ -n "${target_fingerprints["$fingerprint"]}" ]; then
+            found=true
+        fi
         if [ "$found" = false ]; then
-            ((missing_certs++))
+            missing_certs=$((missing_certs + 1))
             local subject=$(openssl x509 -noout -subject -in "$baseline_cert" 2>/dev/null)
             log_warning "Missing certificate: $subject"
+            LAST_COMPARE_MISSING+=("${subject#subject=}")
             
-            if [ "$COMPARE_MODE" = false ]; then
+            # A dry run collects the certificates it would add for its diff
+            if [ -n "$COMPARE_MISSING_PEM" ] && vet_certificate "$baseline_cert"; then
+                cat "$baseline_cert" >> "$COMPARE_MISSING_PEM"
+            fi
+            
+            if [ "$COMPARE_MODE" = false ] && ! vet_certificate "$baseline_cert"; then
+                log_warning "Not adding baseline certificate $subject to $file"
+            elif [ "$COMPARE_MODE" = false ]; then
                 log_info "Adding missing certificate to $file"
+                if [ "$backed_up" = false ]; then
+                    create_backup "$file" > /dev/null
+                    backed_up=true
+                fi
                 
                 # Handle different store types differently
                 case "$file_type" in
-                    "JKS")
-                        # For JKS, we use keytool to import
-                        cp "$baseline_cert" "$temp_cert"
-                        keytool -importcert -noprompt -keystore "$file" \
-                            -storepass "$STORE_PASSWORD" \
-                            -alias "${alias_prefix}-${alias_counter}" \
-                            -file "$temp_cert"
+                    "JKS"|"JCEKS"|"BKS")
+                        # keytool stores are imported into once, with every
+                        # addition
+                        cat "$baseline_cert" >> "$keytool_additions"
                         ;;
                     "PKCS12")
-                        # For PKCS12, we convert and merge
-                        cp "$baseline_cert" "$temp_cert"
-                        local temp_pkcs12="/tmp/temp_pkcs12_$(date +%s).p12"
-                        openssl pkcs12 -export -in "$temp_cert" -nokeys \
-                            -passout "pass:$STORE_PASSWORD" \
-                            -out "$temp_pkcs12"
-                        if openssl pkcs12 -in "$file" -nokeys -passin "pass:$STORE_PASSWORD" \
-                            -passout "pass:$STORE_PASSWORD" -out "$file.tmp" &>/dev/null; then
-                            cat "$temp_pkcs12" >> "$file.tmp"
-                            mv "$file.tmp" "$file"
-                            log_success "Successfully added certificate to PKCS12"
-                        fi
-                        rm -f "$temp_pkcs12"
+                        # PKCS12 stores are rewritten once, with every addition
+                        cat "$baseline_cert" >> "$pkcs12_additions"
                         ;;
                     "PEM")
                         # For PEM, simple append
-                        cat "$baseline_cert" >> "$file"
+                        append_pem_store "$file" "$baseline_cert"
                         ;;
                 esac
             fi
         fi
     done
     
+    # keytool imports into the copy of the store that replaces it at the end
+    if [ -s "$keytool_additions" ] && { [ -n "$keytool_work" ] || keytool_work=$(begin_store_rewrite "$file"); }; then
+        import_keytool_certificates "$file" "$keytool_additions"
+    fi
+
+    if [ -s "$pkcs12_additions" ] || [ "$rewrite_pkcs12" = true ]; then
+        local export_flags
+        export_flags=$(pkcs12_export_flags "$file" "$STORE_PASSWORD")
+        cat "$pkcs12_base" "$pkcs12_additions" > "$temp_cert"
+        local work
+        if work=$(begin_store_rewrite "$file" empty) &&
+            run_quiet openssl pkcs12 -export -in "$temp_cert" -nokeys $export_flags \
+            -passout "pass:$STORE_PASSWORD" -out "$work" && finish_store_rewrite "$file" "$work"; then
+            log_success "Successfully updated PKCS12 store $file"
+        else
+            rm -f "$work"
+            log_error "Failed to update PKCS12 store $file: $LAST_TOOL_ERROR"
+        fi
+    fi
+    
+    if [ -n "$keytool_work" ] && ! finish_store_rewrite "$file" "$keytool_work"; then
+        rm -f "$keytool_work"
+        log_error "Failed to replace $file with its updated copy"
+    fi
+    
     # Clean up
-    rm -f "$temp_baseline" "$temp_target" "$temp_cert"
+    rm -f "$temp_baseline" "$temp_target" "$temp_cert" "$pkcs12_additions" "$keytool_additions" "$kept_certs"
     rm -rf "$baseline_dir" "$target_dir"
     unset STORE_PASSWORD
     
-    if [ $missing_certs -eq 0 ]; then
-        log_success "Trust store $file contains all baseline certificates"
-        return 0
-    else
+    if [ $((missing_certs + pruned_certs)) -gt 0 ] && [ "$COMPARE_MODE" = false ]; then
+        log_modified_store "$file"
+    fi
+
+    if [ "$PRUNE" = true ] && [ "$COMPARE_MODE" = true ]; then
+        log_info "$file: $missing_certs certificates to add, $pruned_certs to prune"
+    elif [ "$PRUNE" = true ]; then
+        log_info "$file: added $missing_certs certificates, pruned $pruned_certs"
+    fi
+
+    if [ $skipped_certs -gt 0 ]; then
+        log_info "Skipped $skipped_certs baseline certificates outside their validity window"
+    fi
+
+    if [ $missing_certs -gt 0 ]; then
         log_warning "Trust store $file is missing $missing_certs certificates"
         return 1
+    elif [ $pruned_certs -gt 0 ]; then
+        log_warning "Trust store $file holds $pruned_certs certificates that are not in the baseline"
+        return 1
     fi
+    log_success "Trust store $file contains all baseline certificates"
+    return 0
 }
 
-# Find keytool from JRE installations
-    # If no keytool found, try to help user install Java
-    log_error "Could not find keytool utility"
-    log_info "Please install Java Runtime Environment (JRE) or Java Development Kit (JDK)"
-    log_info "You can install Java using one of these methods:"
-    log_info "- macOS: brew install openjdk"
-    log_info "- Ubuntu/Debian: sudo apt-get install default-jre"
-    log_info "- CentOS/RHEL: sudo yum install java-11-openjdk"
-    log_info "- Manual download: https://adoptium.net/temurin/releases/"
-    
-    return 1
+# Import the certificates of the PEM file certs into keytool_work, the copy
+# of file that compare_trust_stores writes to. keytool imports one trusted
+# certificate per run, and the JVM that each run starts dominates the sync of
+# a bundle. When openssl can mark certificates as trusted for Java, with
+# -jdktrust from OpenSSL 3.2, they go into a temporary PKCS12 store that a
+# single keytool -importkeystore copies in; otherwise, or when that fails,
+# they are imported one at a time.
+import_keytool_certificates() {
+    local file="$1"
+    local certs="$2"
+    local dir
+    dir=$(mktemp -d)
+    split_certificates "$certs" "$dir"
+
+    local cert
+    local count=0
+    local names=()
+    for cert in "$dir"/cert-*; do
+        if [ -f "$cert" ]; then
+            count=$((count + 1))
+            names+=(-caname "$(certificate_alias "$cert")")
+        fi
+    done
+
+    if [ $count -gt 1 ] && openssl pkcs12 -help 2>&1 | grep -q -- -jdktrust; then
+        # -importkeystore names the type of the store it writes -deststoretype
+        local dest_options=()
+        local option
+        for option in "${store_options[@]}"; do
+            if [ "$option" = "-storetype" ]; then
+                option="-deststoretype"
+            fi
+            dest_options+=("$option")
+        done
+        # SHA1 and 3DES, which the keytool of any Java release reads
+        if run_quiet openssl pkcs12 -export -nokeys -in "$certs" -jdktrust anyExtendedKeyUsage "${names[@]}" \
+            -certpbe PBE-SHA1-3DES -macalg sha1 -passout "pass:$STORE_PASSWORD" -out "$dir/additions.p12" &&
+            run_quiet keytool -importkeystore -noprompt -srckeystore "$dir/additions.p12" -srcstoretype PKCS12 \
+            -srcstorepass "$STORE_PASSWORD" -destkeystore "$keytool_work" "${dest_options[@]}" \
+            -deststorepass "$STORE_PASSWORD"; then
+            log_info "Imported $count certificates into $file with one keytool run"
+            rm -rf "$dir"
+            return 0
+        fi
+        log_debug "Importing into $file one certificate at a time: $LAST_TOOL_ERROR"
+    fi
+
+    for cert in "$dir"/cert-*; do
+        if [ -f "$cert" ] && ! run_quiet keytool -importcert -noprompt -keystore "$keytool_work" "${store_options[@]}" \
+            -storepass "$STORE_PASSWORD" -alias "$(certificate_alias "$cert")" -file "$cert"; then
+            log_error "Failed to add certificate to $file: $LAST_TOOL_ERROR"
+        fi
+    done
+    rm -rf "$dir"
+}
+
+# Delete a keytool store entry whose certificate is one of the
+# extra_fingerprints that compare_trust_stores is pruning, from its
+# keytool_work copy of the store
+prune_keytool_entry() {
+    local file="$1"
+    local alias="$2"
+    local cert="$3"
+    local fingerprint=$(certificate_fingerprint "$cert")
+
+    if [[ " ${extra_fingerprints[*]} " != *" $fingerprint "* ]]; then
+        return 0
+    fi
+    if run_quiet keytool -delete -noprompt -keystore "$keytool_work" "${store_options[@]}" \
+        -storepass "$STORE_PASSWORD" -alias "$alias"; then
+        log_info "Pruned $alias from $file"
+    else
+        log_error "Failed to prune $alias from $file: $LAST_TOOL_ERROR"
+    fi
 }
 
 # Run main function with all command line arguments
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits that keep archive scanning safe against oversized archives and zip bombs
+const (
+	maxArchiveSize      = 512 << 20 // archives larger than this are skipped
+	maxArchiveEntries   = 100000    // archives with more entries than this are skipped
+	maxArchiveEntrySize = 50 << 20  // entries that claim to inflate beyond this are not read
+)
+
+// jksMagic is the header of a Java KeyStore file
+var jksMagic = []byte{0xFE, 0xED, 0xFE, 0xED}
+
+// pfxVersion is the DER encoding of the INTEGER 3 that opens every PKCS12 PFX
+var pfxVersion = []byte{0x02, 0x01, 0x03}
+
+// ArchiveTrustStore is a trust store bundled inside a JAR, WAR, EAR or ZIP
+type ArchiveTrustStore struct {
+	Archive   string
+	Entry     string
+	StoreType string
+	Size      uint64
+}
+
+// isArchive reports whether path has an extension of a zip-based archive
+func isArchive(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jar", ".war", ".ear", ".zip":
+		return true
+	}
+	return false
+}
+
+// isTrustStoreEntry reports whether an archive entry name looks like a trust store
+func isTrustStoreEntry(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	switch filepath.Ext(base) {
+	case ".jks", ".p12", ".pfx", ".keystore", ".truststore", ".ts":
+		return true
+	}
+	return base == "cacerts" || strings.Contains(base, "truststore")
+}
+
+// findArchiveTrustStores walks roots for zip-based archives and reports the
+// trust stores bundled inside them. Archives are only read, never modified.
+func findArchiveTrustStores(roots []string) []ArchiveTrustStore {
+	var stores []ArchiveTrustStore
+	for _, root := range roots {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isArchive(path) {
+				return nil
+			}
+			if info.Size() > maxArchiveSize {
+				if verbose {
+					fmt.Printf("Skipping %s: larger than %d MB\n", path, maxArchiveSize>>20)
+				}
+				return nil
+			}
+
+			found, err := scanArchive(path)
+			if err != nil {
+				if verbose {
+					fmt.Printf("Skipping %s: %v\n", path, err)
+				}
+				return nil
+			}
+			stores = append(stores, found...)
+			return nil
+		})
+	}
+	return stores
+}
+
+// scanArchive lists the trust store entries in a single archive, identifying
+// each store's type from its header
+func scanArchive(path string) ([]ArchiveTrustStore, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if len(reader.File) > maxArchiveEntries {
+		return nil, fmt.Errorf("more than %d entries", maxArchiveEntries)
+	}
+
+	var stores []ArchiveTrustStore
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() || !isTrustStoreEntry(entry.Name) {
+			continue
+		}
+
+		store := ArchiveTrustStore{
+			Archive:   path,
+			Entry:     entry.Name,
+			StoreType: storeTypeForPath(entry.Name),
+			Size:      entry.UncompressedSize64,
+		}
+		if entry.UncompressedSize64 <= maxArchiveEntrySize {
+			if storeType, err := archiveEntryStoreType(entry); err == nil {
+				store.StoreType = storeType
+			}
+		}
+		stores = append(stores, store)
+	}
+	return stores, nil
+}
+
+// archiveEntryStoreType identifies a trust store entry from its first bytes
+func archiveEntryStoreType(entry *zip.File) (string, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	header := make([]byte, 16)
+	n, err := io.ReadAtLeast(rc, header, len(jksMagic))
+	if err != nil {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, jksMagic):
+		return "JKS", nil
+	case isPFX(header):
+		return "PKCS12", nil
+	case bytes.HasPrefix(header, []byte("----")):
+		return "PEM", nil
+	}
+	return "", fmt.Errorf("unrecognized trust store format")
+}
+
+// isPFX reports whether header opens a PKCS12 PFX: a DER SEQUENCE whose first
+// element is version 3. Any DER file starts with a SEQUENCE, so the version is
+// what tells a PKCS12 store from, say, a DER certificate.
+func isPFX(header []byte) bool {
+	if len(header) < 2 || header[0] != 0x30 {
+		return false
+	}
+	// Skip the SEQUENCE length, in short form or long form
+	offset := 2
+	if header[1]&0x80 != 0 {
+		offset += int(header[1] & 0x7f)
+	}
+	return offset < len(header) && bytes.HasPrefix(header[offset:], pfxVersion)
+}
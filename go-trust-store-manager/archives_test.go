@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestIsPFX(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{"PKCS12, long form length", []byte{0x30, 0x82, 0x09, 0xcf, 0x02, 0x01, 0x03, 0x30}, true},
+		{"PKCS12, short form length", []byte{0x30, 0x7f, 0x02, 0x01, 0x03}, true},
+		{"DER certificate", []byte{0x30, 0x82, 0x02, 0xf9, 0x30, 0x82, 0x01, 0xe1}, false},
+		{"other version", []byte{0x30, 0x82, 0x09, 0xcf, 0x02, 0x01, 0x01}, false},
+		{"truncated", []byte{0x30, 0x84, 0x00, 0x00}, false},
+		{"JKS", []byte{0xfe, 0xed, 0xfe, 0xed}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPFX(tt.header); got != tt.want {
+				t.Errorf("isPFX(% x) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// modificationMarker prefixes every modification entry in the local audit log
+const modificationMarker = "[MODIFICATION] "
+
+// auditFilter selects which logged modifications the audit command prints
+type auditFilter struct {
+	since  time.Time
+	until  time.Time
+	status string
+	path   string
+	tail   int
+}
+
+// runAudit implements the audit command, which replays modifications recorded
+// in local audit logs. Log files may be given as arguments; otherwise every log
+// in the configured log directory is read.
+func runAudit(config *AppConfig, args []string) int {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	since := fs.String("since", "", "Only show modifications at or after this time (RFC3339, YYYY-MM-DD or a duration such as 24h)")
+	until := fs.String("until", "", "Only show modifications before this time (RFC3339, YYYY-MM-DD or a duration such as 24h)")
+	status := fs.String("status", "", "Only show modifications with this status (success, noop, failed)")
+	path := fs.String("path", "", "Only show modifications whose file path contains this string")
+	tail := fs.Int("n", 0, "Only show the last N matching modifications")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+
+	var filter auditFilter
+	var err error
+	if filter.since, err = parseAuditTime(*since); err != nil {
+		fmt.Printf("Error: invalid --since: %v\n", err)
+		return ExitError
+	}
+	if filter.until, err = parseAuditTime(*until); err != nil {
+		fmt.Printf("Error: invalid --until: %v\n", err)
+		return ExitError
+	}
+	filter.status = strings.ToLower(*status)
+	filter.path = *path
+	filter.tail = *tail
+
+	logFiles := fs.Args()
+	if len(logFiles) == 0 {
+		logDir := filepath.Dir(config.Logging.LocalLogPath)
+		logFiles, err = filepath.Glob(filepath.Join(logDir, "*.log*"))
+		if err != nil {
+			fmt.Printf("Error listing log files: %v\n", err)
+			return ExitError
+		}
+		if len(logFiles) == 0 {
+			fmt.Printf("No audit logs found in %s\n", logDir)
+			return ExitOK
+		}
+	}
+
+	var modifications []TrustStoreModification
+	for _, logFile := range logFiles {
+		entries, err := readModifications(logFile)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", logFile, err)
+			return ExitError
+		}
+		modifications = append(modifications, entries...)
+	}
+
+	printModifications(filterModifications(modifications, filter))
+	return ExitOK
+}
+
+// parseAuditTime parses an absolute timestamp or a duration relative to now.
+// An empty value yields the zero time, meaning no bound.
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+}
+
+// readModifications extracts every [MODIFICATION] entry from a local audit log.
+// Gzipped rotated logs are decompressed transparently.
+func readModifications(path string) ([]TrustStoreModification, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var modifications []TrustStoreModification
+	content := string(data)
+	for {
+		idx := strings.Index(content, modificationMarker)
+		if idx < 0 {
+			break
+		}
+		content = content[idx+len(modificationMarker):]
+
+		// Entries are indented JSON spanning several lines; decode exactly one value
+		var modification TrustStoreModification
+		if err := json.NewDecoder(strings.NewReader(content)).Decode(&modification); err != nil {
+			continue
+		}
+		modifications = append(modifications, modification)
+	}
+	return modifications, nil
+}
+
+// filterModifications applies the filter and returns matches in chronological order
+func filterModifications(modifications []TrustStoreModification, filter auditFilter) []TrustStoreModification {
+	var matches []TrustStoreModification
+	for _, modification := range modifications {
+		if !filter.since.IsZero() && modification.Timestamp.Before(filter.since) {
+			continue
+		}
+		if !filter.until.IsZero() && !modification.Timestamp.Before(filter.until) {
+			continue
+		}
+		if filter.status != "" && strings.ToLower(modification.Status) != filter.status {
+			continue
+		}
+		if filter.path != "" && !strings.Contains(modification.FilePath, filter.path) {
+			continue
+		}
+		matches = append(matches, modification)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Timestamp.Before(matches[j].Timestamp)
+	})
+
+	if filter.tail > 0 && len(matches) > filter.tail {
+		matches = matches[len(matches)-filter.tail:]
+	}
+	return matches
+}
+
+// printModifications prints modifications as an aligned table
+func printModifications(modifications []TrustStoreModification) {
+	if len(modifications) == 0 {
+		fmt.Println("No matching modifications found.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSTATUS\tOPERATION\tTYPE\tFILE")
+	for _, m := range modifications {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			m.Timestamp.Local().Format("2006-01-02 15:04:05"), m.Status, m.Operation, m.FileType, m.FilePath)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d modification(s)\n", len(modifications))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// storeDuplicates describes the duplicate certificates found in one trust store
+type storeDuplicates struct {
+	Total int
+	// Duplicates lists every entry after the first with the same fingerprint
+	Duplicates []string
+}
+
+// storeTypeForPath infers the trust store type from its file extension
+func storeTypeForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jks", ".keystore", ".ts":
+		return "JKS"
+	case ".p12", ".pfx":
+		return "PKCS12"
+	default:
+		if filepath.Base(path) == "cacerts" {
+			return "JKS"
+		}
+		return "PEM"
+	}
+}
+
+// normalizeFingerprint converts a fingerprint in openssl or keytool form
+// (AB:CD:...) or plain hex into lowercase hex without separators, so
+// fingerprints from different tools compare equal
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(fingerprint)), "sha256:")
+	return strings.NewReplacer(":", "", " ", "").Replace(fingerprint)
+}
+
+// findPEMDuplicates reports certificates in a PEM bundle whose SHA-256
+// fingerprint matches an earlier certificate in the same bundle
+func findPEMDuplicates(path string) (storeDuplicates, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return storeDuplicates{}, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var result storeDuplicates
+	seen := make(map[string]bool)
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		result.Total++
+		sum := sha256.Sum256(block.Bytes)
+		fingerprint := hex.EncodeToString(sum[:])
+		if seen[fingerprint] {
+			result.Duplicates = append(result.Duplicates, fmt.Sprintf("certificate #%d (sha256 %s)", result.Total, fingerprint))
+			continue
+		}
+		seen[fingerprint] = true
+	}
+	return result, nil
+}
+
+// findKeystoreDuplicates reports aliases in a JKS or PKCS12 store whose SHA-256
+// fingerprint matches an earlier alias, trying each configured password in turn
+func findKeystoreDuplicates(keytoolPath, path, storeType string, passwords []string) (storeDuplicates, error) {
+	var output []byte
+	var lastErr error
+	for _, password := range passwords {
+		cmd := exec.Command(keytoolPath, "-list", "-v", "-keystore", path, "-storetype", storeType, "-storepass", password)
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		if lastErr = runCommand(cmd); lastErr == nil {
+			output = stdout.Bytes()
+			break
+		}
+	}
+	if output == nil {
+		return storeDuplicates{}, fmt.Errorf("failed to list %s: %v", path, lastErr)
+	}
+
+	var result storeDuplicates
+	seen := make(map[string]string)
+	alias := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Alias name:"):
+			alias = strings.TrimSpace(strings.TrimPrefix(line, "Alias name:"))
+			result.Total++
+		case strings.HasPrefix(line, "SHA256:") && alias != "":
+			fingerprint := normalizeFingerprint(strings.TrimPrefix(line, "SHA256:"))
+			if first, ok := seen[fingerprint]; ok {
+				result.Duplicates = append(result.Duplicates, fmt.Sprintf("alias %q (same as %q)", alias, first))
+			} else {
+				seen[fingerprint] = alias
+			}
+			// Only the first fingerprint after an alias is the entry's own certificate
+			alias = ""
+		}
+	}
+	return result, nil
+}
+
+// runDedupe implements the dedupe command. It reports duplicate certificates in
+// each given trust store and records the removals it would make. It never removes
+// them: removal is a deletion, and loadConfig always enforces both --noop and
+// operations.upsert_only, so this tool has no path that may delete entries.
+func runDedupe(config *AppConfig, jreInfo *JREInfo, stores []string, structuredLogger *StructuredLogger) int {
+	if len(stores) == 0 {
+		fmt.Println("Error: dedupe requires at least one trust store path")
+		return ExitError
+	}
+
+	passwords := config.Operations.DefaultJKSPasswords
+	if len(passwords) == 0 {
+		passwords = []string{"changeit"}
+	}
+
+	var modifications []TrustStoreModification
+	duplicateStores := 0
+	for _, store := range stores {
+		storeType := storeTypeForPath(store)
+		modification := TrustStoreModification{
+			FilePath:  store,
+			FileType:  storeType,
+			Operation: "dedupe",
+			Status:    "noop",
+		}
+
+		var result storeDuplicates
+		var err error
+		if storeType == "PEM" {
+			result, err = findPEMDuplicates(store)
+		} else if !jreInfo.Available {
+			err = fmt.Errorf("keytool is required to read %s stores", storeType)
+		} else {
+			result, err = findKeystoreDuplicates(jreInfo.KeytoolPath, store, storeType, passwords)
+		}
+
+		switch {
+		case err != nil:
+			fmt.Printf("✗ %s: %v\n", store, err)
+			modification.Status = "failed"
+			modification.ErrorMessage = err.Error()
+		case len(result.Duplicates) == 0:
+			printInfo("✓ %s: %d certificates, no duplicates\n", store, result.Total)
+			continue
+		default:
+			duplicateStores++
+			fmt.Printf("⚠ %s: %d certificates, %d duplicates would be removed\n", store, result.Total, len(result.Duplicates))
+			for _, duplicate := range result.Duplicates {
+				fmt.Printf("    - %s\n", duplicate)
+			}
+			modification.NoopOutput = fmt.Sprintf("Would remove %d duplicate certificates: %s",
+				len(result.Duplicates), strings.Join(result.Duplicates, ", "))
+		}
+
+		if structuredLogger != nil {
+			structuredLogger.LogModification(modification)
+		}
+		modifications = append(modifications, modification)
+	}
+
+	// Stores that could not be read have nothing to remove
+	if duplicateStores > 0 {
+		fmt.Println("\nDuplicates were not removed: dedupe only reports, as operations.upsert_only forbids deletions.")
+	}
+
+	return exitCodeForModifications(modifications)
+}
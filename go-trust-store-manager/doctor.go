@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Doctor check outcomes
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// DoctorCheck is the outcome of a single doctor check
+type DoctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// runDoctor checks every external dependency and writable location the tool
+// relies on and prints a pass/fail line for each. It returns false if any
+// check failed outright.
+func runDoctor(config *AppConfig) bool {
+	fmt.Println("Trust Store Manager - Doctor")
+	fmt.Println("============================")
+	fmt.Println()
+
+	jreInfo := detectJRE(config)
+
+	var checks []DoctorCheck
+	checks = append(checks, checkJRE(jreInfo))
+	checks = append(checks, checkJavaVersion(jreInfo, config.JRE.MinVersion))
+	checks = append(checks, checkTool(config.Tools.OpenSSLPath, "Certificate inspection", "version"))
+	checks = append(checks, checkTool("kubectl", "Kubernetes ConfigMap/Secret scanning", "version", "--client"))
+	checks = append(checks, checkTool("docker", "Docker container scanning", "--version"))
+	checks = append(checks, checkWritable("Log directory", filepath.Dir(config.Logging.LocalLogPath)))
+	if config.Security.BackupDir != "" {
+		checks = append(checks, checkWritable("Backup directory", config.Security.BackupDir))
+	}
+	checks = append(checks, checkWebhook(config))
+
+	healthy := true
+	for _, check := range checks {
+		symbol := "✓"
+		switch check.Status {
+		case checkWarn:
+			symbol = "⚠"
+		case checkFail:
+			symbol = "✗"
+			healthy = false
+		}
+		fmt.Printf("%s [%s] %s: %s\n", symbol, check.Status, check.Name, check.Detail)
+	}
+
+	fmt.Println()
+	if healthy {
+		fmt.Println("All required checks passed.")
+	} else {
+		fmt.Println("Some checks failed. Resolve the issues above before running a scan.")
+	}
+	return healthy
+}
+
+// checkJRE reports whether keytool is usable for JKS and PKCS12 stores
+func checkJRE(jreInfo *JREInfo) DoctorCheck {
+	check := DoctorCheck{Name: "Java keytool (JKS/PKCS12 support)"}
+	if !jreInfo.Available {
+		check.Status = checkWarn
+		check.Detail = "not found; only PEM trust stores can be processed"
+		if jreInfo.Error != "" {
+			check.Detail = jreInfo.Error + "; only PEM trust stores can be processed"
+		}
+		return check
+	}
+
+	check.Status = checkPass
+	check.Detail = jreInfo.KeytoolPath
+	if jreInfo.JavaVersion != "" {
+		check.Detail += " (" + strings.TrimSpace(jreInfo.JavaVersion) + ")"
+	}
+	return check
+}
+
+// checkJavaVersion reports whether the detected Java meets jre.min_version
+func checkJavaVersion(jreInfo *JREInfo, minVersion string) DoctorCheck {
+	check := DoctorCheck{Name: fmt.Sprintf("Java version (minimum %s)", minVersion)}
+	if _, err := parseJavaMajorVersion(minVersion); err != nil {
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("invalid jre.min_version: %v", err)
+		return check
+	}
+	if jreInfo.MajorVersion == 0 {
+		check.Status = checkWarn
+		check.Detail = "could not determine the Java version"
+		if jreInfo.JavaVersion != "" {
+			check.Detail += " from " + strconv.Quote(jreInfo.JavaVersion)
+		}
+		return check
+	}
+
+	if err := checkMinJavaVersion(jreInfo, minVersion); err != nil {
+		check.Status = checkFail
+		check.Detail = err.Error() + "; set --keytool-path or jre.java_home to a newer JRE"
+		return check
+	}
+	check.Status = checkPass
+	check.Detail = fmt.Sprintf("Java %d", jreInfo.MajorVersion)
+	return check
+}
+
+// checkTool reports whether an optional external tool is on the PATH, or at
+// the given path, and its version
+func checkTool(name, feature string, versionArgs ...string) DoctorCheck {
+	check := DoctorCheck{Name: fmt.Sprintf("%s (%s)", name, feature)}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		check.Status = checkWarn
+		check.Detail = "not found in PATH"
+		if strings.ContainsRune(name, filepath.Separator) {
+			check.Detail = fmt.Sprintf("not usable: %v", err)
+		}
+		return check
+	}
+
+	check.Status = checkPass
+	check.Detail = path
+	if output, err := exec.Command(path, versionArgs...).CombinedOutput(); err == nil {
+		if version := strings.TrimSpace(strings.Split(string(output), "\n")[0]); version != "" {
+			check.Detail += " (" + version + ")"
+		}
+	}
+	return check
+}
+
+// checkWritable reports whether files can be created in dir, or in the nearest
+// existing parent when dir has not been created yet
+func checkWritable(name, dir string) DoctorCheck {
+	check := DoctorCheck{Name: name}
+
+	existing := dir
+	for {
+		if _, err := os.Stat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	probe, err := os.CreateTemp(existing, ".trust-store-manager-doctor-*")
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("%s is not writable: %v", dir, err)
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	check.Status = checkPass
+	if existing == dir {
+		check.Detail = dir + " is writable"
+	} else {
+		check.Detail = dir + " will be created under " + existing
+	}
+	return check
+}
+
+// checkWebhook reports whether the configured webhook endpoint answers HTTP requests
+func checkWebhook(config *AppConfig) DoctorCheck {
+	check := DoctorCheck{Name: "Webhook endpoint"}
+	webhookURL := config.Logging.WebhookURL
+	if webhookURL == "" {
+		check.Status = checkPass
+		check.Detail = "not configured"
+		return check
+	}
+
+	req, err := http.NewRequest(http.MethodHead, webhookURL, nil)
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("%s is not a valid URL: %v", webhookURL, err)
+		return check
+	}
+	setWebhookHeaders(req, config, nil)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Status = checkFail
+		check.Detail = fmt.Sprintf("%s is unreachable: %v", webhookURL, err)
+		return check
+	}
+	resp.Body.Close()
+
+	check.Status = checkPass
+	check.Detail = fmt.Sprintf("%s reachable (HTTP %d)", webhookURL, resp.StatusCode)
+	return check
+}
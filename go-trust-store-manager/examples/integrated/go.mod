@@ -4,9 +4,10 @@ go 1.19
 
 require (
 	github.com/spf13/cobra v1.7.0
+	golang.org/x/time v0.3.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-) 
\ No newline at end of file
+)
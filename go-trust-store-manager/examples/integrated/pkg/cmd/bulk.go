@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudaserb365/trust-store-manager/pkg/validator"
+	"golang.org/x/time/rate"
+)
+
+// bulkOptions controls how validateDomains spreads connections over time
+type bulkOptions struct {
+	rootStore      string
+	intermediates  string
+	days           int
+	maxConcurrency int
+	rateLimit      float64
+	timeout        time.Duration
+}
+
+// domainOutcome is the validation result or error for a single domain
+type domainOutcome struct {
+	domain string
+	result *validator.ChainValidationResult
+	err    error
+}
+
+// parseDomain splits a host[:port] argument into a dial endpoint and TLS server
+// name. IPv6 addresses take a port only in brackets, as in [2001:db8::1]:8443.
+func parseDomain(domain string) (string, string) {
+	host, port, err := net.SplitHostPort(domain)
+	if err != nil {
+		// No port: the whole argument is the host, possibly a bracketed IPv6 address
+		host, port = strings.TrimSuffix(strings.TrimPrefix(domain, "["), "]"), ""
+	}
+	if port == "" {
+		port = "443"
+	}
+	return net.JoinHostPort(host, port), host
+}
+
+// readDomainsFile reads one domain per line, skipping blank lines and # comments
+func readDomainsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening domains file: %v", err)
+	}
+	defer file.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading domains file: %v", err)
+	}
+
+	return domains, nil
+}
+
+// validateDomains validates every domain with at most maxConcurrency connections
+// in flight and at most rateLimit new connections per second. Outcomes are
+// returned in the same order as domains.
+func validateDomains(domains []string, opts bulkOptions) []domainOutcome {
+	if opts.maxConcurrency < 1 {
+		opts.maxConcurrency = 1
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if opts.rateLimit > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.rateLimit), 1)
+	}
+
+	outcomes := make([]domainOutcome, len(domains))
+	semaphore := make(chan struct{}, opts.maxConcurrency)
+	var wg sync.WaitGroup
+
+	for i, domain := range domains {
+		semaphore <- struct{}{}
+		if err := limiter.Wait(context.Background()); err != nil {
+			<-semaphore
+			outcomes[i] = domainOutcome{domain: domain, err: fmt.Errorf("error waiting for the rate limiter: %v", err)}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, domain string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+			defer cancel()
+
+			endpoint, serverName := parseDomain(domain)
+			result, err := validator.ValidateEndpointContext(ctx, endpoint, serverName, opts.rootStore, opts.intermediates, opts.days)
+			outcomes[i] = domainOutcome{domain: domain, result: result, err: err}
+		}(i, domain)
+	}
+
+	wg.Wait()
+	return outcomes
+}
+
+// reportFileName turns a domain into a safe report file name
+func reportFileName(domain string) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(domain) + ".txt"
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import "testing"
+
+func TestParseDomain(t *testing.T) {
+	tests := []struct {
+		domain         string
+		wantEndpoint   string
+		wantServerName string
+	}{
+		{"example.com", "example.com:443", "example.com"},
+		{"example.com:8443", "example.com:8443", "example.com"},
+		{"example.com:", "example.com:443", "example.com"},
+		{"192.0.2.1", "192.0.2.1:443", "192.0.2.1"},
+		{"2001:db8::1", "[2001:db8::1]:443", "2001:db8::1"},
+		{"[2001:db8::1]", "[2001:db8::1]:443", "2001:db8::1"},
+		{"[2001:db8::1]:8443", "[2001:db8::1]:8443", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			endpoint, serverName := parseDomain(tt.domain)
+			if endpoint != tt.wantEndpoint || serverName != tt.wantServerName {
+				t.Errorf("parseDomain(%q) = %q, %q, want %q, %q", tt.domain, endpoint, serverName, tt.wantEndpoint, tt.wantServerName)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mudaserb365/trust-store-manager/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+// diffReport is the JSON representation of a store comparison
+type diffReport struct {
+	Store       string                  `json:"store"`
+	Other       string                  `json:"other"`
+	Common      int                     `json:"common"`
+	OnlyInStore []diffCertificateReport `json:"only_in_store"`
+	OnlyInOther []diffCertificateReport `json:"only_in_other"`
+}
+
+// diffCertificateReport identifies a certificate found on one side only
+type diffCertificateReport struct {
+	Subject  string `json:"subject"`
+	SHA256   string `json:"sha256"`
+	NotAfter string `json:"not_after"`
+}
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [store] [other-store]",
+	Short: "Show the certificates that differ between two trust stores",
+	Long: `Compares two trust stores by SHA-256 fingerprint and lists the certificates
+found in only one of them. Stores may be PEM, DER, JKS or PKCS12 (the last
+two through keytool).
+
+With --compare-system the store is compared with the host's system trust
+store instead, showing the CAs an application trusts that the operating
+system does not, and the system roots the application is missing. The
+system store is the distribution's CA bundle on Linux and BSD, and the
+System Roots keychain on macOS. SSL_CERT_FILE overrides it.
+
+Example:
+  mrp diff app-truststore.jks --compare-system
+  mrp diff old-cacerts new-cacerts -o json`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		compareSystem, _ := cmd.Flags().GetBool("compare-system")
+		output, _ := cmd.Flags().GetString("output")
+
+		if compareSystem == (len(args) == 2) {
+			fmt.Println("Error: give either a second store or --compare-system")
+			os.Exit(ExitError)
+		}
+		if output != "text" && output != "json" {
+			fmt.Printf("Error: invalid output format %q: must be text or json\n", output)
+			os.Exit(ExitError)
+		}
+
+		storepass, err := storePassword(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		store := args[0]
+		certs, err := manager.ReadStore(store, storepass)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		var other string
+		var otherCerts []*x509.Certificate
+		otherName := "the system"
+		if compareSystem {
+			other, otherCerts, err = manager.ReadSystemStore()
+		} else {
+			other = args[1]
+			otherName = other
+			otherCerts, err = manager.ReadStore(other, storepass)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		diff := manager.DiffCertificates(certs, otherCerts)
+
+		if output == "json" {
+			report := diffReport{
+				Store:       store,
+				Other:       other,
+				Common:      diff.Common,
+				OnlyInStore: diffCertificateReports(diff.OnlyInFirst),
+				OnlyInOther: diffCertificateReports(diff.OnlyInSecond),
+			}
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(ExitError)
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		fmt.Printf("Comparing %s (%d certificates) with %s (%d certificates)\n",
+			store, len(certs), other, len(otherCerts))
+		fmt.Printf("%d certificates in common\n", diff.Common)
+
+		fmt.Printf("\nTrusted only by %s (%d):\n", store, len(diff.OnlyInFirst))
+		for _, cert := range diff.OnlyInFirst {
+			fmt.Printf("  + %s (SHA-256 %s)\n", cert.Subject.String(), manager.Fingerprint(cert))
+		}
+		fmt.Printf("\nTrusted only by %s (%d):\n", otherName, len(diff.OnlyInSecond))
+		for _, cert := range diff.OnlyInSecond {
+			fmt.Printf("  - %s (SHA-256 %s)\n", cert.Subject.String(), manager.Fingerprint(cert))
+		}
+	},
+}
+
+// diffCertificateReports converts certificates into their JSON representation,
+// always returning a non-nil slice so JSON consumers see [] rather than null
+func diffCertificateReports(certs []*x509.Certificate) []diffCertificateReport {
+	reports := make([]diffCertificateReport, 0, len(certs))
+	for _, cert := range certs {
+		reports = append(reports, diffCertificateReport{
+			Subject:  cert.Subject.String(),
+			SHA256:   manager.Fingerprint(cert),
+			NotAfter: cert.NotAfter.Format(time.RFC3339),
+		})
+	}
+	return reports
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().Bool("compare-system", false, "Compare the store with the host's system trust store")
+	addStorepassFlags(diffCmd)
+	diffCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
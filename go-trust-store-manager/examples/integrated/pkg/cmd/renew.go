@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mudaserb365/trust-store-manager/pkg/manager"
+	"github.com/mudaserb365/trust-store-manager/pkg/validator"
+	"github.com/spf13/cobra"
+)
+
+// renewCheckCmd represents the renew-check command
+var renewCheckCmd = &cobra.Command{
+	Use:   "renew-check [store-or-directory...]",
+	Short: "Print a schedule of upcoming certificate renewals",
+	Long: `Reads every certificate in the given trust stores and directories and prints
+when each one, leaf or CA, needs renewing: its expiry less the lead time.
+
+Stores may be PEM, DER, JKS or PKCS12 (the last two through keytool).
+Directories are searched for files of those types. A certificate found in
+several stores is scheduled once.
+
+With --format ics the schedule is an iCalendar file with an all-day event on
+each renew-by date, which a team calendar can subscribe to. Event UIDs are
+derived from certificate fingerprints, so regenerating the file updates the
+existing events rather than duplicating them.
+
+Example:
+  mrp renew-check --store cacerts --format ics > renewals.ics
+  mrp renew-check /etc/app/certs --lead-days 60 --within 90`,
+	Run: func(cmd *cobra.Command, args []string) {
+		stores, _ := cmd.Flags().GetStringArray("store")
+		format, _ := cmd.Flags().GetString("format")
+		leadDays, _ := cmd.Flags().GetInt("lead-days")
+		within, _ := cmd.Flags().GetInt("within")
+
+		paths := append(stores, args...)
+		if len(paths) == 0 {
+			fmt.Println("Error: give at least one trust store or directory, as an argument or with --store")
+			os.Exit(ExitError)
+		}
+		if format != "text" && format != "ics" {
+			fmt.Printf("Error: invalid --format %q: must be text or ics\n", format)
+			os.Exit(ExitError)
+		}
+
+		storepass, err := storePassword(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		schedule := validator.NewExpirySchedule(time.Duration(leadDays) * 24 * time.Hour)
+
+		// Errors go to stderr so they can't corrupt a calendar written to stdout
+		failed := false
+		for _, path := range paths {
+			files, err := renewCheckFiles(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				failed = true
+				continue
+			}
+			for _, file := range files {
+				certs, err := manager.ReadStore(file, storepass)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					failed = true
+					continue
+				}
+				schedule.Add(file, certs)
+			}
+		}
+
+		var until time.Time
+		if within > 0 {
+			until = time.Now().AddDate(0, 0, within)
+		}
+		entries := schedule.Entries(until)
+
+		if format == "ics" {
+			fmt.Print(validator.FormatScheduleICS(entries))
+		} else {
+			fmt.Print(validator.FormatScheduleText(entries))
+		}
+
+		if failed {
+			os.Exit(ExitError)
+		}
+	},
+}
+
+// renewCheckFiles returns path itself, or for a directory every file in it that
+// looks like a certificate file or trust store
+func renewCheckFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".pem", ".crt", ".cert", ".cer", ".der", ".jks", ".keystore", ".ts", ".p12", ".pfx":
+			files = append(files, file)
+		default:
+			if info.Name() == "cacerts" {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %v", path, err)
+	}
+	return files, nil
+}
+
+func init() {
+	rootCmd.AddCommand(renewCheckCmd)
+
+	renewCheckCmd.Flags().StringArray("store", nil, "Trust store or directory to read (repeatable)")
+	renewCheckCmd.Flags().String("format", "text", "Output format: text or ics")
+	renewCheckCmd.Flags().Int("lead-days", 30, "Plan each renewal this many days before the certificate expires")
+	renewCheckCmd.Flags().Int("within", 0, "Only list renewals due within this many days (0 for all)")
+	addStorepassFlags(renewCheckCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRenewCheckFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "renew-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{"ca.pem", "conf/app.jks", "conf/store.P12", "jre/lib/security/cacerts", "README.md", "conf/app.yaml"}
+	for _, name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{"directory", dir, []string{"ca.pem", "conf/app.jks", "conf/store.P12", "jre/lib/security/cacerts"}, false},
+		{"single file of any name", filepath.Join(dir, "README.md"), []string{"README.md"}, false},
+		{"missing path", filepath.Join(dir, "missing"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renewCheckFiles(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renewCheckFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var rel []string
+			for _, file := range got {
+				rel = append(rel, filepath.ToSlash(strings.TrimPrefix(file, dir+string(filepath.Separator))))
+			}
+			sort.Strings(rel)
+			if strings.Join(rel, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("renewCheckFiles() = %v, want %v", rel, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// Process exit codes. These form a stable contract for schedulers and
+// orchestrators and must not be renumbered.
+const (
+	ExitOK              = 0 // Everything validated
+	ExitChanges         = 1 // Changes were applied, or would be applied
+	ExitError           = 2 // Errors were encountered, such as unreadable files or unreachable hosts
+	ExitPolicyViolation = 3 // A certificate failed validation or a policy check
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "mrp",
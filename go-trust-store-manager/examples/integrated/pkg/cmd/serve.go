@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mudaserb365/trust-store-manager/pkg/validator"
+	"github.com/spf13/cobra"
+)
+
+// maxRequestBody bounds the size of a PEM or JSON request body
+const maxRequestBody = 1 << 20
+
+// endpointRequest is the JSON body accepted by POST /validate for endpoint validation
+type endpointRequest struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	ServerName string `json:"server_name"`
+}
+
+// validationServer holds the validation settings shared by every request
+type validationServer struct {
+	rootStore     string
+	intermediates string
+	days          int
+	// allowedHosts lists the hosts that endpoint validation may connect to.
+	// Endpoint validation is refused when it is empty.
+	allowedHosts map[string]bool
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an HTTP certificate validation service",
+	Long: `Runs an HTTP server that validates certificates on behalf of other services.
+
+Endpoints:
+  POST /validate   PEM certificate body, or JSON {"host": "...", "port": 443}
+  GET  /healthz    Liveness check
+
+Every validation uses the root store, intermediates and expiry window
+configured when the server was started.
+
+The server listens on localhost unless --addr says otherwise. Endpoint
+validation makes the server connect wherever a request points it, so it is
+refused unless the host is listed with --allow-host.
+
+Example:
+  mrp serve
+  curl --data-binary @server.crt http://localhost:8080/validate
+  mrp serve --allow-host example.com
+  curl -H 'Content-Type: application/json' -d '{"host":"example.com"}' http://localhost:8080/validate`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+		rootStore, _ := cmd.Flags().GetString("root-store")
+		intermediates, _ := cmd.Flags().GetString("intermediates")
+		days, _ := cmd.Flags().GetInt("days")
+		allowHosts, _ := cmd.Flags().GetStringSlice("allow-host")
+
+		server := &validationServer{
+			rootStore:     rootStore,
+			intermediates: intermediates,
+			days:          days,
+			allowedHosts:  make(map[string]bool),
+		}
+		for _, host := range allowHosts {
+			server.allowedHosts[normalizeHost(host)] = true
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/validate", server.handleValidate)
+		mux.HandleFunc("/healthz", handleHealthz)
+
+		httpServer := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		fmt.Printf("Validation service listening on %s\n", addr)
+		if err := httpServer.ListenAndServe(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+	},
+}
+
+// handleValidate validates a PEM certificate body or a JSON endpoint description
+func (s *validationServer) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("error reading request body: %v", err))
+		return
+	}
+
+	var result *validator.ChainValidationResult
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req endpointRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %v", err))
+			return
+		}
+		if req.Host == "" {
+			writeJSONError(w, http.StatusBadRequest, "host is required")
+			return
+		}
+		if !s.allowedHosts[normalizeHost(req.Host)] {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("endpoint validation is not allowed for host %s", req.Host))
+			return
+		}
+		if req.Port == 0 {
+			req.Port = 443
+		}
+		if req.ServerName == "" {
+			req.ServerName = req.Host
+		}
+
+		endpoint := net.JoinHostPort(req.Host, strconv.Itoa(req.Port))
+		result, err = validator.ValidateEndpoint(endpoint, req.ServerName, s.rootStore, s.intermediates, s.days)
+	} else {
+		result, err = validator.ValidatePEM(body, s.rootStore, s.intermediates, s.days)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, validator.NewValidationReport(result))
+}
+
+// normalizeHost lower-cases a host name and strips a trailing dot, so that
+// allowlist entries match however the request spells the host
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// handleHealthz reports that the service is running
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes an error message as a JSON response
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("addr", "localhost:8080", "Address to listen on")
+	serveCmd.Flags().StringP("root-store", "r", "/etc/ssl/certs", "Path to the root CA certificates directory")
+	serveCmd.Flags().StringP("intermediates", "i", "", "Path to intermediate certificates directory")
+	serveCmd.Flags().IntP("days", "d", 30, "Warn if certificate expires within this many days")
+	serveCmd.Flags().StringSlice("allow-host", nil, "Host that endpoint validation may connect to (repeatable); endpoint validation is disabled without one")
+}
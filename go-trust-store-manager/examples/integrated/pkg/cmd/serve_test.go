@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleValidateEndpointAllowlist(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		body       string
+		wantStatus int
+	}{
+		{"no allowlist", nil, `{"host":"169.254.169.254","port":80}`, http.StatusForbidden},
+		{"host not listed", []string{"example.com"}, `{"host":"internal.example.net"}`, http.StatusForbidden},
+		{"missing host", []string{"example.com"}, `{"port":443}`, http.StatusBadRequest},
+		// An allowed host passes the gate; the connection itself fails, as
+		// nothing listens on port 1
+		{"listed host", []string{"LOCALHOST."}, `{"host":"localhost","port":1}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &validationServer{days: 30, allowedHosts: make(map[string]bool)}
+			for _, host := range tt.allowed {
+				server.allowedHosts[normalizeHost(host)] = true
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			server.handleValidate(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mudaserb365/trust-store-manager/pkg/manager"
+	"github.com/spf13/cobra"
+)
+
+// storepassEnv names the environment variable read for the keystore password
+const storepassEnv = "MRP_STOREPASS"
+
+// addStorepassFlags adds the keystore password flags of commands that read
+// JKS and PKCS12 stores
+func addStorepassFlags(cmd *cobra.Command) {
+	cmd.Flags().String("storepass", "", "Keystore password (visible in the process list; prefer --storepass-file or $"+storepassEnv+")")
+	cmd.Flags().String("storepass-file", "", "Read the keystore password from the first line of this file")
+}
+
+// storePassword returns the keystore password given by --storepass-file,
+// --storepass or $MRP_STOREPASS, in that order, or Java's default "changeit"
+func storePassword(cmd *cobra.Command) (string, error) {
+	if file, _ := cmd.Flags().GetString("storepass-file"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("error reading keystore password: %v", err)
+		}
+		return strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r"), nil
+	}
+	if password, _ := cmd.Flags().GetString("storepass"); password != "" {
+		return password, nil
+	}
+	if password := os.Getenv(storepassEnv); password != "" {
+		return password, nil
+	}
+	return manager.DefaultStorePassword, nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestStorePassword(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "storepass")
+	if err := ioutil.WriteFile(file, []byte("from-file\r\nignored\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"default", nil, "", "changeit", false},
+		{"environment", nil, "from-env", "from-env", false},
+		{"flag over environment", []string{"--storepass", "from-flag"}, "from-env", "from-flag", false},
+		{"file over flag", []string{"--storepass", "from-flag", "--storepass-file", file}, "from-env", "from-file", false},
+		{"missing file", []string{"--storepass-file", filepath.Join(filepath.Dir(file), "missing")}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(storepassEnv, tt.env)
+			cmd := &cobra.Command{}
+			addStorepassFlags(cmd)
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := storePassword(cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("storePassword() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
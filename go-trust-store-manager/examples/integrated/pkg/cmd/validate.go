@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/mudaserb365/trust-store-manager/pkg/manager"
 	"github.com/mudaserb365/trust-store-manager/pkg/validator"
 	"github.com/spf13/cobra"
 )
@@ -18,6 +22,13 @@ and trusted chain from leaf certificates to trusted root CAs.
 
 The validate command can validate individual certificate files or endpoints
 such as websites and servers.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		format := fingerprintFormat(cmd)
+		if format != validator.FingerprintHex && format != validator.FingerprintColon {
+			return fmt.Errorf("unsupported fingerprint format: %s (expected hex or colon)", format)
+		}
+		return nil
+	},
 }
 
 // validateFileCmd represents the validate file subcommand
@@ -26,12 +37,14 @@ var validateFileCmd = &cobra.Command{
 	Short: "Validate a certificate file",
 	Long: `Validates the trust path of a certificate file.
 
-The certificate file should be in PEM format. This command will check
+The certificate file may be PEM or DER; the format is detected from its
+content unless --input-format is given. This command will check
 if the certificate forms a complete and trusted chain to a root CA.
 
 Example:
   mrp validate file server.crt
-  mrp validate file -r /path/to/roots client.pem`,
+  mrp validate file -r /path/to/roots client.pem
+  mrp validate file --input-format der cert.bin`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		certFile := args[0]
@@ -39,30 +52,237 @@ Example:
 		intermediates, _ := cmd.Flags().GetString("intermediates")
 		days, _ := cmd.Flags().GetInt("days")
 		verbose, _ := cmd.Flags().GetBool("verbose")
+		output, _ := cmd.Flags().GetString("output")
+		inputFormat, _ := cmd.Flags().GetString("input-format")
 
 		// Check if file exists
 		if _, err := os.Stat(certFile); os.IsNotExist(err) {
 			fmt.Printf("Error: Certificate file does not exist: %s\n", certFile)
-			os.Exit(1)
+			os.Exit(ExitError)
 		}
 
-		fmt.Println("Trust Path Validator")
-		fmt.Println("====================")
-		fmt.Println()
+		if output == "text" {
+			fmt.Println("Trust Path Validator")
+			fmt.Println("====================")
+			fmt.Println()
+		}
 
 		// Validate the certificate
-		result, err := validator.ValidateFile(certFile, rootStore, intermediates, days)
+		result, err := validator.ValidateFileFormat(certFile, inputFormat, rootStore, intermediates, days)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			os.Exit(ExitError)
+		}
+
+		if err := applyRequiredRoot(cmd, result); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
 		}
 
 		// Display the result
-		fmt.Println(validator.FormatValidationResult(result, verbose))
+		if err := printResults(cmd, []*validator.ChainValidationResult{result}, output, verbose); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+		if err := writeReport(cmd, []*validator.ChainValidationResult{result}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
 
 		// Exit with status based on validation result
-		if !result.ValidPath {
-			os.Exit(1)
+		if resultFailed(cmd, result) {
+			os.Exit(ExitPolicyViolation)
+		}
+	},
+}
+
+// validateStoreCmd represents the validate store subcommand
+var validateStoreCmd = &cobra.Command{
+	Use:   "store [keystore-file]",
+	Short: "Validate one entry of a JKS or PKCS12 keystore",
+	Long: `Validates the trust path of a single keystore entry, selected by alias.
+
+For PKCS12 keystores the alias is the entry's friendlyName. If the entry
+carries its own certificate chain, the certificates after the leaf are
+used as intermediates. Reading the keystore requires keytool.
+
+Example:
+  mrp validate store server.p12 --alias server
+  mrp validate store app.jks --alias tomcat --storepass-file /run/secrets/storepass
+  MRP_STOREPASS=s3cret mrp validate store app.jks --alias tomcat`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		storeFile := args[0]
+		alias, _ := cmd.Flags().GetString("alias")
+		rootStore, _ := cmd.Flags().GetString("root-store")
+		intermediates, _ := cmd.Flags().GetString("intermediates")
+		days, _ := cmd.Flags().GetInt("days")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		output, _ := cmd.Flags().GetString("output")
+
+		if output == "text" {
+			fmt.Println("Trust Path Validator")
+			fmt.Println("====================")
+			fmt.Println()
+			fmt.Printf("Keystore: %s (alias %s)\n\n", storeFile, alias)
+		}
+
+		storepass, err := storePassword(cmd)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		certData, err := manager.ReadEntryPEM(storeFile, alias, storepass)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		result, err := validator.ValidatePEM(certData, rootStore, intermediates, days)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+		result.Source = storeFile + "#" + alias
+
+		if err := applyRequiredRoot(cmd, result); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		if err := printResults(cmd, []*validator.ChainValidationResult{result}, output, verbose); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+		if err := writeReport(cmd, []*validator.ChainValidationResult{result}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		if resultFailed(cmd, result) {
+			os.Exit(ExitPolicyViolation)
+		}
+	},
+}
+
+// validateCSRCmd represents the validate csr subcommand
+var validateCSRCmd = &cobra.Command{
+	Use:   "csr [csr-file]",
+	Short: "Validate a certificate signing request",
+	Long: `Validates a PKCS#10 certificate signing request before it is sent to a CA.
+
+The request may be PEM or DER. This command verifies the request's
+self-signature and reports its subject, Subject Alternative Names, key
+and signature algorithm. Keys below 2048-bit RSA or 256-bit ECDSA are
+reported as errors, and SHA-1 or MD5 signatures as warnings.
+
+Example:
+  mrp validate csr request.csr
+  mrp validate csr -o json request.csr`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		csrFile := args[0]
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		output, _ := cmd.Flags().GetString("output")
+
+		result, err := validator.ValidateCSRFile(csrFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		switch output {
+		case "text":
+			fmt.Println("Trust Path Validator - CSR Validation")
+			fmt.Println("=====================================")
+			fmt.Println()
+			fmt.Println(validator.FormatCSRResult(result, verbose))
+		case "json":
+			report, err := validator.FormatCSRResultJSON(result)
+			if err != nil {
+				fmt.Printf("Error: failed to build JSON report: %v\n", err)
+				os.Exit(ExitError)
+			}
+			fmt.Println(report)
+		default:
+			fmt.Printf("Error: unsupported output format: %s\n", output)
+			os.Exit(ExitError)
+		}
+
+		strict, _ := cmd.Flags().GetBool("strict")
+		failOnWarning, _ := cmd.Flags().GetBool("fail-on-warning")
+		if len(result.Errors) > 0 || ((strict || failOnWarning) && len(result.Warnings) > 0) {
+			os.Exit(ExitPolicyViolation)
+		}
+	},
+}
+
+// validateDirCmd represents the validate dir subcommand
+var validateDirCmd = &cobra.Command{
+	Use:   "dir [directory]",
+	Short: "Validate every certificate file in a directory",
+	Long: `Validates the trust path of every .pem, .crt, .cert, .cer and .der file under a directory.
+
+Files are validated concurrently against the same root store, which makes
+it practical to audit a directory of leaf certificates in one run.
+
+Example:
+  mrp validate dir /etc/app/certs
+  mrp validate dir --workers 8 -o json ./certs`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+		rootStore, _ := cmd.Flags().GetString("root-store")
+		intermediates, _ := cmd.Flags().GetString("intermediates")
+		days, _ := cmd.Flags().GetInt("days")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		output, _ := cmd.Flags().GetString("output")
+		workers, _ := cmd.Flags().GetInt("workers")
+		inputFormat, _ := cmd.Flags().GetString("input-format")
+
+		if output == "text" {
+			fmt.Println("Trust Path Validator - Directory Validation")
+			fmt.Println("===========================================")
+			fmt.Println()
+		}
+
+		results, err := validator.ValidateDirectory(dir, validator.DirectoryOptions{
+			RootStorePath:    rootStore,
+			IntermediatePath: intermediates,
+			ExpiryDays:       days,
+			Workers:          workers,
+			InputFormat:      inputFormat,
+		})
+		if results == nil && err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		if err := applyRequiredRoot(cmd, results...); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		if err := printResults(cmd, results, output, verbose); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+		if err := writeReport(cmd, results); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		// Files that could not be read or parsed are operational errors
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		for _, result := range results {
+			if resultFailed(cmd, result) {
+				os.Exit(ExitPolicyViolation)
+			}
 		}
 	},
 }
@@ -79,7 +299,8 @@ defaults to 443 if not specified.
 
 Example:
   mrp validate domain example.com
-  mrp validate domain example.com:8443`,
+  mrp validate domain example.com:8443
+  mrp validate domain example.com --save-chain ./example-chain`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		domain := args[0]
@@ -87,24 +308,65 @@ Example:
 		intermediates, _ := cmd.Flags().GetString("intermediates")
 		days, _ := cmd.Flags().GetInt("days")
 		verbose, _ := cmd.Flags().GetBool("verbose")
+		output, _ := cmd.Flags().GetString("output")
+		minTLS, _ := cmd.Flags().GetString("min-tls")
+		pins, _ := cmd.Flags().GetStringArray("pin")
+		checkSCT, _ := cmd.Flags().GetBool("check-sct")
+		saveChain, _ := cmd.Flags().GetString("save-chain")
+		policy := endpointPolicy{minTLS: minTLS, pins: pins, checkSCT: checkSCT}
 
 		// Parse domain and port
-		serverName := domain
-		if strings.Contains(domain, ":") {
-			parts := strings.Split(domain, ":")
-			serverName = parts[0]
-		} else {
-			domain = domain + ":443"
+		domain, serverName := parseDomain(domain)
+
+		if output == "text" {
+			fmt.Println("Trust Path Validator")
+			fmt.Println("====================")
+			fmt.Println()
+			fmt.Printf("Domain: %s\n\n", serverName)
 		}
 
-		fmt.Println("Trust Path Validator")
-		fmt.Println("====================")
-		fmt.Println()
-		fmt.Printf("Domain: %s\n\n", serverName)
+		// Fetch and validate the certificate presented by the server
+		result, err := validator.ValidateEndpoint(domain, serverName, rootStore, intermediates, days)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
 
-		// This would be implemented to fetch the certificate from the server
-		fmt.Println("Endpoint validation not implemented in this example.")
-		os.Exit(1)
+		// Keep exactly what the server sent for offline analysis
+		if saveChain != "" {
+			paths, err := validator.SavePresentedChain(result, saveChain)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(ExitError)
+			}
+			if output == "text" {
+				fmt.Printf("Saved %d presented certificates to %s\n\n", len(paths), saveChain)
+			}
+		}
+		if err := applyEndpointPolicy(result, policy); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		if err := applyRequiredRoot(cmd, result); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		// Display the result
+		if err := printResults(cmd, []*validator.ChainValidationResult{result}, output, verbose); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+		if err := writeReport(cmd, []*validator.ChainValidationResult{result}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		// Exit with status based on validation result
+		if resultFailed(cmd, result) {
+			os.Exit(ExitPolicyViolation)
+		}
 	},
 }
 
@@ -119,7 +381,8 @@ this command will connect to the domain and validate its certificate.
 
 Example:
   mrp validate domains domains.txt
-  mrp validate domains -o reports domains.txt`,
+  mrp validate domains -o reports domains.txt
+  mrp validate domains --max-concurrency 5 --rate-limit 2 domains.txt`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		domainsFile := args[0]
@@ -128,18 +391,25 @@ Example:
 		days, _ := cmd.Flags().GetInt("days")
 		outputDir, _ := cmd.Flags().GetString("output-dir")
 		summaryOnly, _ := cmd.Flags().GetBool("summary")
+		maxConcurrency, _ := cmd.Flags().GetInt("max-concurrency")
+		rateLimit, _ := cmd.Flags().GetFloat64("rate-limit")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		minTLS, _ := cmd.Flags().GetString("min-tls")
+		pins, _ := cmd.Flags().GetStringArray("pin")
+		checkSCT, _ := cmd.Flags().GetBool("check-sct")
+		policy := endpointPolicy{minTLS: minTLS, pins: pins, checkSCT: checkSCT}
 
 		// Check if file exists
 		if _, err := os.Stat(domainsFile); os.IsNotExist(err) {
 			fmt.Printf("Error: Domains file does not exist: %s\n", domainsFile)
-			os.Exit(1)
+			os.Exit(ExitError)
 		}
 
 		// Create output directory if it doesn't exist
 		if outputDir != "" {
 			if err := os.MkdirAll(outputDir, 0755); err != nil {
 				fmt.Printf("Error creating output directory: %v\n", err)
-				os.Exit(1)
+				os.Exit(ExitError)
 			}
 		}
 
@@ -147,9 +417,75 @@ Example:
 		fmt.Println("=============================================")
 		fmt.Println()
 
-		// This would be implemented to read the domains file and validate each domain
-		fmt.Println("Bulk domain validation not implemented in this example.")
-		os.Exit(1)
+		domains, err := readDomainsFile(domainsFile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		outcomes := validateDomains(domains, bulkOptions{
+			rootStore:      rootStore,
+			intermediates:  intermediates,
+			days:           days,
+			maxConcurrency: maxConcurrency,
+			rateLimit:      rateLimit,
+			timeout:        timeout,
+		})
+
+		failed, unreachable := 0, 0
+		var results []*validator.ChainValidationResult
+		for _, outcome := range outcomes {
+			var report string
+			if outcome.err != nil {
+				failed++
+				unreachable++
+				report = fmt.Sprintf("Error: %v\n", outcome.err)
+			} else {
+				if err := applyEndpointPolicy(outcome.result, policy); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(ExitError)
+				}
+				if err := applyRequiredRoot(cmd, outcome.result); err != nil {
+					fmt.Printf("Error: %v\n", err)
+					os.Exit(ExitError)
+				}
+				if resultFailed(cmd, outcome.result) {
+					failed++
+				}
+				results = append(results, outcome.result)
+				report = validator.FormatValidationResult(outcome.result, false, fingerprintFormat(cmd))
+			}
+
+			if !summaryOnly {
+				fmt.Printf("Domain: %s\n", outcome.domain)
+				fmt.Println(report)
+			}
+
+			if outputDir != "" {
+				reportPath := filepath.Join(outputDir, reportFileName(outcome.domain))
+				if err := os.WriteFile(reportPath, []byte(report), 0644); err != nil {
+					fmt.Printf("Warning: could not write report %s: %v\n", reportPath, err)
+				}
+			}
+		}
+
+		if err := writeReport(cmd, results); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(ExitError)
+		}
+
+		fmt.Println("Summary")
+		fmt.Println("-------")
+		fmt.Printf("Domains checked: %d\n", len(outcomes))
+		fmt.Printf("Valid:           %d\n", len(outcomes)-failed)
+		fmt.Printf("Failed:          %d\n", failed)
+
+		if unreachable > 0 {
+			os.Exit(ExitError)
+		}
+		if failed > 0 {
+			os.Exit(ExitPolicyViolation)
+		}
 	},
 }
 
@@ -157,20 +493,60 @@ Example:
 func init() {
 	rootCmd.AddCommand(validateCmd)
 	validateCmd.AddCommand(validateFileCmd)
+	validateCmd.AddCommand(validateDirCmd)
+	validateCmd.AddCommand(validateStoreCmd)
+	validateCmd.AddCommand(validateCSRCmd)
 	validateCmd.AddCommand(validateDomainCmd)
 	validateCmd.AddCommand(validateDomainsCmd)
 
+	validateCmd.PersistentFlags().Bool("strict", false, "Treat warnings, such as an upcoming expiry, as failures")
+	validateCmd.PersistentFlags().Bool("fail-on-warning", false, "Alias for --strict")
+	validateCmd.PersistentFlags().String("report", "", "Also write a report to this file (.json, .sarif or .txt)")
+	validateCmd.PersistentFlags().String("report-format", "", "Format of the --report file: text, json or sarif (default from its extension)")
+	validateCmd.PersistentFlags().String("require-root", "", "Only accept chains ending at the root with this SHA-256 fingerprint")
+	validateCmd.PersistentFlags().String("fingerprint-format", validator.FingerprintHex, "Fingerprint format in text output: hex or colon")
+
 	// Add flags to validateFileCmd
 	validateFileCmd.Flags().StringP("root-store", "r", "/etc/ssl/certs", "Path to the root CA certificates directory")
 	validateFileCmd.Flags().StringP("intermediates", "i", "", "Path to intermediate certificates directory")
 	validateFileCmd.Flags().IntP("days", "d", 30, "Warn if certificate expires within this many days")
 	validateFileCmd.Flags().BoolP("verbose", "v", false, "Show verbose output")
+	validateFileCmd.Flags().StringP("output", "o", "text", "Output format: text, json or sarif")
+	validateFileCmd.Flags().String("input-format", "auto", "Read the certificate as pem or der instead of detecting it")
+
+	// Add flags to validateDirCmd
+	validateDirCmd.Flags().StringP("root-store", "r", "/etc/ssl/certs", "Path to the root CA certificates directory")
+	validateDirCmd.Flags().StringP("intermediates", "i", "", "Path to intermediate certificates directory")
+	validateDirCmd.Flags().IntP("days", "d", 30, "Warn if certificate expires within this many days")
+	validateDirCmd.Flags().BoolP("verbose", "v", false, "Show verbose output")
+	validateDirCmd.Flags().StringP("output", "o", "text", "Output format: text, json or sarif")
+	validateDirCmd.Flags().String("input-format", "auto", "Read every file as pem or der instead of detecting it")
+	validateDirCmd.Flags().Int("workers", 0, "Number of files validated concurrently (0 for one per CPU)")
+
+	// Add flags to validateStoreCmd
+	validateStoreCmd.Flags().String("alias", "", "Alias (PKCS12 friendlyName) of the entry to validate")
+	addStorepassFlags(validateStoreCmd)
+	validateStoreCmd.Flags().StringP("root-store", "r", "/etc/ssl/certs", "Path to the root CA certificates directory")
+	validateStoreCmd.Flags().StringP("intermediates", "i", "", "Path to intermediate certificates directory")
+	validateStoreCmd.Flags().IntP("days", "d", 30, "Warn if certificate expires within this many days")
+	validateStoreCmd.Flags().BoolP("verbose", "v", false, "Show verbose output")
+	validateStoreCmd.Flags().StringP("output", "o", "text", "Output format: text, json or sarif")
+	validateStoreCmd.MarkFlagRequired("alias")
+
+	// Add flags to validateCSRCmd
+	validateCSRCmd.Flags().BoolP("verbose", "v", false, "Show verbose output")
+	validateCSRCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
 
 	// Add flags to validateDomainCmd
 	validateDomainCmd.Flags().StringP("root-store", "r", "/etc/ssl/certs", "Path to the root CA certificates directory")
 	validateDomainCmd.Flags().StringP("intermediates", "i", "", "Path to intermediate certificates directory")
 	validateDomainCmd.Flags().IntP("days", "d", 30, "Warn if certificate expires within this many days")
 	validateDomainCmd.Flags().BoolP("verbose", "v", false, "Show verbose output")
+	validateDomainCmd.Flags().StringP("output", "o", "text", "Output format: text, json or sarif")
+	validateDomainCmd.Flags().String("min-tls", "", "Fail if the negotiated TLS version is below this (1.0, 1.1, 1.2, 1.3)")
+	validateDomainCmd.Flags().StringArray("pin", nil, "Require a presented certificate to match this SHA-256 pin (sha256:<hex>, plain or colon hex, repeatable)")
+	validateDomainCmd.Flags().Bool("check-sct", false, "Warn if the certificate has no embedded Certificate Transparency SCTs")
+	validateDomainCmd.Flags().String("save-chain", "", "Write each certificate the server presented to this directory as numbered PEM files")
 
 	// Add flags to validateDomainsCmd
 	validateDomainsCmd.Flags().StringP("root-store", "r", "/etc/ssl/certs", "Path to the root CA certificates directory")
@@ -178,4 +554,153 @@ func init() {
 	validateDomainsCmd.Flags().IntP("days", "d", 30, "Warn if certificate expires within this many days")
 	validateDomainsCmd.Flags().StringP("output-dir", "o", "", "Directory to save validation reports")
 	validateDomainsCmd.Flags().BoolP("summary", "s", false, "Show only summary results")
+	validateDomainsCmd.Flags().Int("max-concurrency", 10, "Maximum number of domains validated at once")
+	validateDomainsCmd.Flags().Float64("rate-limit", 0, "Maximum new connections per second (0 for unlimited)")
+	validateDomainsCmd.Flags().Duration("timeout", 10*time.Second, "Connection and handshake timeout per domain")
+	validateDomainsCmd.Flags().String("min-tls", "", "Fail domains whose negotiated TLS version is below this (1.0, 1.1, 1.2, 1.3)")
+	validateDomainsCmd.Flags().StringArray("pin", nil, "Require a presented certificate to match this SHA-256 pin (sha256:<hex>, plain or colon hex, repeatable)")
+	validateDomainsCmd.Flags().Bool("check-sct", false, "Warn if certificates have no embedded Certificate Transparency SCTs")
+}
+
+// resultFailed reports whether a result should fail the command. Warnings count
+// as failures under --strict or --fail-on-warning.
+func resultFailed(cmd *cobra.Command, result *validator.ChainValidationResult) bool {
+	if !result.ValidPath || len(result.Errors) > 0 {
+		return true
+	}
+
+	strict, _ := cmd.Flags().GetBool("strict")
+	failOnWarning, _ := cmd.Flags().GetBool("fail-on-warning")
+	if strict || failOnWarning {
+		return len(result.ExpirationWarnings) > 0 || len(result.Warnings) > 0
+	}
+	return false
+}
+
+// applyRequiredRoot restricts results to chains ending at the root named by
+// --require-root, if set
+func applyRequiredRoot(cmd *cobra.Command, results ...*validator.ChainValidationResult) error {
+	fingerprint, _ := cmd.Flags().GetString("require-root")
+	if fingerprint == "" {
+		return nil
+	}
+	for _, result := range results {
+		if err := validator.RequireRoot(result, fingerprint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endpointPolicy holds the optional checks applied to endpoint results
+type endpointPolicy struct {
+	minTLS   string
+	pins     []string
+	checkSCT bool
+}
+
+// applyEndpointPolicy applies the optional TLS version floor, certificate pins
+// and Certificate Transparency check to an endpoint result
+func applyEndpointPolicy(result *validator.ChainValidationResult, policy endpointPolicy) error {
+	if policy.minTLS != "" {
+		if err := validator.EnforceMinTLS(result, policy.minTLS); err != nil {
+			return err
+		}
+	}
+	if len(policy.pins) > 0 {
+		if err := validator.CheckPins(result, policy.pins); err != nil {
+			return err
+		}
+	}
+	if policy.checkSCT {
+		validator.CheckSCTs(result)
+	}
+	return nil
+}
+
+// fingerprintFormat returns the --fingerprint-format of a validate subcommand
+func fingerprintFormat(cmd *cobra.Command) string {
+	format, _ := cmd.Flags().GetString("fingerprint-format")
+	return format
+}
+
+// printResults writes validation results to stdout in the requested output format
+func printResults(cmd *cobra.Command, results []*validator.ChainValidationResult, output string, verbose bool) error {
+	report, err := formatResults(cmd, results, output, verbose)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	return nil
+}
+
+// formatResults renders validation results in the requested output format
+func formatResults(cmd *cobra.Command, results []*validator.ChainValidationResult, output string, verbose bool) (string, error) {
+	var b strings.Builder
+	switch output {
+	case "text":
+		for _, result := range results {
+			fmt.Fprintln(&b, validator.FormatValidationResult(result, verbose, fingerprintFormat(cmd)))
+		}
+	case "json":
+		if len(results) == 1 {
+			report, err := validator.FormatValidationResultJSON(results[0])
+			if err != nil {
+				return "", fmt.Errorf("failed to build JSON report: %v", err)
+			}
+			fmt.Fprintln(&b, report)
+			break
+		}
+		reports := make([]validator.ValidationReport, 0, len(results))
+		for _, result := range results {
+			reports = append(reports, validator.NewValidationReport(result))
+		}
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to build JSON report: %v", err)
+		}
+		fmt.Fprintln(&b, string(data))
+	case "sarif":
+		report, err := validator.FormatValidationResultsSARIF(results)
+		if err != nil {
+			return "", fmt.Errorf("failed to build SARIF report: %v", err)
+		}
+		fmt.Fprintln(&b, report)
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", output)
+	}
+	return b.String(), nil
+}
+
+// writeReport writes results to the file named by --report, independently of
+// the console output format. The format is taken from --report-format or,
+// failing that, from the file extension.
+func writeReport(cmd *cobra.Command, results []*validator.ChainValidationResult) error {
+	path, _ := cmd.Flags().GetString("report")
+	if path == "" {
+		return nil
+	}
+
+	format, _ := cmd.Flags().GetString("report-format")
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			format = "json"
+		case ".sarif":
+			format = "sarif"
+		case ".txt", ".log":
+			format = "text"
+		default:
+			return fmt.Errorf("cannot infer report format from %s; use --report-format", path)
+		}
+	}
+
+	report, err := formatResults(cmd, results, format, true)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(report), 0644); err != nil {
+		return fmt.Errorf("failed to write report %s: %v", path, err)
+	}
+	return nil
 }
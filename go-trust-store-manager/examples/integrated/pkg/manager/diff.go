@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// systemBundles are the system CA bundles of the common Linux and BSD
+// distributions, in the order crypto/x509 looks for them
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Gentoo, Arch
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine, FreeBSD, OpenBSD
+	"/usr/local/etc/ssl/cert.pem",                       // FreeBSD ports
+}
+
+// macOSRootKeychain holds the roots macOS ships and trusts by default
+const macOSRootKeychain = "/System/Library/Keychains/SystemRootCertificates.keychain"
+
+// StoreDiff is the difference between two sets of certificates, matched by
+// SHA-256 fingerprint
+type StoreDiff struct {
+	OnlyInFirst  []*x509.Certificate
+	OnlyInSecond []*x509.Certificate
+	Common       int
+}
+
+// DiffCertificates compares two sets of certificates by fingerprint. The
+// certificates unique to each side keep their original order.
+func DiffCertificates(first, second []*x509.Certificate) StoreDiff {
+	var diff StoreDiff
+	inFirst := make(map[string]bool)
+	inSecond := make(map[string]bool)
+	for _, cert := range second {
+		inSecond[Fingerprint(cert)] = true
+	}
+
+	for _, cert := range first {
+		fingerprint := Fingerprint(cert)
+		if inFirst[fingerprint] {
+			continue
+		}
+		inFirst[fingerprint] = true
+		if inSecond[fingerprint] {
+			diff.Common++
+		} else {
+			diff.OnlyInFirst = append(diff.OnlyInFirst, cert)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, cert := range second {
+		fingerprint := Fingerprint(cert)
+		if !inFirst[fingerprint] && !seen[fingerprint] {
+			diff.OnlyInSecond = append(diff.OnlyInSecond, cert)
+		}
+		seen[fingerprint] = true
+	}
+	return diff
+}
+
+// ReadSystemStore returns the host's trusted root certificates and where they
+// were read from. SSL_CERT_FILE overrides the system bundle as it does for Go
+// programs. x509.SystemCertPool cannot be used because a CertPool does not
+// expose its certificates.
+func ReadSystemStore() (string, []*x509.Certificate, error) {
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		certs, err := ReadStore(file, DefaultStorePassword)
+		return file, certs, err
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd := exec.Command("security", "find-certificate", "-a", "-p", macOSRootKeychain)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", nil, fmt.Errorf("error reading %s: %v: %s", macOSRootKeychain, err, strings.TrimSpace(stderr.String()))
+		}
+		certs, err := parsePEMCertificates(stdout.Bytes(), macOSRootKeychain)
+		return macOSRootKeychain, certs, err
+	case "windows":
+		return "", nil, fmt.Errorf("reading the Windows certificate store is not supported; export it and set SSL_CERT_FILE")
+	}
+
+	for _, bundle := range systemBundles {
+		if _, err := os.Stat(bundle); err == nil {
+			certs, err := ReadStore(bundle, DefaultStorePassword)
+			return bundle, certs, err
+		}
+	}
+
+	// Fall back to a hashed certificate directory such as /etc/ssl/certs
+	dir := "/etc/ssl/certs"
+	if env := os.Getenv("SSL_CERT_DIR"); env != "" {
+		dir = env
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	var certs []*x509.Certificate
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		found, err := parsePEMCertificates(data, file)
+		if err != nil {
+			continue
+		}
+		certs = append(certs, found...)
+	}
+	if len(certs) == 0 {
+		return "", nil, fmt.Errorf("no system trust store found")
+	}
+	return dir, certs, nil
+}
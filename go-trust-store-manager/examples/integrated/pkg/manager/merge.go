@@ -0,0 +1,245 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Store formats understood by ReadStore and WriteStore
+const (
+	FormatPEM    = "PEM"
+	FormatDER    = "DER"
+	FormatJKS    = "JKS"
+	FormatPKCS12 = "PKCS12"
+)
+
+// KeytoolPath is the keytool binary used for JKS and PKCS12 stores
+var KeytoolPath = "keytool"
+
+// DefaultStorePassword is the password Java ships its cacerts store with
+const DefaultStorePassword = "changeit"
+
+// keytoolPasswordEnv carries the store password to keytool through its
+// environment, so that the password never appears in the process list
+const keytoolPasswordEnv = "MRP_KEYTOOL_STOREPASS"
+
+// keytoolCommand returns a keytool command for args that reads the store
+// password from the environment
+func keytoolCommand(password string, args ...string) *exec.Cmd {
+	cmd := exec.Command(KeytoolPath, append(args, "-storepass:env", keytoolPasswordEnv)...)
+	cmd.Env = append(os.Environ(), keytoolPasswordEnv+"="+password)
+	return cmd
+}
+
+// FormatForPath infers a store format from its file name
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jks", ".keystore", ".ts":
+		return FormatJKS
+	case ".p12", ".pfx":
+		return FormatPKCS12
+	case ".der":
+		return FormatDER
+	default:
+		if filepath.Base(path) == "cacerts" {
+			return FormatJKS
+		}
+		return FormatPEM
+	}
+}
+
+// Fingerprint returns the lowercase hex SHA-256 of a certificate's DER encoding
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadStore returns every certificate in a trust store of any supported format.
+// password opens JKS and PKCS12 stores and is ignored for other formats.
+func ReadStore(path, password string) ([]*x509.Certificate, error) {
+	switch FormatForPath(path) {
+	case FormatJKS, FormatPKCS12:
+		return readKeystore(path, FormatForPath(path), password)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	// .cer and .crt files may hold DER despite their extension
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+	return parsePEMCertificates(data, path)
+}
+
+// parsePEMCertificates parses every CERTIFICATE block in PEM data
+func parsePEMCertificates(data []byte, source string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate in %s: %v", source, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// readKeystore lists a JKS or PKCS12 store as PEM through keytool
+func readKeystore(path, format, password string) ([]*x509.Certificate, error) {
+	cmd := keytoolCommand(password, "-list", "-rfc", "-keystore", path, "-storetype", format)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error listing %s: %v: %s", path, err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+	return parsePEMCertificates(stdout.Bytes(), path)
+}
+
+// ReadEntryPEM returns the PEM certificate chain of one alias in a JKS or PKCS12
+// store. For PKCS12 stores the alias is the entry's friendlyName. Private key
+// entries yield the leaf followed by the rest of their chain.
+func ReadEntryPEM(path, alias, password string) ([]byte, error) {
+	format := FormatForPath(path)
+	if format != FormatJKS && format != FormatPKCS12 {
+		return nil, fmt.Errorf("%s is not a JKS or PKCS12 keystore", path)
+	}
+
+	cmd := keytoolCommand(password, "-list", "-rfc", "-alias", alias,
+		"-keystore", path, "-storetype", format)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error reading alias %q from %s: %v: %s", alias, path, err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+
+	certs, err := parsePEMCertificates(stdout.Bytes(), path)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("alias %q in %s holds no certificate", alias, path)
+	}
+
+	var buf bytes.Buffer
+	for _, cert := range certs {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteStore replaces out with a store holding certs, in the format implied by its
+// name. JKS and PKCS12 stores are protected with password.
+func WriteStore(out string, certs []*x509.Certificate, password string) error {
+	format := FormatForPath(out)
+	if format == FormatDER && len(certs) != 1 {
+		return fmt.Errorf("a DER file holds exactly one certificate, have %d", len(certs))
+	}
+
+	// Build the store beside the target and rename it into place
+	tmpDir, err := ioutil.TempDir(filepath.Dir(out), ".merge-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmp := filepath.Join(tmpDir, filepath.Base(out))
+
+	switch format {
+	case FormatJKS, FormatPKCS12:
+		if err := writeKeystore(tmp, format, certs, tmpDir, password); err != nil {
+			return err
+		}
+	case FormatDER:
+		if err := ioutil.WriteFile(tmp, certs[0].Raw, 0644); err != nil {
+			return fmt.Errorf("error writing %s: %v", out, err)
+		}
+	default:
+		var buf bytes.Buffer
+		for _, cert := range certs {
+			pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		}
+		if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %v", out, err)
+		}
+	}
+
+	if err := os.Rename(tmp, out); err != nil {
+		return fmt.Errorf("error replacing %s: %v", out, err)
+	}
+	return nil
+}
+
+// writeKeystore creates a new JKS or PKCS12 store by importing each certificate
+// as a trusted entry aliased by its fingerprint
+func writeKeystore(path, format string, certs []*x509.Certificate, workDir, password string) error {
+	for _, cert := range certs {
+		certFile := filepath.Join(workDir, "import.der")
+		if err := ioutil.WriteFile(certFile, cert.Raw, 0644); err != nil {
+			return fmt.Errorf("error staging certificate: %v", err)
+		}
+
+		alias := "sha256-" + Fingerprint(cert)[:16]
+		cmd := keytoolCommand(password, "-importcert", "-noprompt", "-trustcacerts",
+			"-alias", alias, "-file", certFile,
+			"-keystore", path, "-storetype", format)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error importing %s: %v: %s", cert.Subject, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// MergeStores reads the certificates of base and overlay, which may be of any
+// supported format, and writes their union to out in the format implied by its
+// name. Certificates are de-duplicated by SHA-256 fingerprint, keeping base
+// entries first in their original order. password opens and protects every
+// JKS and PKCS12 store involved.
+func MergeStores(base, overlay string, out string, password string) error {
+	var merged []*x509.Certificate
+	seen := make(map[string]bool)
+
+	for _, path := range []string{base, overlay} {
+		certs, err := ReadStore(path, password)
+		if err != nil {
+			return err
+		}
+		for _, cert := range certs {
+			fingerprint := Fingerprint(cert)
+			if seen[fingerprint] {
+				continue
+			}
+			seen[fingerprint] = true
+			merged = append(merged, cert)
+		}
+	}
+
+	if len(merged) == 0 {
+		return fmt.Errorf("no certificates found in %s or %s", base, overlay)
+	}
+	return WriteStore(out, merged, password)
+}
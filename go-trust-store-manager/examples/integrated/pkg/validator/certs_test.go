@@ -0,0 +1,129 @@
+package validator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCert is a generated certificate and the key it was issued for
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testSerial int64
+
+// newTestCert issues a certificate valid from notBefore to notAfter, signed by
+// parent or self-signed when parent is nil. CA certificates may sign others;
+// leaf certificates are issued for name as a DNS name.
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool, notBefore, notAfter time.Time) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(atomic.AddInt64(&testSerial, 1)),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{name}
+	}
+
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// testPKI is a root, an intermediate and a leaf issued through it, all
+// currently valid
+type testPKI struct {
+	root, intermediate, leaf *testCert
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	now := time.Now()
+	root := newTestCert(t, "Test Root", nil, true, now.Add(-time.Hour), now.AddDate(10, 0, 0))
+	intermediate := newTestCert(t, "Test Intermediate", root, true, now.Add(-time.Hour), now.AddDate(5, 0, 0))
+	leaf := newTestCert(t, "leaf.example.com", intermediate, false, now.Add(-time.Hour), now.AddDate(1, 0, 0))
+	return testPKI{root: root, intermediate: intermediate, leaf: leaf}
+}
+
+// writeTestPEM writes certs as a PEM bundle named name in dir and returns its path
+func writeTestPEM(t *testing.T, dir, name string, certs ...*x509.Certificate) string {
+	t.Helper()
+	var data []byte
+	for _, cert := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// validateTestChain validates chain, leaf first, against a root store holding
+// roots, warning about certificates that expire within expiryDays
+func validateTestChain(t *testing.T, chain []*x509.Certificate, roots []*x509.Certificate, expiryDays int) *ChainValidationResult {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "validate-chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := writeTestPEM(t, dir, "chain.pem", chain...)
+	rootFile := writeTestPEM(t, dir, "roots.pem", roots...)
+	result, err := ValidateFile(certFile, rootFile, "", expiryDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// crossSign issues a copy of cert's subject and key signed by parent, giving
+// a second path from the same certificate to another root
+func crossSign(t *testing.T, cert *testCert, parent *testCert) *x509.Certificate {
+	t.Helper()
+	template := *cert.cert
+	template.SerialNumber = big.NewInt(atomic.AddInt64(&testSerial, 1))
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent.cert, &cert.key.PublicKey, parent.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crossSigned, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crossSigned
+}
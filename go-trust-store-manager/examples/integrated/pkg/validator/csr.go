@@ -0,0 +1,227 @@
+package validator
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Minimum key sizes below which a public key is reported as weak
+const (
+	minRSAKeyBits   = 2048
+	minECDSAKeyBits = 256
+)
+
+// Messages recorded in CSRValidationResult
+const (
+	msgBadCSRSignature = "CSR signature is invalid"
+	msgWeakKey         = "Weak key:"
+	msgWeakSignature   = "Weak signature algorithm:"
+)
+
+// CSRValidationResult represents the validation status of a certificate signing request
+type CSRValidationResult struct {
+	Source         string
+	Request        *x509.CertificateRequest
+	SignatureValid bool
+	KeyType        string
+	KeyBits        int
+	Warnings       []string
+	Errors         []string
+}
+
+// CSRReport is the JSON representation of a CSRValidationResult
+type CSRReport struct {
+	Source             string   `json:"source,omitempty"`
+	Subject            string   `json:"subject"`
+	DNSNames           []string `json:"dns_names"`
+	IPAddresses        []string `json:"ip_addresses"`
+	EmailAddresses     []string `json:"email_addresses"`
+	KeyType            string   `json:"key_type"`
+	KeyBits            int      `json:"key_bits"`
+	SignatureAlgorithm string   `json:"signature_algorithm"`
+	SignatureValid     bool     `json:"signature_valid"`
+	Warnings           []string `json:"warnings"`
+	Errors             []string `json:"errors"`
+}
+
+// ValidateCSRFile validates a PEM or DER certificate signing request file
+func ValidateCSRFile(csrFile string) (*CSRValidationResult, error) {
+	data, err := ioutil.ReadFile(csrFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSR: %v", err)
+	}
+
+	result, err := ValidateCSR(data)
+	if err != nil {
+		return nil, err
+	}
+	result.Source = csrFile
+	return result, nil
+}
+
+// ValidateCSR parses a PKCS#10 certificate signing request, verifies its
+// self-signature and flags weak keys and signature algorithms
+func ValidateCSR(data []byte) (*CSRValidationResult, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("expected a CERTIFICATE REQUEST PEM block, found %s", block.Type)
+		}
+		der = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CSR: %v", err)
+	}
+
+	result := &CSRValidationResult{Request: csr}
+	if err := csr.CheckSignature(); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", msgBadCSRSignature, err))
+	} else {
+		result.SignatureValid = true
+	}
+
+	var weakness string
+	result.KeyType, result.KeyBits, weakness = keyStrength(csr.PublicKey)
+	if weakness != "" {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s %s", msgWeakKey, weakness))
+	}
+
+	switch csr.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s %s", msgWeakSignature, csr.SignatureAlgorithm))
+	}
+
+	if len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 && len(csr.EmailAddresses) == 0 && len(csr.URIs) == 0 {
+		result.Warnings = append(result.Warnings, "CSR requests no Subject Alternative Names")
+	}
+
+	return result, nil
+}
+
+// keyStrength returns a public key's algorithm and size, and a description of
+// why it is weak, or "" if it meets the minimum sizes
+func keyStrength(pub interface{}) (string, int, string) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		bits := key.N.BitLen()
+		if bits < minRSAKeyBits {
+			return "RSA", bits, fmt.Sprintf("RSA key is %d bits, below the %d-bit minimum", bits, minRSAKeyBits)
+		}
+		return "RSA", bits, ""
+	case *ecdsa.PublicKey:
+		bits := key.Curve.Params().BitSize
+		if bits < minECDSAKeyBits {
+			return "ECDSA", bits, fmt.Sprintf("ECDSA key is %d bits, below the %d-bit minimum", bits, minECDSAKeyBits)
+		}
+		return "ECDSA", bits, ""
+	case ed25519.PublicKey:
+		return "Ed25519", 256, ""
+	case *dsa.PublicKey:
+		bits := key.P.BitLen()
+		return "DSA", bits, "DSA keys are deprecated"
+	default:
+		return "unknown", 0, fmt.Sprintf("unsupported public key type %T", pub)
+	}
+}
+
+// FormatCSRResult formats a CSR validation result as a string
+func FormatCSRResult(result *CSRValidationResult, verbose bool) string {
+	var output strings.Builder
+	csr := result.Request
+
+	fmt.Fprintf(&output, "Subject: %s\n", csr.Subject.String())
+	if len(csr.DNSNames) > 0 {
+		fmt.Fprintf(&output, "DNS Names: %s\n", strings.Join(csr.DNSNames, ", "))
+	}
+	if len(csr.IPAddresses) > 0 {
+		ips := make([]string, 0, len(csr.IPAddresses))
+		for _, ip := range csr.IPAddresses {
+			ips = append(ips, ip.String())
+		}
+		fmt.Fprintf(&output, "IP Addresses: %s\n", strings.Join(ips, ", "))
+	}
+	if len(csr.EmailAddresses) > 0 {
+		fmt.Fprintf(&output, "Email Addresses: %s\n", strings.Join(csr.EmailAddresses, ", "))
+	}
+	fmt.Fprintf(&output, "Public Key: %s %d bits\n", result.KeyType, result.KeyBits)
+	fmt.Fprintf(&output, "Signature Algorithm: %s\n", csr.SignatureAlgorithm)
+
+	fmt.Fprintf(&output, "\nCSR Validation Result:\n")
+	if result.SignatureValid {
+		fmt.Fprintf(&output, "✅ Self-signature is valid\n")
+	} else {
+		fmt.Fprintf(&output, "❌ Self-signature is NOT valid\n")
+	}
+
+	if len(result.Warnings) > 0 {
+		fmt.Fprintf(&output, "\nWarnings:\n")
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(&output, "⚠️  %s\n", warning)
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(&output, "\nErrors:\n")
+		for _, err := range result.Errors {
+			fmt.Fprintf(&output, "❌ %s\n", err)
+		}
+	}
+
+	if verbose && len(csr.Extensions) > 0 {
+		fmt.Fprintf(&output, "\nRequested Extensions:\n")
+		for _, ext := range csr.Extensions {
+			fmt.Fprintf(&output, "- %s (critical: %t)\n", ext.Id, ext.Critical)
+		}
+	}
+
+	return output.String()
+}
+
+// FormatCSRResultJSON formats a CSR validation result as indented JSON
+func FormatCSRResultJSON(result *CSRValidationResult) (string, error) {
+	csr := result.Request
+	report := CSRReport{
+		Source:             result.Source,
+		Subject:            csr.Subject.String(),
+		DNSNames:           csr.DNSNames,
+		IPAddresses:        []string{},
+		EmailAddresses:     csr.EmailAddresses,
+		KeyType:            result.KeyType,
+		KeyBits:            result.KeyBits,
+		SignatureAlgorithm: csr.SignatureAlgorithm.String(),
+		SignatureValid:     result.SignatureValid,
+		Warnings:           result.Warnings,
+		Errors:             result.Errors,
+	}
+	for _, ip := range csr.IPAddresses {
+		report.IPAddresses = append(report.IPAddresses, ip.String())
+	}
+	if report.DNSNames == nil {
+		report.DNSNames = []string{}
+	}
+	if report.EmailAddresses == nil {
+		report.EmailAddresses = []string{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	if report.Errors == nil {
+		report.Errors = []string{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,92 @@
+package validator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DirectoryOptions controls how ValidateDirectory validates certificate files
+type DirectoryOptions struct {
+	RootStorePath    string
+	IntermediatePath string
+	ExpiryDays       int
+	// InputFormat forces every file to be read as FormatPEM or FormatDER
+	InputFormat string
+	// Workers is the number of files validated concurrently; 0 uses GOMAXPROCS
+	Workers int
+}
+
+// ValidateDirectory walks dir and validates every .pem, .crt, .cert, .cer and .der file
+// using a pool of workers that share the cached root and intermediate pools.
+// Results are returned in walk order. Files that cannot be validated are left
+// out of the results and reported together in the returned error.
+func ValidateDirectory(dir string, opts DirectoryOptions) ([]*ChainValidationResult, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		switch ext {
+		case ".pem", ".crt", ".cert", ".cer", ".der":
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %v", err)
+	}
+
+	// Load the shared pools up front so a bad trust store fails once, not per file
+	if _, _, err := buildPools(opts.RootStorePath, opts.IntermediatePath); err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	results := make([]*ChainValidationResult, len(files))
+	errs := make([]error, len(files))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = ValidateFileFormat(files[i], opts.InputFormat, opts.RootStorePath, opts.IntermediatePath, opts.ExpiryDays)
+			}
+		}()
+	}
+	for i := range files {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var validated []*ChainValidationResult
+	var failures []string
+	for i, result := range results {
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", files[i], errs[i]))
+			continue
+		}
+		validated = append(validated, result)
+	}
+
+	if len(failures) > 0 {
+		return validated, fmt.Errorf("%d of %d files could not be validated: %s",
+			len(failures), len(files), strings.Join(failures, "; "))
+	}
+	return validated, nil
+}
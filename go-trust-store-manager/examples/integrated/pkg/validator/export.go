@@ -0,0 +1,39 @@
+package validator
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SavePresentedChain writes each certificate an endpoint presented, in the order
+// it was sent, to dir as numbered PEM files such as 0-leaf.pem and
+// 1-intermediate.pem. It returns the paths written.
+func SavePresentedChain(result *ChainValidationResult, dir string) ([]string, error) {
+	if len(result.PresentedChain) == 0 {
+		return nil, fmt.Errorf("no presented certificates to save")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating %s: %v", dir, err)
+	}
+
+	var paths []string
+	for i, cert := range result.PresentedChain {
+		role := "intermediate"
+		switch {
+		case i == 0:
+			role = "leaf"
+		case isSelfSigned(cert):
+			role = "root"
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%d-%s.pem", i, role))
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return paths, fmt.Errorf("error writing %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
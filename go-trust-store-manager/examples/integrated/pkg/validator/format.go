@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// Input formats accepted by ParseCertificates and ValidateFileFormat
+const (
+	FormatAuto = "auto"
+	FormatPEM  = "pem"
+	FormatDER  = "der"
+)
+
+// ParseCertificates parses certificate data in the given input format. FormatPEM
+// also accepts base64 without the BEGIN/END lines, and FormatDER accepts several
+// concatenated certificates. FormatAuto treats data with a PEM header as PEM and
+// anything else as DER.
+func ParseCertificates(data []byte, format string) ([]*x509.Certificate, error) {
+	switch strings.ToLower(format) {
+	case FormatAuto, "":
+		if bytes.Contains(data, []byte("-----BEGIN")) {
+			return parsePEM(data)
+		}
+		return parseDER(data)
+	case FormatPEM:
+		return parsePEM(data)
+	case FormatDER:
+		return parseDER(data)
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s (expected auto, pem or der)", format)
+	}
+}
+
+// parsePEM parses every CERTIFICATE block in PEM data, falling back to
+// headerless base64 when there are no PEM blocks at all
+func parsePEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate PEM data")
+	}
+	return parseDER(der)
+}
+
+// parseDER parses one or more concatenated DER certificates
+func parseDER(data []byte) ([]*x509.Certificate, error) {
+	certs, err := x509.ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DER certificate: %v", err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in DER data")
+	}
+	return certs, nil
+}
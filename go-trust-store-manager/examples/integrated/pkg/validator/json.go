@@ -0,0 +1,142 @@
+package validator
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ValidationReport is the JSON representation of a ChainValidationResult
+type ValidationReport struct {
+	Source             string              `json:"source,omitempty"`
+	Subject            string              `json:"subject"`
+	Issuer             string              `json:"issuer"`
+	NotBefore          string              `json:"not_before"`
+	NotAfter           string              `json:"not_after"`
+	ValidPath          bool                `json:"valid_path"`
+	CompleteChain      bool                `json:"complete_chain"`
+	RootTrusted        bool                `json:"root_trusted"`
+	PinMatched         *bool               `json:"pin_matched,omitempty"`
+	SCTCount           *int                `json:"sct_count,omitempty"`
+	TLSVersion         string              `json:"tls_version,omitempty"`
+	CipherSuite        string              `json:"cipher_suite,omitempty"`
+	ExpirationWarnings []string            `json:"expiration_warnings"`
+	Warnings           []string            `json:"warnings"`
+	Errors             []string            `json:"errors"`
+	TrustAnchor        *TrustAnchorReport  `json:"trust_anchor,omitempty"`
+	Chain              []CertificateReport `json:"chain"`
+}
+
+// TrustAnchorReport identifies the root certificate that anchored a valid chain
+type TrustAnchorReport struct {
+	Subject string `json:"subject"`
+	SHA256  string `json:"sha256"`
+}
+
+// CertificateReport is the JSON representation of one certificate in a chain
+type CertificateReport struct {
+	Role      string `json:"role"`
+	Subject   string `json:"subject"`
+	Issuer    string `json:"issuer"`
+	Serial    string `json:"serial"`
+	SHA256    string `json:"sha256"`
+	NotBefore string `json:"not_before"`
+	NotAfter  string `json:"not_after"`
+	// DaysUntilExpiry is negative once the certificate has expired
+	DaysUntilExpiry int  `json:"days_until_expiry"`
+	IsCA            bool `json:"is_ca"`
+}
+
+// chainRole names a certificate's position in a chain: the leaf comes first, and
+// the last certificate of a verified chain is the root. In an unverified chain
+// any later self-signed CA is a root.
+func chainRole(result *ChainValidationResult, index int) string {
+	switch {
+	case index == 0:
+		return "leaf"
+	case result.CompleteChain && index == len(result.Chain)-1:
+		return "root"
+	case !result.CompleteChain && isSelfSigned(result.Chain[index]):
+		return "root"
+	default:
+		return "intermediate"
+	}
+}
+
+// NewValidationReport converts a validation result into its JSON representation
+func NewValidationReport(result *ChainValidationResult) ValidationReport {
+	report := ValidationReport{
+		Source:             result.Source,
+		Subject:            result.LeafCertificate.Subject.String(),
+		Issuer:             result.LeafCertificate.Issuer.String(),
+		NotBefore:          result.LeafCertificate.NotBefore.Format(time.RFC3339),
+		NotAfter:           result.LeafCertificate.NotAfter.Format(time.RFC3339),
+		ValidPath:          result.ValidPath,
+		CompleteChain:      result.CompleteChain,
+		RootTrusted:        result.RootTrusted,
+		ExpirationWarnings: result.ExpirationWarnings,
+		Warnings:           result.Warnings,
+		Errors:             result.Errors,
+	}
+
+	now := time.Now()
+	report.Chain = make([]CertificateReport, 0, len(result.Chain))
+	for i, cert := range result.Chain {
+		report.Chain = append(report.Chain, CertificateReport{
+			Role:            chainRole(result, i),
+			Subject:         cert.Subject.String(),
+			Issuer:          cert.Issuer.String(),
+			Serial:          fmt.Sprintf("%X", cert.SerialNumber),
+			SHA256:          certificateFingerprint(cert),
+			NotBefore:       cert.NotBefore.Format(time.RFC3339),
+			NotAfter:        cert.NotAfter.Format(time.RFC3339),
+			IsCA:            cert.IsCA,
+			DaysUntilExpiry: daysUntil(cert.NotAfter, now),
+		})
+	}
+
+	if result.TrustAnchor != nil {
+		report.TrustAnchor = &TrustAnchorReport{
+			Subject: result.TrustAnchor.Subject.String(),
+			SHA256:  certificateFingerprint(result.TrustAnchor),
+		}
+	}
+
+	if result.PinChecked {
+		pinMatched := result.PinMatched
+		report.PinMatched = &pinMatched
+	}
+
+	if result.SCTChecked {
+		sctCount := result.SCTCount
+		report.SCTCount = &sctCount
+	}
+
+	if result.TLSVersion != 0 {
+		report.TLSVersion = tlsVersionName(result.TLSVersion)
+		report.CipherSuite = tls.CipherSuiteName(result.CipherSuite)
+	}
+
+	// Always emit arrays so consumers don't have to handle null
+	if report.ExpirationWarnings == nil {
+		report.ExpirationWarnings = []string{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	if report.Errors == nil {
+		report.Errors = []string{}
+	}
+
+	return report
+}
+
+// FormatValidationResultJSON formats a validation result as indented JSON
+func FormatValidationResultJSON(result *ChainValidationResult) (string, error) {
+	data, err := json.MarshalIndent(NewValidationReport(result), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
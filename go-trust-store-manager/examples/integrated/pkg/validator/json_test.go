@@ -0,0 +1,135 @@
+package validator
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewValidationReportChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "json-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pki := newTestPKI(t)
+	now := time.Now()
+	otherRoot := newTestCert(t, "Other Root", nil, true, now.Add(-time.Hour), now.AddDate(10, 0, 0))
+	trusted := writeTestPEM(t, dir, "trusted.pem", pki.root.cert)
+	untrusted := writeTestPEM(t, dir, "untrusted.pem", otherRoot.cert)
+
+	tests := []struct {
+		name      string
+		certs     []*x509.Certificate
+		roots     string
+		wantValid bool
+		wantRoles []string
+	}{
+		{"verified chain", []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert}, trusted, true, []string{"leaf", "intermediate", "root"}},
+		{"untrusted chain", []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert}, untrusted, false, []string{"leaf", "intermediate"}},
+		{"untrusted chain with its root", []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert, pki.root.cert}, untrusted, false, []string{"leaf", "intermediate", "root"}},
+		{"leaf only", []*x509.Certificate{pki.leaf.cert}, untrusted, false, []string{"leaf"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile := writeTestPEM(t, dir, fmt.Sprintf("cert%d.pem", i), tt.certs...)
+			result, err := ValidateFile(certFile, tt.roots, "", 30)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report := NewValidationReport(result)
+			if report.ValidPath != tt.wantValid {
+				t.Errorf("valid_path = %v, want %v", report.ValidPath, tt.wantValid)
+			}
+			if len(report.Chain) != len(tt.wantRoles) {
+				t.Fatalf("chain has %d certificates, want %d", len(report.Chain), len(tt.wantRoles))
+			}
+			for j, want := range tt.wantRoles {
+				if report.Chain[j].Role != want {
+					t.Errorf("chain[%d].role = %q, want %q", j, report.Chain[j].Role, want)
+				}
+				if report.Chain[j].Subject == "" || report.Chain[j].SHA256 == "" {
+					t.Errorf("chain[%d] is missing its subject or fingerprint: %+v", j, report.Chain[j])
+				}
+			}
+		})
+	}
+}
+
+func TestFormatValidationResultJSONShape(t *testing.T) {
+	pki := newTestPKI(t)
+	now := time.Now()
+	expiredLeaf := newTestCert(t, "expired.example.com", pki.intermediate, false, now.AddDate(-1, 0, 0), now.Add(-24*time.Hour))
+
+	tests := []struct {
+		name            string
+		chain           []*x509.Certificate
+		wantTrustAnchor bool
+		wantErrors      bool
+		wantDays        []int
+	}{
+		{"valid chain", []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert}, true, false, nil},
+		{"expired leaf", []*x509.Certificate{expiredLeaf.cert, pki.intermediate.cert}, false, true, []int{-1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := validateTestChain(t, tt.chain, []*x509.Certificate{pki.root.cert}, 30)
+			output, err := FormatValidationResultJSON(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var report map[string]interface{}
+			if err := json.Unmarshal([]byte(output), &report); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, output)
+			}
+			for _, key := range []string{"subject", "issuer", "not_before", "not_after", "valid_path", "complete_chain", "root_trusted"} {
+				if _, ok := report[key]; !ok {
+					t.Errorf("report is missing %q", key)
+				}
+			}
+			// Lists are always arrays, never null
+			for _, key := range []string{"expiration_warnings", "warnings", "errors", "chain"} {
+				if _, ok := report[key].([]interface{}); !ok {
+					t.Errorf("%q is %v, want an array", key, report[key])
+				}
+			}
+			// Optional checks are omitted unless they ran
+			for _, key := range []string{"pin_matched", "sct_count", "tls_version", "cipher_suite"} {
+				if _, ok := report[key]; ok {
+					t.Errorf("report has %q although that check did not run", key)
+				}
+			}
+			if _, ok := report["trust_anchor"]; ok != tt.wantTrustAnchor {
+				t.Errorf("trust_anchor present = %v, want %v", ok, tt.wantTrustAnchor)
+			}
+			if errs, _ := report["errors"].([]interface{}); (len(errs) > 0) != tt.wantErrors {
+				t.Errorf("errors = %v, want errors %v", errs, tt.wantErrors)
+			}
+
+			chain, _ := report["chain"].([]interface{})
+			if len(chain) < len(tt.chain) {
+				t.Fatalf("chain has %d certificates, want at least %d", len(chain), len(tt.chain))
+			}
+			for i, entry := range chain {
+				cert, _ := entry.(map[string]interface{})
+				for _, key := range []string{"role", "subject", "issuer", "serial", "sha256", "not_before", "not_after", "days_until_expiry", "is_ca"} {
+					if _, ok := cert[key]; !ok {
+						t.Errorf("chain[%d] is missing %q", i, key)
+					}
+				}
+			}
+			for i, want := range tt.wantDays {
+				if got := chain[i].(map[string]interface{})["days_until_expiry"]; got != float64(want) {
+					t.Errorf("chain[%d].days_until_expiry = %v, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
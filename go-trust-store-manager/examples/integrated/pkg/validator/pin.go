@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Fingerprint display formats accepted by FormatFingerprint
+const (
+	FingerprintHex   = "hex"   // lowercase plain hex, as used in JSON reports
+	FingerprintColon = "colon" // uppercase colon-separated hex, as printed by openssl and keytool
+)
+
+// certificateFingerprint returns the lowercase hex SHA-256 of a certificate's DER encoding
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// FormatFingerprint renders a lowercase hex digest in the given display format
+func FormatFingerprint(digest string, format string) string {
+	if format != FingerprintColon {
+		return digest
+	}
+
+	upper := strings.ToUpper(digest)
+	pairs := make([]string, 0, len(upper)/2)
+	for i := 0; i+1 < len(upper); i += 2 {
+		pairs = append(pairs, upper[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// parsePin parses a SHA-256 pin, with or without its "sha256:" prefix, into a
+// lowercase hex digest
+func parsePin(pin string) (string, error) {
+	// A two-character prefix is the first byte of a colon-separated fingerprint
+	if prefix, _, found := strings.Cut(pin, ":"); found && len(prefix) != 2 && !strings.EqualFold(prefix, "sha256") {
+		return "", fmt.Errorf("unsupported pin %q (expected sha256:<hex>)", pin)
+	}
+	return NormalizeFingerprint(pin)
+}
+
+// NormalizeFingerprint parses a SHA-256 fingerprint in any common form into a
+// lowercase hex digest. An optional "sha256:" prefix, colon or space separators
+// and either case are accepted, so openssl, keytool and plain hex forms compare equal.
+func NormalizeFingerprint(fingerprint string) (string, error) {
+	digest := strings.ToLower(strings.TrimSpace(fingerprint))
+	digest = strings.TrimPrefix(digest, "sha256:")
+	digest = strings.NewReplacer(":", "", " ", "").Replace(digest)
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fingerprint)
+	}
+	return digest, nil
+}
+
+// CheckPins confirms that at least one certificate the endpoint presented matches
+// one of the pinned SHA-256 fingerprints. The outcome is recorded independently
+// of trust path validation, since a trusted chain may still not be the pinned one.
+func CheckPins(result *ChainValidationResult, pins []string) error {
+	digests := make(map[string]bool)
+	for _, pin := range pins {
+		digest, err := parsePin(pin)
+		if err != nil {
+			return err
+		}
+		digests[digest] = true
+	}
+
+	result.PinChecked = true
+	result.PinMatched = false
+	for _, cert := range result.PresentedChain {
+		if digests[certificateFingerprint(cert)] {
+			result.PinMatched = true
+			result.PinnedCertificate = cert
+			break
+		}
+	}
+
+	if !result.PinMatched {
+		result.Errors = append(result.Errors,
+			fmt.Sprintf("%s: none of the %d presented certificates match", msgPinMismatch, len(result.PresentedChain)))
+	}
+	return nil
+}
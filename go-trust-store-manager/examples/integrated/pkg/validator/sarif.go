@@ -0,0 +1,180 @@
+package validator
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// sarifVersion and sarifSchema identify the SARIF specification emitted
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// sarifRule describes a class of finding reported by the validator
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	DefaultConfig    sarifConfig  `json:"defaultConfiguration"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRules lists every rule the validator can report, keyed by rule id
+var sarifRules = []sarifRule{
+	{ID: "TSM001", Name: "ExpiredCertificate", ShortDescription: sarifMessage{"Certificate has expired"}, DefaultConfig: sarifConfig{"error"}},
+	{ID: "TSM002", Name: "NotYetValidCertificate", ShortDescription: sarifMessage{"Certificate is not yet valid"}, DefaultConfig: sarifConfig{"error"}},
+	{ID: "TSM003", Name: "BrokenChain", ShortDescription: sarifMessage{"Certificate chain does not verify to a trusted root"}, DefaultConfig: sarifConfig{"error"}},
+	{ID: "TSM004", Name: "ExpiringCertificate", ShortDescription: sarifMessage{"Certificate expires within the warning window"}, DefaultConfig: sarifConfig{"warning"}},
+	{ID: "TSM005", Name: "UntrustedRoot", ShortDescription: sarifMessage{"Chain does not terminate at a self-signed trusted root"}, DefaultConfig: sarifConfig{"warning"}},
+	{ID: "TSM006", Name: "InsecureTLS", ShortDescription: sarifMessage{"Endpoint negotiated a deprecated protocol or weak cipher suite"}, DefaultConfig: sarifConfig{"warning"}},
+	{ID: "TSM007", Name: "TLSVersionBelowMinimum", ShortDescription: sarifMessage{"Endpoint negotiated a TLS version below the required minimum"}, DefaultConfig: sarifConfig{"error"}},
+	{ID: "TSM008", Name: "PinMismatch", ShortDescription: sarifMessage{"No presented certificate matches the configured pins"}, DefaultConfig: sarifConfig{"error"}},
+	{ID: "TSM009", Name: "MissingSCT", ShortDescription: sarifMessage{"Leaf certificate has no embedded Certificate Transparency SCTs"}, DefaultConfig: sarifConfig{"warning"}},
+	{ID: "TSM010", Name: "RequiredRootMismatch", ShortDescription: sarifMessage{"Chain does not terminate at the required root"}, DefaultConfig: sarifConfig{"error"}},
+	{ID: "TSM011", Name: "MissingSAN", ShortDescription: sarifMessage{"Leaf certificate has no Subject Alternative Names"}, DefaultConfig: sarifConfig{"warning"}},
+	{ID: "TSM000", Name: "ValidationError", ShortDescription: sarifMessage{"Other certificate validation error"}, DefaultConfig: sarifConfig{"error"}},
+}
+
+// classifyError maps a validation error message onto its SARIF rule id
+func classifyError(message string) string {
+	switch {
+	case strings.HasPrefix(message, msgExpired):
+		return "TSM001"
+	case strings.HasPrefix(message, msgNotYetValid):
+		return "TSM002"
+	case strings.HasPrefix(message, msgChainFailed):
+		return "TSM003"
+	case strings.HasPrefix(message, msgTLSTooOld):
+		return "TSM007"
+	case strings.HasPrefix(message, msgPinMismatch):
+		return "TSM008"
+	case strings.HasPrefix(message, msgWrongRoot):
+		return "TSM010"
+	default:
+		return "TSM000"
+	}
+}
+
+// classifyWarning maps a validation warning message onto its SARIF rule id
+func classifyWarning(message string) string {
+	switch {
+	case strings.HasPrefix(message, msgInsecureProtocol), strings.HasPrefix(message, msgWeakCipher):
+		return "TSM006"
+	case strings.HasPrefix(message, msgNoSCT):
+		return "TSM009"
+	case strings.HasPrefix(message, msgNoSAN):
+		return "TSM011"
+	default:
+		return "TSM004"
+	}
+}
+
+// FormatValidationResultsSARIF renders validation results as a SARIF 2.1.0 log.
+// Every error and warning becomes a result located at the result's Source.
+func FormatValidationResultsSARIF(results []*ChainValidationResult) (string, error) {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "mrp", Rules: sarifRules}},
+		Results: []sarifResult{},
+	}
+
+	for _, result := range results {
+		location := []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: result.Source},
+		}}}
+
+		for _, err := range result.Errors {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    classifyError(err),
+				Level:     "error",
+				Message:   sarifMessage{err},
+				Locations: location,
+			})
+		}
+
+		for _, warning := range result.ExpirationWarnings {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    "TSM004",
+				Level:     "warning",
+				Message:   sarifMessage{warning},
+				Locations: location,
+			})
+		}
+
+		for _, warning := range result.Warnings {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    classifyWarning(warning),
+				Level:     "warning",
+				Message:   sarifMessage{warning},
+				Locations: location,
+			})
+		}
+
+		if result.ValidPath && !result.RootTrusted {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    "TSM005",
+				Level:     "warning",
+				Message:   sarifMessage{"Root certificate is NOT trusted"},
+				Locations: location,
+			})
+		}
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
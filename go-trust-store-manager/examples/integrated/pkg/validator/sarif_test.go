@@ -0,0 +1,123 @@
+package validator
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFormatValidationResultsSARIF(t *testing.T) {
+	pki := newTestPKI(t)
+	now := time.Now()
+	expiredLeaf := newTestCert(t, "expired.example.com", pki.intermediate, false, now.AddDate(-1, 0, 0), now.Add(-24*time.Hour))
+
+	valid := validateTestChain(t, []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert}, []*x509.Certificate{pki.root.cert}, 30)
+	valid.Source = "certs/valid.pem"
+	expired := validateTestChain(t, []*x509.Certificate{expiredLeaf.cert, pki.intermediate.cert}, []*x509.Certificate{pki.root.cert}, 30)
+	expired.Source = "certs/expired.pem"
+	// Trusting the intermediate directly anchors the chain below a root
+	anchored := validateTestChain(t, []*x509.Certificate{pki.leaf.cert}, []*x509.Certificate{pki.intermediate.cert}, 30)
+	anchored.Source = "certs/anchored.pem"
+	wrongRoot := validateTestChain(t, []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert}, []*x509.Certificate{pki.root.cert}, 30)
+	wrongRoot.Source = "certs/wrong-root.pem"
+	if err := RequireRoot(wrongRoot, certificateFingerprint(pki.intermediate.cert)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		result      *ChainValidationResult
+		wantRuleIDs []string
+	}{
+		{"valid certificate", valid, nil},
+		{"expired leaf", expired, []string{"TSM001", "TSM003"}},
+		{"chain anchored below a root", anchored, []string{"TSM005"}},
+		{"required root mismatch", wrongRoot, []string{"TSM010"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := FormatValidationResultsSARIF([]*ChainValidationResult{tt.result})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var log struct {
+				Schema  string `json:"$schema"`
+				Version string `json:"version"`
+				Runs    []struct {
+					Tool struct {
+						Driver struct {
+							Name  string `json:"name"`
+							Rules []struct {
+								ID string `json:"id"`
+							} `json:"rules"`
+						} `json:"driver"`
+					} `json:"tool"`
+					Results []struct {
+						RuleID    string                `json:"ruleId"`
+						Level     string                `json:"level"`
+						Message   struct{ Text string } `json:"message"`
+						Locations []struct {
+							PhysicalLocation struct {
+								ArtifactLocation struct {
+									URI string `json:"uri"`
+								} `json:"artifactLocation"`
+							} `json:"physicalLocation"`
+						} `json:"locations"`
+					} `json:"results"`
+				} `json:"runs"`
+			}
+			if err := json.Unmarshal([]byte(output), &log); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, output)
+			}
+
+			if log.Version != sarifVersion || log.Schema != sarifSchema {
+				t.Errorf("version %q schema %q, want %q %q", log.Version, log.Schema, sarifVersion, sarifSchema)
+			}
+			if len(log.Runs) != 1 {
+				t.Fatalf("got %d runs, want 1", len(log.Runs))
+			}
+			run := log.Runs[0]
+			if run.Tool.Driver.Name != "mrp" || len(run.Tool.Driver.Rules) != len(sarifRules) {
+				t.Errorf("driver %q with %d rules, want mrp with %d", run.Tool.Driver.Name, len(run.Tool.Driver.Rules), len(sarifRules))
+			}
+			rules := make(map[string]bool)
+			for _, rule := range run.Tool.Driver.Rules {
+				rules[rule.ID] = true
+			}
+
+			// Results must be an array, never null, so consumers can iterate it
+			if run.Results == nil {
+				t.Fatalf("results missing from %s", output)
+			}
+
+			var ruleIDs []string
+			for _, result := range run.Results {
+				ruleIDs = append(ruleIDs, result.RuleID)
+				if !rules[result.RuleID] {
+					t.Errorf("result uses undeclared rule %s", result.RuleID)
+				}
+				if result.Level != "error" && result.Level != "warning" {
+					t.Errorf("result %s has level %q", result.RuleID, result.Level)
+				}
+				if result.Message.Text == "" {
+					t.Errorf("result %s has no message", result.RuleID)
+				}
+				if len(result.Locations) != 1 || result.Locations[0].PhysicalLocation.ArtifactLocation.URI != tt.result.Source {
+					t.Errorf("result %s is not located at %s", result.RuleID, tt.result.Source)
+				}
+			}
+			sort.Strings(ruleIDs)
+			if len(ruleIDs) != len(tt.wantRuleIDs) {
+				t.Fatalf("rule ids %v, want %v", ruleIDs, tt.wantRuleIDs)
+			}
+			for i := range ruleIDs {
+				if ruleIDs[i] != tt.wantRuleIDs[i] {
+					t.Errorf("rule ids %v, want %v", ruleIDs, tt.wantRuleIDs)
+				}
+			}
+		})
+	}
+}
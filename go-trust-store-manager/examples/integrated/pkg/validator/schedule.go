@@ -0,0 +1,153 @@
+package validator
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ExpiryEntry is one certificate in a renewal schedule. A certificate found in
+// several stores appears once, listing every store it was found in.
+type ExpiryEntry struct {
+	Subject  string
+	SHA256   string
+	IsCA     bool
+	NotAfter time.Time
+	// RenewBy is NotAfter less the schedule's lead time
+	RenewBy time.Time
+	Sources []string
+}
+
+// ExpirySchedule collects certificates from any number of stores into a
+// renewal schedule ordered by expiry
+type ExpirySchedule struct {
+	lead    time.Duration
+	entries map[string]*ExpiryEntry
+}
+
+// NewExpirySchedule creates an empty schedule that plans each renewal lead
+// before the certificate expires
+func NewExpirySchedule(lead time.Duration) *ExpirySchedule {
+	return &ExpirySchedule{lead: lead, entries: make(map[string]*ExpiryEntry)}
+}
+
+// Add records the certificates found in source
+func (s *ExpirySchedule) Add(source string, certs []*x509.Certificate) {
+	for _, cert := range certs {
+		fingerprint := certificateFingerprint(cert)
+		entry, ok := s.entries[fingerprint]
+		if !ok {
+			entry = &ExpiryEntry{
+				Subject:  cert.Subject.String(),
+				SHA256:   fingerprint,
+				IsCA:     cert.IsCA,
+				NotAfter: cert.NotAfter,
+				RenewBy:  cert.NotAfter.Add(-s.lead),
+			}
+			s.entries[fingerprint] = entry
+		}
+		entry.Sources = append(entry.Sources, source)
+	}
+}
+
+// Entries returns the scheduled certificates ordered by expiry, optionally
+// limited to those whose renewal falls before until (the zero time keeps all)
+func (s *ExpirySchedule) Entries(until time.Time) []ExpiryEntry {
+	var entries []ExpiryEntry
+	for _, entry := range s.entries {
+		if !until.IsZero() && entry.RenewBy.After(until) {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].NotAfter.Equal(entries[j].NotAfter) {
+			return entries[i].NotAfter.Before(entries[j].NotAfter)
+		}
+		return entries[i].SHA256 < entries[j].SHA256
+	})
+	return entries
+}
+
+// certificateKind names an entry as a leaf or CA certificate
+func certificateKind(entry ExpiryEntry) string {
+	if entry.IsCA {
+		return "CA"
+	}
+	return "leaf"
+}
+
+// FormatScheduleText formats a renewal schedule as a table
+func FormatScheduleText(entries []ExpiryEntry) string {
+	if len(entries) == 0 {
+		return "No certificates to renew.\n"
+	}
+
+	var output strings.Builder
+	now := time.Now()
+	w := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RENEW BY\tEXPIRES\tDAYS LEFT\tTYPE\tSUBJECT\tSOURCE")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			entry.RenewBy.Format("2006-01-02"), entry.NotAfter.Format("2006-01-02"), daysUntil(entry.NotAfter, now),
+			certificateKind(entry), entry.Subject, strings.Join(entry.Sources, ", "))
+	}
+	w.Flush()
+	return output.String()
+}
+
+// FormatScheduleICS formats a renewal schedule as an iCalendar (RFC 5545)
+// calendar with an all-day event on each certificate's renew-by date. Event
+// UIDs derive from the certificate fingerprint so that subscribed calendars
+// update events in place when the schedule is regenerated.
+func FormatScheduleICS(entries []ExpiryEntry) string {
+	var output strings.Builder
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	writeICSLine(&output, "BEGIN:VCALENDAR")
+	writeICSLine(&output, "VERSION:2.0")
+	writeICSLine(&output, "PRODID:-//mrp//renew-check//EN")
+	writeICSLine(&output, "CALSCALE:GREGORIAN")
+	writeICSLine(&output, "X-WR-CALNAME:Certificate renewals")
+	for _, entry := range entries {
+		day := entry.RenewBy.UTC()
+		description := fmt.Sprintf("%s certificate %s expires %s.\nSHA-256: %s\nFound in: %s",
+			certificateKind(entry), entry.Subject, entry.NotAfter.UTC().Format(time.RFC3339),
+			entry.SHA256, strings.Join(entry.Sources, ", "))
+
+		writeICSLine(&output, "BEGIN:VEVENT")
+		writeICSLine(&output, "UID:"+entry.SHA256+"@mrp")
+		writeICSLine(&output, "DTSTAMP:"+stamp)
+		writeICSLine(&output, "DTSTART;VALUE=DATE:"+day.Format("20060102"))
+		writeICSLine(&output, "DTEND;VALUE=DATE:"+day.AddDate(0, 0, 1).Format("20060102"))
+		writeICSLine(&output, "SUMMARY:"+escapeICSText("Renew "+certificateKind(entry)+" certificate "+entry.Subject))
+		writeICSLine(&output, "DESCRIPTION:"+escapeICSText(description))
+		writeICSLine(&output, "END:VEVENT")
+	}
+	writeICSLine(&output, "END:VCALENDAR")
+	return output.String()
+}
+
+// escapeICSText escapes an iCalendar TEXT value
+func escapeICSText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
+
+// writeICSLine writes a content line terminated by CRLF, folding it so that no
+// line exceeds 75 octets without splitting a UTF-8 sequence
+func writeICSLine(output *strings.Builder, line string) {
+	const maxOctets = 75
+	for len(line) > maxOctets {
+		cut := maxOctets
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		output.WriteString(line[:cut] + "\r\n")
+		// Continuation lines begin with a space, which counts towards their length
+		line = " " + line[cut:]
+	}
+	output.WriteString(line + "\r\n")
+}
@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+)
+
+// oidEmbeddedSCTList identifies the X.509 extension carrying embedded
+// Signed Certificate Timestamps (RFC 6962 section 3.3)
+var oidEmbeddedSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// countEmbeddedSCTs returns the number of SCTs embedded in the leaf certificate.
+// Only the list structure is parsed; SCT signatures are not verified.
+func countEmbeddedSCTs(result *ChainValidationResult) (int, error) {
+	for _, ext := range result.LeafCertificate.Extensions {
+		if !ext.Id.Equal(oidEmbeddedSCTList) {
+			continue
+		}
+
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil {
+			return 0, fmt.Errorf("malformed SCT extension: %v", err)
+		}
+		if len(list) < 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+			return 0, fmt.Errorf("malformed SCT list")
+		}
+
+		count := 0
+		for rest := list[2:]; len(rest) > 0; count++ {
+			if len(rest) < 2 {
+				return 0, fmt.Errorf("malformed SCT list")
+			}
+			length := int(binary.BigEndian.Uint16(rest))
+			if len(rest) < 2+length {
+				return 0, fmt.Errorf("malformed SCT list")
+			}
+			rest = rest[2+length:]
+		}
+		return count, nil
+	}
+	return 0, nil
+}
+
+// CheckSCTs records how many Signed Certificate Timestamps are embedded in the
+// leaf certificate and warns when there are none, since browsers that enforce
+// Certificate Transparency would reject it.
+func CheckSCTs(result *ChainValidationResult) {
+	result.SCTChecked = true
+
+	count, err := countEmbeddedSCTs(result)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s %v", msgNoSCT, err))
+		return
+	}
+
+	result.SCTCount = count
+	if count == 0 {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("%s leaf certificate has no embedded SCTs", msgNoSCT))
+	}
+}
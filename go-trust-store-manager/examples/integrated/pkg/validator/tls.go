@@ -0,0 +1,91 @@
+package validator
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// tlsVersions maps protocol versions to their display names
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// tlsVersionName returns the display name of a TLS protocol version
+func tlsVersionName(version uint16) string {
+	if name, ok := tlsVersions[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown (0x%04x)", version)
+}
+
+// parseTLSVersion parses a version such as "1.2" into its protocol constant
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q (expected 1.0, 1.1, 1.2 or 1.3)", version)
+}
+
+// offeredCipherSuites lists every cipher suite Go implements, including insecure ones,
+// so that servers which only support weak suites can still be inspected
+func offeredCipherSuites() []uint16 {
+	var suites []uint16
+	for _, suite := range tls.CipherSuites() {
+		suites = append(suites, suite.ID)
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		suites = append(suites, suite.ID)
+	}
+	return suites
+}
+
+// isInsecureCipherSuite reports whether Go classifies the cipher suite as insecure
+func isInsecureCipherSuite(id uint16) bool {
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// recordConnectionState stores the negotiated protocol and cipher suite on the
+// result and warns about deprecated protocols and weak ciphers
+func recordConnectionState(result *ChainValidationResult, state tls.ConnectionState) {
+	result.TLSVersion = state.Version
+	result.CipherSuite = state.CipherSuite
+
+	if state.Version < tls.VersionTLS12 {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("%s %s is deprecated", msgInsecureProtocol, tlsVersionName(state.Version)))
+	}
+	if isInsecureCipherSuite(state.CipherSuite) {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("%s %s is considered insecure", msgWeakCipher, tls.CipherSuiteName(state.CipherSuite)))
+	}
+}
+
+// EnforceMinTLS records an error on an endpoint result whose negotiated
+// protocol is older than minVersion (for example "1.2")
+func EnforceMinTLS(result *ChainValidationResult, minVersion string) error {
+	min, err := parseTLSVersion(minVersion)
+	if err != nil {
+		return err
+	}
+
+	if result.TLSVersion != 0 && result.TLSVersion < min {
+		result.Errors = append(result.Errors,
+			fmt.Sprintf("%s: negotiated %s, require at least TLS %s", msgTLSTooOld, tlsVersionName(result.TLSVersion), minVersion))
+	}
+	return nil
+}
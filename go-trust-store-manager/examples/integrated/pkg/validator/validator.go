@@ -1,16 +1,40 @@
 package validator
 
 import (
+	"context"
+	"crypto/tls"
 	"crypto/x509"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Messages recorded in ChainValidationResult.Errors, shared with the report formatters
+const (
+	msgExpired     = "Certificate has expired"
+	msgNotYetValid = "Certificate is not yet valid"
+	msgChainFailed = "Chain verification failed"
+	msgTLSTooOld   = "Negotiated TLS version is below the minimum"
+	msgPinMismatch = "Certificate pin mismatch"
+	msgWrongRoot   = "Chain does not terminate at the required root"
+)
+
+// Messages recorded in ChainValidationResult.Warnings
+const (
+	msgInsecureProtocol = "Insecure protocol:"
+	msgWeakCipher       = "Weak cipher suite:"
+	msgNoSCT            = "Certificate Transparency:"
+	msgNoSAN            = "Certificate has no Subject Alternative Names"
+)
+
+// endpointTimeout bounds how long ValidateEndpoint waits for a TLS handshake
+const endpointTimeout = 10 * time.Second
+
 // ValidationResult represents the validation status of a single certificate
 type ValidationResult struct {
 	Certificate    *x509.Certificate
@@ -23,58 +47,206 @@ type ValidationResult struct {
 
 // ChainValidationResult represents the validation status of a certificate chain
 type ChainValidationResult struct {
+	Source             string
 	LeafCertificate    *x509.Certificate
 	Chain              []*x509.Certificate
 	CompleteChain      bool
 	ValidPath          bool
 	RootTrusted        bool
+	TrustAnchor        *x509.Certificate
+	VerifiedChains     [][]*x509.Certificate
+	PresentedChain     []*x509.Certificate
+	PinChecked         bool
+	PinMatched         bool
+	PinnedCertificate  *x509.Certificate
+	SCTChecked         bool
+	SCTCount           int
+	TLSVersion         uint16
+	CipherSuite        uint16
 	ExpirationWarnings []string
+	Warnings           []string
 	Errors             []string
 }
 
-// ValidateFile validates a certificate file and returns the validation result
+// ValidateFile validates a PEM or DER certificate file and returns the validation result
 func ValidateFile(certFile string, rootStorePath string, intermediatePath string, expiryDays int) (*ChainValidationResult, error) {
+	return ValidateFileFormat(certFile, FormatAuto, rootStorePath, intermediatePath, expiryDays)
+}
+
+// ValidateFileFormat validates a certificate file, reading it in the given input
+// format instead of detecting it
+func ValidateFileFormat(certFile string, format string, rootStorePath string, intermediatePath string, expiryDays int) (*ChainValidationResult, error) {
 	// Read the certificate to validate
 	certData, err := ioutil.ReadFile(certFile)
 	if err != nil {
 		return nil, fmt.Errorf("error reading certificate: %v", err)
 	}
 
-	// Parse the certificate
-	block, _ := pem.Decode(certData)
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse certificate PEM data")
+	certs, err := ParseCertificates(certData, format)
+	if err != nil {
+		return nil, err
 	}
 
-	cert, err := x509.ParseCertificate(block.Bytes)
+	result, err := validateCertificates(certs, rootStorePath, intermediatePath, expiryDays)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing certificate: %v", err)
+		return nil, err
 	}
+	result.Source = certFile
+	return result, nil
+}
 
-	// Build a root certificate pool
-	rootPool := x509.NewCertPool()
-	if err := loadRoots(rootPool, rootStorePath, false); err != nil {
-		return nil, fmt.Errorf("error loading root certificates: %v", err)
+// ValidatePEM validates the first certificate in PEM encoded data and returns the validation result.
+// Any further certificates, as in a fullchain.pem, are used as intermediates.
+func ValidatePEM(certData []byte, rootStorePath string, intermediatePath string, expiryDays int) (*ChainValidationResult, error) {
+	certs, err := parsePEM(certData)
+	if err != nil {
+		return nil, err
 	}
+	return validateCertificates(certs, rootStorePath, intermediatePath, expiryDays)
+}
 
-	// Build intermediates pool if specified
-	intermediatePool := x509.NewCertPool()
-	if intermediatePath != "" {
-		if err := loadRoots(intermediatePool, intermediatePath, false); err != nil {
-			return nil, fmt.Errorf("error loading intermediate certificates: %v", err)
-		}
+// validateCertificates validates certs[0], using the remaining certificates as intermediates
+func validateCertificates(certs []*x509.Certificate, rootStorePath string, intermediatePath string, expiryDays int) (*ChainValidationResult, error) {
+	rootPool, intermediatePool, err := buildPools(rootStorePath, intermediatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Intermediates bundled after the leaf take part in path building
+	for _, cert := range certs[1:] {
+		intermediatePool.AddCert(cert)
 	}
 
 	// Validate the certificate chain
-	result := validateChain(cert, rootPool, intermediatePool, expiryDays)
+	result := validateChain(certs[0], rootPool, intermediatePool, expiryDays)
+	if !result.ValidPath {
+		// Without a verified chain, report the certificates as given
+		result.Chain = certs
+	}
 	return &result, nil
 }
 
 // ValidateEndpoint validates a server certificate from a host:port endpoint
 func ValidateEndpoint(endpoint string, serverName string, rootStorePath string, intermediatePath string, expiryDays int) (*ChainValidationResult, error) {
-	// This would use crypto/tls to connect to the endpoint and get the certificate
-	// For simplicity in this example, we'll return a placeholder
-	return nil, fmt.Errorf("endpoint validation not implemented yet")
+	ctx, cancel := context.WithTimeout(context.Background(), endpointTimeout)
+	defer cancel()
+	return ValidateEndpointContext(ctx, endpoint, serverName, rootStorePath, intermediatePath, expiryDays)
+}
+
+// ValidateEndpointContext is like ValidateEndpoint but bounds the connection by ctx
+func ValidateEndpointContext(ctx context.Context, endpoint string, serverName string, rootStorePath string, intermediatePath string, expiryDays int) (*ChainValidationResult, error) {
+	// Verification is done by validateChain so that failures are reported rather than aborting the handshake
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+		CipherSuites:       offeredCipherSuites(),
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", endpoint, err)
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	peerCerts := state.PeerCertificates
+	if len(peerCerts) == 0 {
+		return nil, fmt.Errorf("no certificates presented by %s", endpoint)
+	}
+
+	rootPool, intermediatePool, err := buildPools(rootStorePath, intermediatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Intermediates sent by the server take part in path building
+	for _, cert := range peerCerts[1:] {
+		intermediatePool.AddCert(cert)
+	}
+
+	result := validateChain(peerCerts[0], rootPool, intermediatePool, expiryDays)
+	result.Source = endpoint
+	result.PresentedChain = peerCerts
+	if !result.ValidPath {
+		// Without a verified chain, report the certificates as presented
+		result.Chain = peerCerts
+	}
+	recordConnectionState(&result, state)
+	return &result, nil
+}
+
+// cachedPool is a loaded certificate pool and the modification time of its source
+type cachedPool struct {
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// poolCache holds certificate pools already loaded by this process, keyed by path
+var poolCache = struct {
+	sync.Mutex
+	pools map[string]cachedPool
+}{pools: make(map[string]cachedPool)}
+
+// LoadCertPool returns the certificate pool for a file or directory of PEM certificates.
+// Pools are shared until the file or directory changes, so callers must Clone the
+// pool before adding to it.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	poolCache.Lock()
+	defer poolCache.Unlock()
+
+	modTime, err := latestModTime(path)
+	if err == nil {
+		if cached, ok := poolCache.pools[path]; ok && cached.modTime.Equal(modTime) {
+			return cached.pool, nil
+		}
+	}
+
+	pool := x509.NewCertPool()
+	if err := loadRoots(pool, path, false); err != nil {
+		delete(poolCache.pools, path)
+		return nil, err
+	}
+	poolCache.pools[path] = cachedPool{pool: pool, modTime: modTime}
+	return pool, nil
+}
+
+// latestModTime returns the newest modification time of a file, or of a directory
+// and everything below it. Adding or removing a file changes its directory's time,
+// and rewriting one changes the file's own.
+func latestModTime(path string) (time.Time, error) {
+	var latest time.Time
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// buildPools loads the root and optional intermediate certificate pools.
+// The intermediate pool is always a fresh copy that callers may add to.
+func buildPools(rootStorePath string, intermediatePath string) (*x509.CertPool, *x509.CertPool, error) {
+	// Build a root certificate pool
+	rootPool, err := LoadCertPool(rootStorePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading root certificates: %v", err)
+	}
+
+	// Build intermediates pool if specified
+	intermediatePool := x509.NewCertPool()
+	if intermediatePath != "" {
+		pool, err := LoadCertPool(intermediatePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading intermediate certificates: %v", err)
+		}
+		intermediatePool = pool.Clone()
+	}
+
+	return rootPool, intermediatePool, nil
 }
 
 // loadRoots loads root certificates from a file or directory into a certificate pool
@@ -152,11 +324,11 @@ func validateChain(cert *x509.Certificate, roots *x509.CertPool, intermediates *
 	// Expiry check
 	now := time.Now()
 	if cert.NotAfter.Before(now) {
-		result.Errors = append(result.Errors, "Certificate has expired")
+		result.Errors = append(result.Errors, msgExpired)
 	} else {
 		expiryWarningDate := now.Add(time.Duration(expiryDays) * 24 * time.Hour)
 		if cert.NotAfter.Before(expiryWarningDate) {
-			daysUntilExpiry := int(cert.NotAfter.Sub(now).Hours() / 24)
+			daysUntilExpiry := daysUntil(cert.NotAfter, now)
 			result.ExpirationWarnings = append(result.ExpirationWarnings,
 				fmt.Sprintf("Certificate will expire in %d days", daysUntilExpiry))
 		}
@@ -164,7 +336,13 @@ func validateChain(cert *x509.Certificate, roots *x509.CertPool, intermediates *
 
 	// Check if it's not yet valid
 	if cert.NotBefore.After(now) {
-		result.Errors = append(result.Errors, "Certificate is not yet valid")
+		result.Errors = append(result.Errors, msgNotYetValid)
+	}
+
+	// Modern clients, including Chrome and Go, ignore the CN when matching hosts
+	if !cert.IsCA && len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("%s; CN-only matching is deprecated", msgNoSAN))
 	}
 
 	// Verify certificate chain
@@ -176,34 +354,110 @@ func validateChain(cert *x509.Certificate, roots *x509.CertPool, intermediates *
 
 	chains, err := cert.Verify(opts)
 	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("Chain verification failed: %v", err))
+		// Name the issuing certificate when it, not the leaf, is outside its validity window
+		var invalid x509.CertificateInvalidError
+		if errors.As(err, &invalid) && invalid.Reason == x509.Expired && invalid.Cert != nil && invalid.Cert != cert {
+			role := "intermediate"
+			if isSelfSigned(invalid.Cert) {
+				role = "root"
+			}
+			// x509.Expired covers both ends of the validity window
+			message := msgExpired
+			if now.Before(invalid.Cert.NotBefore) {
+				message = msgNotYetValid
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s %s (valid %s to %s)", message, role,
+				invalid.Cert.Subject.String(), invalid.Cert.NotBefore.Format(time.RFC3339), invalid.Cert.NotAfter.Format(time.RFC3339)))
+		}
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", msgChainFailed, err))
 		return result
 	}
 
 	// We have at least one valid chain
 	result.ValidPath = true
+	result.VerifiedChains = chains
 
 	// Use the first chain found
 	if len(chains) > 0 && len(chains[0]) > 0 {
 		result.Chain = chains[0]
 		result.CompleteChain = true
 
-		// Check if the root is trusted
+		// The last certificate is the root from the pool that anchored the chain
 		root := chains[0][len(chains[0])-1]
-		// If a certificate is self-signed, it might be a root
-		isSelfSigned := root.IsCA &&
-			root.CheckSignature(root.SignatureAlgorithm, root.RawTBSCertificate, root.Signature) == nil
+		result.TrustAnchor = root
 
-		if isSelfSigned {
+		// Check if the root is trusted
+		// If a certificate is self-signed, it might be a root
+		if isSelfSigned(root) {
 			result.RootTrusted = true
 		}
+
+		// An expiring intermediate or root breaks the chain as surely as the leaf
+		for i, issuer := range result.Chain[1:] {
+			if issuer.NotAfter.Before(now.Add(time.Duration(expiryDays) * 24 * time.Hour)) {
+				result.ExpirationWarnings = append(result.ExpirationWarnings,
+					fmt.Sprintf("Certificate will expire in %d days: %s %s (%s)", daysUntil(issuer.NotAfter, now),
+						chainRole(&result, i+1), issuer.Subject.String(), issuer.NotAfter.Format(time.RFC3339)))
+			}
+		}
 	}
 
 	return result
 }
 
+// daysUntil returns the whole days from now until t, negative once t has passed
+func daysUntil(t time.Time, now time.Time) int {
+	return int(t.Sub(now).Hours() / 24)
+}
+
+// expiryDescription describes how far off a certificate's expiry is
+func expiryDescription(notAfter time.Time) string {
+	now := time.Now()
+	if notAfter.Before(now) {
+		return "expired"
+	}
+	return fmt.Sprintf("expires in %d days", daysUntil(notAfter, now))
+}
+
+// isSelfSigned reports whether cert is a CA certificate signed by its own key
+func isSelfSigned(cert *x509.Certificate) bool {
+	return cert.IsCA &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// RequireRoot restricts a valid result to chains that terminate at the root with
+// the given SHA-256 fingerprint. When such a chain exists it becomes the reported
+// chain; otherwise an error names the roots the certificate is trusted through instead.
+func RequireRoot(result *ChainValidationResult, fingerprint string) error {
+	want, err := NormalizeFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	// Certificates without any trusted path already carry a chain error
+	if !result.ValidPath {
+		return nil
+	}
+
+	var anchors []string
+	for _, chain := range result.VerifiedChains {
+		root := chain[len(chain)-1]
+		if certificateFingerprint(root) == want {
+			result.Chain = chain
+			result.TrustAnchor = root
+			result.RootTrusted = isSelfSigned(root)
+			return nil
+		}
+		anchors = append(anchors, root.Subject.String())
+	}
+
+	result.Errors = append(result.Errors,
+		fmt.Sprintf("%s %s: trusted only via %s", msgWrongRoot, want, strings.Join(anchors, ", ")))
+	return nil
+}
+
 // FormatValidationResult formats a validation result for display
-func FormatValidationResult(result *ChainValidationResult, verbose bool) string {
+func FormatValidationResult(result *ChainValidationResult, verbose bool, fingerprintFormat string) string {
 	var output strings.Builder
 
 	// Basic certificate info
@@ -232,11 +486,37 @@ func FormatValidationResult(result *ChainValidationResult, verbose bool) string
 		fmt.Fprintf(&output, "❌ Root certificate is NOT trusted\n")
 	}
 
-	if len(result.ExpirationWarnings) > 0 {
+	if result.TrustAnchor != nil {
+		fmt.Fprintf(&output, "Trust Anchor: %s (SHA-256 %s)\n", result.TrustAnchor.Subject.String(),
+			FormatFingerprint(certificateFingerprint(result.TrustAnchor), fingerprintFormat))
+	}
+
+	if result.PinChecked {
+		if result.PinMatched {
+			fmt.Fprintf(&output, "✅ Pinned certificate presented: %s\n", result.PinnedCertificate.Subject.CommonName)
+		} else {
+			fmt.Fprintf(&output, "❌ No presented certificate matches the configured pins\n")
+		}
+	}
+
+	if result.SCTChecked && result.SCTCount > 0 {
+		fmt.Fprintf(&output, "✅ Certificate Transparency: %d embedded SCTs\n", result.SCTCount)
+	}
+
+	if result.TLSVersion != 0 {
+		fmt.Fprintf(&output, "\nConnection:\n")
+		fmt.Fprintf(&output, "TLS Version: %s\n", tlsVersionName(result.TLSVersion))
+		fmt.Fprintf(&output, "Cipher Suite: %s\n", tls.CipherSuiteName(result.CipherSuite))
+	}
+
+	if len(result.ExpirationWarnings) > 0 || len(result.Warnings) > 0 {
 		fmt.Fprintf(&output, "\nWarnings:\n")
 		for _, warning := range result.ExpirationWarnings {
 			fmt.Fprintf(&output, "⚠️  %s\n", warning)
 		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(&output, "⚠️  %s\n", warning)
+		}
 	}
 
 	if len(result.Errors) > 0 {
@@ -251,7 +531,7 @@ func FormatValidationResult(result *ChainValidationResult, verbose bool) string
 		for i, cert := range result.Chain {
 			fmt.Fprintf(&output, "%d. %s (Issuer: %s)\n", i+1, cert.Subject.CommonName, cert.Issuer.CommonName)
 			fmt.Fprintf(&output, "   Serial: %X\n", cert.SerialNumber)
-			fmt.Fprintf(&output, "   Valid Until: %s\n", cert.NotAfter.Format(time.RFC3339))
+			fmt.Fprintf(&output, "   Valid Until: %s (%s)\n", cert.NotAfter.Format(time.RFC3339), expiryDescription(cert.NotAfter))
 		}
 	}
 
@@ -0,0 +1,268 @@
+package validator
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validity is a certificate's validity window relative to now
+type validity struct {
+	from, until time.Duration
+}
+
+var (
+	current     = validity{-time.Hour, 365 * 24 * time.Hour}
+	expired     = validity{-365 * 24 * time.Hour, -24 * time.Hour}
+	notYetValid = validity{24 * time.Hour, 365 * 24 * time.Hour}
+	expiring    = validity{-time.Hour, 10 * 24 * time.Hour}
+)
+
+// containsAll reports whether every substring in want appears in some message
+func containsAll(messages []string, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, message := range messages {
+			if strings.Contains(message, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestValidateChainExpiry(t *testing.T) {
+	tests := []struct {
+		name                     string
+		root, intermediate, leaf validity
+		wantValid                bool
+		wantErrors               []string
+		wantWarnings             []string
+	}{
+		{
+			name: "all current", root: current, intermediate: current, leaf: current,
+			wantValid: true,
+		},
+		{
+			name: "expired leaf", root: current, intermediate: current, leaf: expired,
+			wantErrors: []string{msgExpired, msgChainFailed},
+		},
+		{
+			name: "expired intermediate", root: current, intermediate: expired, leaf: current,
+			wantErrors: []string{msgExpired + ": intermediate CN=Test Intermediate", msgChainFailed},
+		},
+		{
+			name: "intermediate not yet valid", root: current, intermediate: notYetValid, leaf: current,
+			wantErrors: []string{msgNotYetValid + ": intermediate CN=Test Intermediate", msgChainFailed},
+		},
+		{
+			name: "expired root", root: expired, intermediate: current, leaf: current,
+			wantErrors: []string{msgExpired + ": root CN=Test Root", msgChainFailed},
+		},
+		{
+			name: "expiring intermediate", root: current, intermediate: expiring, leaf: current,
+			wantValid:    true,
+			wantWarnings: []string{"Certificate will expire in 9 days: intermediate CN=Test Intermediate"},
+		},
+		{
+			name: "expiring root", root: expiring, intermediate: current, leaf: current,
+			wantValid:    true,
+			wantWarnings: []string{"Certificate will expire in 9 days: root CN=Test Root"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			root := newTestCert(t, "Test Root", nil, true, now.Add(tt.root.from), now.Add(tt.root.until))
+			intermediate := newTestCert(t, "Test Intermediate", root, true, now.Add(tt.intermediate.from), now.Add(tt.intermediate.until))
+			leaf := newTestCert(t, "leaf.example.com", intermediate, false, now.Add(tt.leaf.from), now.Add(tt.leaf.until))
+
+			result := validateTestChain(t, []*x509.Certificate{leaf.cert, intermediate.cert}, []*x509.Certificate{root.cert}, 30)
+
+			if result.ValidPath != tt.wantValid {
+				t.Errorf("ValidPath = %v, want %v (errors %v)", result.ValidPath, tt.wantValid, result.Errors)
+			}
+			if len(tt.wantErrors) == 0 && len(result.Errors) > 0 {
+				t.Errorf("unexpected errors %v", result.Errors)
+			}
+			if !containsAll(result.Errors, tt.wantErrors) {
+				t.Errorf("errors %v, want %v", result.Errors, tt.wantErrors)
+			}
+			if len(tt.wantWarnings) == 0 && len(result.ExpirationWarnings) > 0 {
+				t.Errorf("unexpected expiration warnings %v", result.ExpirationWarnings)
+			}
+			if !containsAll(result.ExpirationWarnings, tt.wantWarnings) {
+				t.Errorf("expiration warnings %v, want %v", result.ExpirationWarnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRequireRoot(t *testing.T) {
+	pki := newTestPKI(t)
+	now := time.Now()
+	otherRoot := newTestCert(t, "Other Root", nil, true, now.Add(-time.Hour), now.AddDate(10, 0, 0))
+	chain := []*x509.Certificate{pki.leaf.cert, pki.intermediate.cert}
+	// The intermediate cross-signed by the other root gives a second valid path
+	crossChain := append(chain, crossSign(t, pki.intermediate, otherRoot))
+
+	tests := []struct {
+		name        string
+		chain       []*x509.Certificate
+		roots       []*x509.Certificate
+		fingerprint string
+		wantRoot    *x509.Certificate
+		wantErr     bool
+		wantErrors  []string
+	}{
+		{
+			name:        "chain ends at required root",
+			roots:       []*x509.Certificate{pki.root.cert, otherRoot.cert},
+			fingerprint: certificateFingerprint(pki.root.cert),
+			wantRoot:    pki.root.cert,
+		},
+		{
+			name:        "cross-signed chain selects the required root",
+			chain:       crossChain,
+			roots:       []*x509.Certificate{pki.root.cert, otherRoot.cert},
+			fingerprint: certificateFingerprint(otherRoot.cert),
+			wantRoot:    otherRoot.cert,
+		},
+		{
+			name:        "cross-signed chain selects the other root",
+			chain:       crossChain,
+			roots:       []*x509.Certificate{pki.root.cert, otherRoot.cert},
+			fingerprint: certificateFingerprint(pki.root.cert),
+			wantRoot:    pki.root.cert,
+		},
+		{
+			name:        "colon separated fingerprint",
+			roots:       []*x509.Certificate{pki.root.cert},
+			fingerprint: FormatFingerprint(certificateFingerprint(pki.root.cert), FingerprintColon),
+			wantRoot:    pki.root.cert,
+		},
+		{
+			name:        "chain ends at another root",
+			roots:       []*x509.Certificate{pki.root.cert, otherRoot.cert},
+			fingerprint: certificateFingerprint(otherRoot.cert),
+			wantErrors:  []string{msgWrongRoot, "trusted only via CN=Test Root"},
+		},
+		{
+			name:        "untrusted chain is left to its chain error",
+			roots:       []*x509.Certificate{otherRoot.cert},
+			fingerprint: certificateFingerprint(pki.root.cert),
+			wantErrors:  []string{msgChainFailed},
+		},
+		{
+			name:        "malformed fingerprint",
+			roots:       []*x509.Certificate{pki.root.cert},
+			fingerprint: "not-a-fingerprint",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs := tt.chain
+			if certs == nil {
+				certs = chain
+			}
+			result := validateTestChain(t, certs, tt.roots, 30)
+
+			err := RequireRoot(result, tt.fingerprint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RequireRoot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(tt.wantErrors) == 0 && len(result.Errors) > 0 {
+				t.Errorf("unexpected errors %v", result.Errors)
+			}
+			if tt.wantRoot != nil {
+				if result.TrustAnchor == nil || !result.TrustAnchor.Equal(tt.wantRoot) {
+					t.Errorf("trust anchor is not %s", tt.wantRoot.Subject)
+				}
+				if last := result.Chain[len(result.Chain)-1]; !last.Equal(tt.wantRoot) {
+					t.Errorf("reported chain ends at %s, want %s", last.Subject, tt.wantRoot.Subject)
+				}
+			}
+			if !containsAll(result.Errors, tt.wantErrors) {
+				t.Errorf("errors %v, want %v", result.Errors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestLoadCertPoolReloadsChangedStore(t *testing.T) {
+	pki := newTestPKI(t)
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, dir string) string
+		change func(t *testing.T, path string)
+	}{
+		{
+			name:  "rewritten file",
+			setup: func(t *testing.T, dir string) string { return writeTestPEM(t, dir, "roots.pem", pki.root.cert) },
+			change: func(t *testing.T, path string) {
+				writeTestPEM(t, filepath.Dir(path), "roots.pem", pki.root.cert, pki.intermediate.cert)
+				if err := os.Chtimes(path, later, later); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "file added to directory",
+			setup: func(t *testing.T, dir string) string {
+				writeTestPEM(t, dir, "root.pem", pki.root.cert)
+				return dir
+			},
+			change: func(t *testing.T, path string) {
+				writeTestPEM(t, path, "intermediate.pem", pki.intermediate.cert)
+				if err := os.Chtimes(path, later, later); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.setup(t, t.TempDir())
+
+			first, err := LoadCertPool(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := LoadCertPool(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != first {
+				t.Error("unchanged store was loaded again")
+			}
+
+			tt.change(t, path)
+			changed, err := LoadCertPool(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed == first {
+				t.Fatal("changed store was served from the cache")
+			}
+			want := x509.NewCertPool()
+			want.AddCert(pki.root.cert)
+			want.AddCert(pki.intermediate.cert)
+			if !changed.Equal(want) {
+				t.Error("reloaded pool does not hold the added certificate")
+			}
+		})
+	}
+}
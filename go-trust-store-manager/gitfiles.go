@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectGitInfoFromFiles reads branch, commit and remote URL directly from the
+// repository metadata, for hosts such as minimal containers without a git binary.
+// The dirty state cannot be determined this way and is reported as clean.
+func collectGitInfoFromFiles(workingDir string) GitInfo {
+	gitInfo := GitInfo{
+		WorkingDir:  workingDir,
+		ProjectName: filepath.Base(workingDir),
+	}
+
+	gitDir := findGitDir(workingDir)
+	if gitDir == "" {
+		return gitInfo
+	}
+
+	head, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err == nil {
+		ref := strings.TrimSpace(string(head))
+		if strings.HasPrefix(ref, "ref: ") {
+			ref = strings.TrimPrefix(ref, "ref: ")
+			gitInfo.BranchName = strings.TrimPrefix(ref, "refs/heads/")
+			gitInfo.CommitHash = resolveGitRef(gitDir, ref)
+		} else {
+			// Detached HEAD holds the commit hash itself
+			gitInfo.BranchName = "HEAD"
+			gitInfo.CommitHash = ref
+		}
+	}
+
+	if repoURL := readGitRemoteURL(gitDir, "origin"); repoURL != "" {
+		gitInfo.RepositoryURL = repoURL
+		if projectName := gitProjectNameFromURL(repoURL); projectName != "" {
+			gitInfo.ProjectName = projectName
+		}
+	}
+
+	return gitInfo
+}
+
+// findGitDir walks up from dir to the enclosing repository's git directory,
+// following "gitdir:" indirection used by worktrees and submodules
+func findGitDir(dir string) string {
+	for {
+		candidate := filepath.Join(dir, ".git")
+		if info, err := os.Stat(candidate); err == nil {
+			if info.IsDir() {
+				return candidate
+			}
+			data, err := ioutil.ReadFile(candidate)
+			if err == nil && strings.HasPrefix(string(data), "gitdir: ") {
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir: "))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+				return gitDir
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// resolveGitRef returns the commit a ref points to, checking the loose ref
+// file before packed-refs
+func resolveGitRef(gitDir, ref string) string {
+	if data, err := ioutil.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+
+	// Worktrees keep shared refs in the common directory
+	commonDir := gitDir
+	if data, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(commonDir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+
+	file, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == ref {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// readGitRemoteURL returns the url of the named remote from the repository config
+func readGitRemoteURL(gitDir, remote string) string {
+	configPath := filepath.Join(gitDir, "config")
+	if data, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		configPath = filepath.Join(commonDir, "config")
+	}
+
+	file, err := os.Open(configPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	section := `[remote "` + remote + `"]`
+	inSection := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inSection = line == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == "url" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -2,4 +2,9 @@ module trust-store-manager
 
 go 1.20
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require golang.org/x/sys v0.4.0 // indirect
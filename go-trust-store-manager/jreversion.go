@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// javaVersionLine returns the line of `java -version` output that names the
+// version, skipping notices such as "Picked up JAVA_TOOL_OPTIONS" that the JVM
+// may print first
+func javaVersionLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, " version ") {
+			return line
+		}
+	}
+	return ""
+}
+
+// parseJavaMajorVersion extracts the major Java version from a version string
+// in any of the forms Java has used: a full `java -version` line such as
+// `openjdk version "17.0.1" 2021-10-19`, a legacy "1.8.0_292" (Java 8), or a
+// bare "11", "21-ea" or "9+181"
+func parseJavaMajorVersion(version string) (int, error) {
+	version = strings.TrimSpace(version)
+	if start := strings.IndexByte(version, '"'); start >= 0 {
+		if end := strings.IndexByte(version[start+1:], '"'); end >= 0 {
+			version = version[start+1 : start+1+end]
+		}
+	}
+
+	// Cut pre-release and build suffixes: 21-ea, 9+181, 1.8.0_292
+	if i := strings.IndexAny(version, "-+_"); i >= 0 {
+		version = version[:i]
+	}
+
+	parts := strings.Split(version, ".")
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 1 {
+		return 0, fmt.Errorf("unrecognized Java version %q", version)
+	}
+	// Before Java 9 the major version followed "1.", as in 1.8
+	if major == 1 && len(parts) > 1 {
+		if major, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, fmt.Errorf("unrecognized Java version %q", version)
+		}
+	}
+	return major, nil
+}
+
+// javaForKeytool returns the java binary installed beside keytool, so the
+// version checked is that of the JRE whose keytool will be used, falling back
+// to java on the PATH
+func javaForKeytool(keytoolPath string) string {
+	if keytoolPath != "" {
+		if path, err := exec.LookPath(keytoolPath); err == nil {
+			if resolved, err := filepath.EvalSymlinks(path); err == nil {
+				path = resolved
+			}
+			java := filepath.Join(filepath.Dir(path), "java")
+			if info, err := os.Stat(java); err == nil && !info.IsDir() {
+				return java
+			}
+		}
+	}
+	if java, err := exec.LookPath("java"); err == nil {
+		return java
+	}
+	return ""
+}
+
+// checkMinJavaVersion returns an error if the detected Java major version is
+// older than minVersion. An unknown detected version passes, since keytool
+// itself may still be usable.
+func checkMinJavaVersion(jreInfo *JREInfo, minVersion string) error {
+	if minVersion == "" || jreInfo.MajorVersion == 0 {
+		return nil
+	}
+	min, err := parseJavaMajorVersion(minVersion)
+	if err != nil {
+		return fmt.Errorf("invalid jre.min_version: %v", err)
+	}
+	if jreInfo.MajorVersion < min {
+		return fmt.Errorf("Java %d is older than the required minimum Java %d (jre.min_version)", jreInfo.MajorVersion, min)
+	}
+	return nil
+}
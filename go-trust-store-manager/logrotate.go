@@ -0,0 +1,155 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatingFile is an append-only log file that rolls over once it reaches
+// maxSize bytes. Rolled files are renamed with a timestamp suffix, optionally
+// gzipped, and pruned so at most maxBackups are kept.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	compress   bool
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens path for appending with size-based rotation.
+// A maxSize of zero disables rotation.
+func openRotatingFile(path string, maxSize int64, maxBackups int, compress bool) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		compress:   compress,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write appends p to the log, rotating first if p would push the file past maxSize
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate log file: %v", err)
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying log file
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+// rotate renames the current log aside, reopens a fresh file and prunes old backups
+func (rf *rotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	backup := fmt.Sprintf("%s.%s", rf.path, time.Now().Format("20060102_150405.000000"))
+	if err := os.Rename(rf.path, backup); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	if rf.compress {
+		if err := gzipFile(backup); err != nil {
+			return err
+		}
+	}
+	return rf.pruneBackups()
+}
+
+// pruneBackups removes the oldest rotated files beyond maxBackups
+func (rf *rotatingFile) pruneBackups() error {
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	// Timestamp suffixes sort chronologically
+	sort.Strings(matches)
+	for len(matches) > rf.maxBackups {
+		if err := os.Remove(matches[0]); err != nil {
+			return err
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// gzipFile compresses path to path.gz and removes the original
+func gzipFile(path string) error {
+	if strings.HasSuffix(path, ".gz") {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
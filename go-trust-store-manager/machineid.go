@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var (
+	ioPlatformUUIDPattern = regexp.MustCompile(`"IOPlatformUUID"\s*=\s*"([^"]+)"`)
+	machineGUIDPattern    = regexp.MustCompile(`MachineGuid\s+REG_SZ\s+(\S+)`)
+)
+
+// hardwareMachineID returns an identifier that survives hostname and IP
+// changes: /etc/machine-id on Linux, IOPlatformUUID on macOS and the
+// MachineGuid registry value on Windows. It returns "" when none is available.
+func hardwareMachineID() string {
+	switch runtime.GOOS {
+	case "linux":
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+			if data, err := ioutil.ReadFile(path); err == nil {
+				if id := strings.TrimSpace(string(data)); id != "" {
+					return id
+				}
+			}
+		}
+	case "darwin":
+		output, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err == nil {
+			if match := ioPlatformUUIDPattern.FindSubmatch(output); match != nil {
+				return string(match[1])
+			}
+		}
+	case "windows":
+		output, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if err == nil {
+			if match := machineGUIDPattern.FindSubmatch(output); match != nil {
+				return string(match[1])
+			}
+		}
+	}
+	return ""
+}
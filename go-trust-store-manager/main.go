@@ -3,6 +3,9 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -31,14 +34,21 @@ type AppConfig struct {
 	} `yaml:"baseline"`
 
 	Logging struct {
-		Enabled          bool   `yaml:"enabled"`
-		WebhookURL       string `yaml:"webhook_url"`
-		WebhookAPIKey    string `yaml:"webhook_api_key"`
-		LocalLogEnabled  bool   `yaml:"local_log_enabled"`
-		LocalLogPath     string `yaml:"local_log_path"`
-		LogLevel         string `yaml:"log_level"`
-		DualOutput       bool   `yaml:"dual_output"`
-		SimpleMode       bool   `yaml:"simple_mode"`
+		Enabled                bool              `yaml:"enabled"`
+		WebhookURL             string            `yaml:"webhook_url"`
+		WebhookAPIKey          string            `yaml:"webhook_api_key"`
+		WebhookHeaders         map[string]string `yaml:"webhook_headers"`
+		WebhookHMACSecret      string            `yaml:"webhook_hmac_secret"`
+		WebhookSignatureHeader string            `yaml:"webhook_signature_header"`
+		LocalLogEnabled        bool              `yaml:"local_log_enabled"`
+		LocalLogPath           string            `yaml:"local_log_path"`
+		LogLevel               string            `yaml:"log_level"`
+		DualOutput             bool              `yaml:"dual_output"`
+		SimpleMode             bool              `yaml:"simple_mode"`
+		MaxLogSizeMB           int               `yaml:"max_log_size_mb"`
+		MaxLogBackups          int               `yaml:"max_log_backups"`
+		CompressBackups        bool              `yaml:"compress_backups"`
+		Syslog                 SyslogConfig      `yaml:"syslog"`
 	} `yaml:"logging"`
 
 	Security struct {
@@ -63,16 +73,27 @@ type AppConfig struct {
 		MinVersion        string `yaml:"min_version"`
 		DisplayInfoInNoop bool   `yaml:"display_info_in_noop"`
 	} `yaml:"jre"`
+
+	Tools struct {
+		OpenSSLPath string `yaml:"openssl_path"`
+	} `yaml:"tools"`
 }
 
 // Logging structures
 type SystemInfo struct {
-	MachineIP   string   `json:"machine_ip"`
-	MachineID   string   `json:"machine_id"`
-	Hostname    string   `json:"hostname"`
-	OS          string   `json:"os"`
-	Arch        string   `json:"arch"`
-	IPAddresses []string `json:"ip_addresses"`
+	MachineIP   string             `json:"machine_ip"`
+	MachineID   string             `json:"machine_id"`
+	Hostname    string             `json:"hostname"`
+	OS          string             `json:"os"`
+	Arch        string             `json:"arch"`
+	IPAddresses []string           `json:"ip_addresses"`
+	Interfaces  []NetworkInterface `json:"interfaces"`
+}
+
+type NetworkInterface struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Family  string `json:"family"`
 }
 
 type UserInfo struct {
@@ -123,31 +144,139 @@ type StructuredLogger struct {
 	config      *AppConfig
 	auditLog    *AuditLog
 	localWriter io.Writer
+	logFile     *rotatingFile
+	syslog      syslogSender
 	sessionID   string
 	startTime   time.Time
 }
 
+// Process exit codes. These form a stable contract for schedulers and
+// orchestrators and must not be renumbered.
+const (
+	ExitOK      = 0 // No changes needed
+	ExitChanges = 1 // Changes were applied, or would be applied in noop mode
+	ExitError   = 2 // Errors were encountered
+	// Exit code 3 (policy violation) is returned by mrp validate; the scanner
+	// has no policy checks of its own
+)
+
 // Global variables for flags
 var (
-	targetDirectory string
-	certificatePath string
-	baselineURL     string
-	noopMode        bool
-	autoMode        bool
-	verbose         bool
-	showHelp        bool
-	configPath      string
+	targetDirectories directoryList
+	certificatePath   string
+	baselineURL       string
+	noopMode          bool
+	autoMode          bool
+	verbose           bool
+	quiet             bool
+	showHelp          bool
+	configPath        string
+	watchMode         bool
+	watchDebounce     time.Duration
+	scanProcesses     bool
+	scanArchives      bool
+	storepassStdin    bool
+	keytoolPathFlag   string
+	opensslPathFlag   string
 )
 
 func init() {
-	flag.StringVar(&targetDirectory, "d", ".", "Target directory to scan")
+	flag.Var(&targetDirectories, "d", "Target directory to scan (repeatable or comma-separated)")
 	flag.StringVar(&certificatePath, "c", "", "Path to certificate to append")
 	flag.StringVar(&baselineURL, "b", "", "URL to download baseline trust store")
 	flag.BoolVar(&noopMode, "noop", false, "Dry-run mode (required for safety)")
 	flag.BoolVar(&autoMode, "auto", false, "Run in automatic mode")
 	flag.BoolVar(&verbose, "v", false, "Enable verbose output")
+	flag.BoolVar(&quiet, "q", false, "Only print warnings, errors and the final result")
 	flag.BoolVar(&showHelp, "h", false, "Display help message")
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
+	flag.BoolVar(&watchMode, "watch", false, "Keep running and re-scan when trust stores change")
+	flag.DurationVar(&watchDebounce, "watch-debounce", 2*time.Second, "Quiet period before re-scanning after a change")
+	flag.BoolVar(&scanProcesses, "scan-processes", false, "Also scan trust stores referenced by running JVM processes (Linux)")
+	flag.BoolVar(&scanArchives, "scan-archives", false, "Report trust stores bundled inside JAR, WAR, EAR and ZIP archives")
+	flag.StringVar(&keytoolPathFlag, "keytool-path", "", "Use this keytool binary instead of discovering one")
+	flag.StringVar(&opensslPathFlag, "openssl-path", "", "Use this openssl binary instead of the one on the PATH")
+	flag.BoolVar(&storepassStdin, "storepass-stdin", false, "Read JKS/PKCS12 passwords from stdin, one per line, before the configured defaults")
+}
+
+// directoryList collects -d values, accepting both repeated flags and
+// comma-separated lists
+type directoryList []string
+
+func (d *directoryList) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *directoryList) Set(value string) error {
+	for _, dir := range strings.Split(value, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			*d = append(*d, dir)
+		}
+	}
+	return nil
+}
+
+// scanRoots returns the directories to scan with duplicates and directories
+// nested inside another root removed, defaulting to the current directory
+func scanRoots(dirs []string) []string {
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	cleaned := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		cleaned = append(cleaned, filepath.Clean(dir))
+	}
+
+	roots := []string{}
+	for i, dir := range cleaned {
+		covered := false
+		for j, other := range cleaned {
+			if i == j {
+				continue
+			}
+			// Keep the first of two identical roots and drop nested ones
+			if dir == other && j < i {
+				covered = true
+			} else if dir != other && isWithinDirectory(dir, other) {
+				covered = true
+			}
+		}
+		if !covered {
+			roots = append(roots, dir)
+		}
+	}
+	return roots
+}
+
+// isWithinDirectory reports whether path lies strictly inside dir
+func isWithinDirectory(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readStorePasswords reads newline-delimited keystore passwords, skipping blank lines
+func readStorePasswords(r io.Reader) ([]string, error) {
+	var passwords []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if password := strings.TrimRight(scanner.Text(), "\r"); password != "" {
+			passwords = append(passwords, password)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read passwords from stdin: %v", err)
+	}
+	if len(passwords) == 0 {
+		return nil, fmt.Errorf("no passwords were provided on stdin")
+	}
+	return passwords, nil
 }
 
 // LoadConfig loads configuration from YAML file
@@ -195,6 +324,21 @@ func validateAndSetDefaults(config *AppConfig) {
 		timestamp := time.Now().Format("20060102_150405")
 		config.Logging.LocalLogPath = fmt.Sprintf("./logs/trust-store-manager-%s.log", timestamp)
 	}
+	if config.Logging.Syslog.Facility == "" {
+		config.Logging.Syslog.Facility = "local0"
+	}
+	if config.Logging.Syslog.Tag == "" {
+		config.Logging.Syslog.Tag = "trust-store-manager"
+	}
+	if config.Logging.WebhookSignatureHeader == "" {
+		config.Logging.WebhookSignatureHeader = "X-Signature-256"
+	}
+	if config.Logging.MaxLogSizeMB == 0 {
+		config.Logging.MaxLogSizeMB = 10
+	}
+	if config.Logging.MaxLogBackups == 0 {
+		config.Logging.MaxLogBackups = 5
+	}
 	config.Security.RequireNoop = true
 	config.Operations.UpsertOnly = true
 	config.Logging.Enabled = true
@@ -203,8 +347,14 @@ func validateAndSetDefaults(config *AppConfig) {
 	
 	// JRE defaults
 	config.JRE.AutoDetect = true
-	config.JRE.MinVersion = "8"
+	if config.JRE.MinVersion == "" {
+		config.JRE.MinVersion = "8"
+	}
 	config.JRE.DisplayInfoInNoop = true
+
+	if config.Tools.OpenSSLPath == "" {
+		config.Tools.OpenSSLPath = "openssl"
+	}
 }
 
 // NewStructuredLogger creates a new structured logger
@@ -218,7 +368,7 @@ func NewStructuredLogger(config *AppConfig) (*StructuredLogger, error) {
 	auditLog := &AuditLog{
 		Timestamp:     time.Now(),
 		SessionID:     logger.sessionID,
-		Command:       strings.Join(os.Args, " "),
+		Command:       redactCommandLine(os.Args),
 		Modifications: make([]TrustStoreModification, 0),
 	}
 
@@ -254,19 +404,85 @@ func NewStructuredLogger(config *AppConfig) (*StructuredLogger, error) {
 		}
 	}
 
+	// Syslog is best-effort like the webhook, so an unreachable server does not stop the run
+	if config.Logging.Syslog.Enabled {
+		sender, err := newSyslogSender(config.Logging.Syslog)
+		if err != nil {
+			fmt.Printf("Warning: syslog output disabled: %v\n", err)
+		} else {
+			logger.syslog = sender
+		}
+	}
+
 	return logger, nil
 }
 
+// sensitiveFlags lists flags whose values must never be written to audit logs
+var sensitiveFlags = map[string]bool{
+	"webhook-key":     true,
+	"webhook-api-key": true,
+	"api-key":         true,
+	"storepass":       true,
+	"keypass":         true,
+	"srcstorepass":    true,
+	"deststorepass":   true,
+	"passin":          true,
+	"passout":         true,
+	"vault-token":     true,
+}
+
+// isSensitiveFlag reports whether a flag name carries a credential
+func isSensitiveFlag(name string) bool {
+	name = strings.ToLower(strings.TrimLeft(name, "-"))
+	if sensitiveFlags[name] {
+		return true
+	}
+	for _, word := range []string{"password", "secret", "token"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactCommandLine joins the command line for the audit log, replacing the
+// values of credential flags (in both "-flag value" and "-flag=value" forms) with ***
+func redactCommandLine(args []string) string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 1; i < len(redacted); i++ {
+		arg := redacted[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if name, _, ok := strings.Cut(arg, "="); ok {
+			if isSensitiveFlag(name) {
+				redacted[i] = name + "=***"
+			}
+			continue
+		}
+		if isSensitiveFlag(arg) && i+1 < len(redacted) {
+			redacted[i+1] = "***"
+			i++
+		}
+	}
+
+	return strings.Join(redacted, " ")
+}
+
 func (sl *StructuredLogger) setupLocalLogging() error {
 	logDir := filepath.Dir(sl.config.Logging.LocalLogPath)
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %v", err)
 	}
 
-	logFile, err := os.OpenFile(sl.config.Logging.LocalLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	maxSize := int64(sl.config.Logging.MaxLogSizeMB) * 1024 * 1024
+	logFile, err := openRotatingFile(sl.config.Logging.LocalLogPath, maxSize, sl.config.Logging.MaxLogBackups, sl.config.Logging.CompressBackups)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
 	}
+	sl.logFile = logFile
 
 	if sl.config.Logging.DualOutput {
 		sl.localWriter = io.MultiWriter(os.Stdout, logFile)
@@ -277,7 +493,49 @@ func (sl *StructuredLogger) setupLocalLogging() error {
 	return nil
 }
 
+// logLevels ranks the supported log levels from most to least verbose.
+// NOOP messages describe planned changes and rank alongside INFO.
+var logLevels = map[string]int{
+	"DEBUG":   0,
+	"INFO":    1,
+	"NOOP":    1,
+	"WARN":    2,
+	"WARNING": 2,
+	"ERROR":   3,
+}
+
+// logLevelRank returns the rank of a level name, treating unknown levels as INFO
+func logLevelRank(level string) int {
+	if rank, ok := logLevels[strings.ToUpper(level)]; ok {
+		return rank
+	}
+	return logLevels["INFO"]
+}
+
+// shouldLog reports whether a message at level passes the configured threshold.
+// The -v flag lowers the threshold to DEBUG and the -q flag raises it to at least WARN.
+func (sl *StructuredLogger) shouldLog(level string) bool {
+	threshold := logLevelRank(sl.config.Logging.LogLevel)
+	if verbose {
+		threshold = logLevels["DEBUG"]
+	} else if quiet && threshold < logLevels["WARN"] {
+		threshold = logLevels["WARN"]
+	}
+	return logLevelRank(level) >= threshold
+}
+
+// printInfo writes informational console output, which -q suppresses
+func printInfo(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
 func (sl *StructuredLogger) LogMessage(level, message string) {
+	if !sl.shouldLog(level) {
+		return
+	}
+
 	logEntry := map[string]interface{}{
 		"timestamp":  time.Now().Format(time.RFC3339),
 		"session_id": sl.sessionID,
@@ -289,6 +547,13 @@ func (sl *StructuredLogger) LogMessage(level, message string) {
 		logJSON, _ := json.Marshal(logEntry)
 		fmt.Fprintf(sl.localWriter, "[%s] %s\n", level, string(logJSON))
 	}
+
+	if sl.syslog != nil {
+		sl.syslog.Send(severityForLevel(level), "LOG", message, map[string]string{
+			"session_id": sl.sessionID,
+			"level":      level,
+		})
+	}
 }
 
 func (sl *StructuredLogger) LogModification(modification TrustStoreModification) {
@@ -299,6 +564,20 @@ func (sl *StructuredLogger) LogModification(modification TrustStoreModification)
 		modJSON, _ := json.MarshalIndent(modification, "", "  ")
 		fmt.Fprintf(sl.localWriter, "[MODIFICATION] %s\n", string(modJSON))
 	}
+
+	if sl.syslog != nil {
+		severity := severityNotice
+		if modification.Status == "failed" {
+			severity = severityError
+		}
+		sl.syslog.Send(severity, "MODIFICATION", fmt.Sprintf("%s %s", modification.Operation, modification.FilePath), map[string]string{
+			"session_id": sl.sessionID,
+			"file_path":  modification.FilePath,
+			"file_type":  modification.FileType,
+			"operation":  modification.Operation,
+			"status":     modification.Status,
+		})
+	}
 }
 
 func (sl *StructuredLogger) Finalize() error {
@@ -314,11 +593,31 @@ func (sl *StructuredLogger) Finalize() error {
 		fmt.Fprintf(sl.localWriter, "[AUDIT_LOG] %s\n", string(auditJSON))
 	}
 
+	// The audit log is the last local entry of a run
+	var closeErr error
+	if sl.logFile != nil {
+		if err := sl.logFile.Close(); err != nil {
+			closeErr = fmt.Errorf("failed to close log file: %v", err)
+		}
+		sl.logFile = nil
+		sl.localWriter = nil
+	}
+
+	if sl.syslog != nil {
+		sl.syslog.Send(severityInfo, "AUDIT_LOG", fmt.Sprintf("Run finished with %d modifications", len(sl.auditLog.Modifications)), map[string]string{
+			"session_id": sl.sessionID,
+			"duration":   sl.auditLog.Duration,
+		})
+		sl.syslog.Close()
+	}
+
 	if sl.config.Logging.WebhookURL != "" && sl.config.Logging.WebhookURL != "https://logs.company.com/api/trust-store-audit" {
-		return sl.sendToWebhook()
+		if err := sl.sendToWebhook(); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return closeErr
 }
 
 func (sl *StructuredLogger) sendToWebhook() error {
@@ -333,9 +632,7 @@ func (sl *StructuredLogger) sendToWebhook() error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if sl.config.Logging.WebhookAPIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+sl.config.Logging.WebhookAPIKey)
-	}
+	setWebhookHeaders(req, sl.config, jsonData)
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
@@ -351,30 +648,49 @@ func (sl *StructuredLogger) sendToWebhook() error {
 	return nil
 }
 
+// setWebhookHeaders adds authentication, the configured custom headers and, when
+// a secret is configured, an HMAC-SHA256 signature of body to a webhook request
+func setWebhookHeaders(req *http.Request, config *AppConfig, body []byte) {
+	if config.Logging.WebhookAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Logging.WebhookAPIKey)
+	}
+	for name, value := range config.Logging.WebhookHeaders {
+		req.Header.Set(name, value)
+	}
+	if config.Logging.WebhookHMACSecret != "" && body != nil {
+		mac := hmac.New(sha256.New, []byte(config.Logging.WebhookHMACSecret))
+		mac.Write(body)
+		req.Header.Set(config.Logging.WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+}
+
 func collectSystemInfo() (SystemInfo, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		return SystemInfo{}, err
 	}
 
+	interfaces := collectNetworkInterfaces()
+
+	// The primary address is the first global unicast IPv4 address,
+	// falling back to IPv6 on IPv6-only hosts
 	primaryIP := ""
 	ipAddresses := []string{}
-	
-	addrs, err := net.InterfaceAddrs()
-	if err == nil {
-		for _, addr := range addrs {
-			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-				if ipnet.IP.To4() != nil {
-					ipAddresses = append(ipAddresses, ipnet.IP.String())
-					if primaryIP == "" {
-						primaryIP = ipnet.IP.String()
-					}
-				}
-			}
+	for _, iface := range interfaces {
+		ipAddresses = append(ipAddresses, iface.Address)
+		if primaryIP == "" && iface.Family == "ipv4" {
+			primaryIP = iface.Address
 		}
 	}
+	if primaryIP == "" && len(interfaces) > 0 {
+		primaryIP = interfaces[0].Address
+	}
 
-	machineID := hostname + "_" + primaryIP
+	// Prefer a hardware identifier; hostname and IP change with DHCP leases
+	machineID := hardwareMachineID()
+	if machineID == "" {
+		machineID = hostname + "_" + primaryIP
+	}
 
 	return SystemInfo{
 		MachineIP:   primaryIP,
@@ -383,9 +699,47 @@ func collectSystemInfo() (SystemInfo, error) {
 		OS:          runtime.GOOS,
 		Arch:        runtime.GOARCH,
 		IPAddresses: ipAddresses,
+		Interfaces:  interfaces,
 	}, nil
 }
 
+// collectNetworkInterfaces returns the global unicast IPv4 and IPv6 addresses of
+// every interface that is up, skipping loopback and link-local addresses
+func collectNetworkInterfaces() []NetworkInterface {
+	result := []NetworkInterface{}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return result
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			family := "ipv6"
+			if ipnet.IP.To4() != nil {
+				family = "ipv4"
+			}
+			result = append(result, NetworkInterface{
+				Name:    iface.Name,
+				Address: ipnet.IP.String(),
+				Family:  family,
+			})
+		}
+	}
+	return result
+}
+
 func collectUserInfo() (UserInfo, error) {
 	currentUser, err := user.Current()
 	if err != nil {
@@ -402,6 +756,10 @@ func collectUserInfo() (UserInfo, error) {
 func collectGitInfo() (GitInfo, error) {
 	workingDir, _ := os.Getwd()
 	
+	if _, err := exec.LookPath("git"); err != nil {
+		return collectGitInfoFromFiles(workingDir), nil
+	}
+
 	gitInfo := GitInfo{
 		WorkingDir: workingDir,
 	}
@@ -436,7 +794,11 @@ func getGitProjectName() string {
 		return ""
 	}
 	
-	url := strings.TrimSpace(string(output))
+	return gitProjectNameFromURL(strings.TrimSpace(string(output)))
+}
+
+// gitProjectNameFromURL returns the repository name from a remote URL
+func gitProjectNameFromURL(url string) string {
 	if strings.Contains(url, "/") {
 		parts := strings.Split(url, "/")
 		projectName := parts[len(parts)-1]
@@ -484,50 +846,86 @@ func isGitDirty() bool {
 
 // JRE Detection and Information Functions
 type JREInfo struct {
-	JavaHome    string `json:"java_home"`
-	JavaVersion string `json:"java_version"`
-	KeytoolPath string `json:"keytool_path"`
-	Available   bool   `json:"available"`
+	JavaHome     string `json:"java_home"`
+	JavaVersion  string `json:"java_version"`
+	MajorVersion int    `json:"major_version,omitempty"` // 0 when unknown
+	KeytoolPath  string `json:"keytool_path"`
+	Available    bool   `json:"available"`
+	Error        string `json:"error,omitempty"`
+}
+
+// stderrTailLines is how many trailing stderr lines are kept in command errors
+const stderrTailLines = 3
+
+// runCommand runs cmd and, on failure, returns an error that includes the last
+// meaningful lines the command wrote to stderr rather than just its exit status
+func runCommand(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	var lines []string
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > stderrTailLines {
+		lines = lines[len(lines)-stderrTailLines:]
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("%s failed: %v", filepath.Base(cmd.Path), err)
+	}
+	return fmt.Errorf("%s failed: %v: %s", filepath.Base(cmd.Path), err, strings.Join(lines, " | "))
 }
 
 func detectJRE(config *AppConfig) *JREInfo {
 	jreInfo := &JREInfo{}
 	
-	// Check for custom paths first
+	// Check for custom paths first. An explicit keytool_path is the most
+	// specific setting and wins over java_home.
 	if config.JRE.JavaHome != "" {
 		jreInfo.JavaHome = config.JRE.JavaHome
 		jreInfo.KeytoolPath = filepath.Join(config.JRE.JavaHome, "bin", "keytool")
-	} else if config.JRE.KeytoolPath != "" {
+	}
+	if config.JRE.KeytoolPath != "" {
 		jreInfo.KeytoolPath = config.JRE.KeytoolPath
 	}
 	
-	// Auto-detect if enabled
+	// Auto-detect if enabled, without overriding the custom paths
 	if config.JRE.AutoDetect {
 		// Try to find java command
-		if javaPath, err := exec.LookPath("java"); err == nil {
+		if javaPath, err := exec.LookPath("java"); err == nil && jreInfo.JavaHome == "" {
 			jreInfo.JavaHome = filepath.Dir(filepath.Dir(javaPath))
 		}
 		
 		// Try to find keytool command
-		if keytoolPath, err := exec.LookPath("keytool"); err == nil {
+		if keytoolPath, err := exec.LookPath("keytool"); err == nil && jreInfo.KeytoolPath == "" {
 			jreInfo.KeytoolPath = keytoolPath
-			jreInfo.Available = true
 		}
-		
-		// Get Java version
-		if cmd := exec.Command("java", "-version"); cmd != nil {
-			if output, err := cmd.CombinedOutput(); err == nil {
-				jreInfo.JavaVersion = strings.Split(string(output), "\n")[0]
+	}
+	
+	// Get the version of the Java that keytool belongs to
+	if javaPath := javaForKeytool(jreInfo.KeytoolPath); javaPath != "" {
+		if output, err := exec.Command(javaPath, "-version").CombinedOutput(); err == nil {
+			jreInfo.JavaVersion = javaVersionLine(string(output))
+			if major, err := parseJavaMajorVersion(jreInfo.JavaVersion); err == nil {
+				jreInfo.MajorVersion = major
 			}
 		}
 	}
 	
-	// Validate keytool availability
+	// Validate keytool availability, refusing a JRE older than jre.min_version
 	if jreInfo.KeytoolPath != "" {
-		if cmd := exec.Command(jreInfo.KeytoolPath, "-help"); cmd != nil {
-			if err := cmd.Run(); err == nil {
-				jreInfo.Available = true
-			}
+		if err := runCommand(exec.Command(jreInfo.KeytoolPath, "-help")); err != nil {
+			jreInfo.Error = err.Error()
+		} else if err := checkMinJavaVersion(jreInfo, config.JRE.MinVersion); err != nil {
+			jreInfo.Error = err.Error()
+		} else {
+			jreInfo.Available = true
 		}
 	}
 	
@@ -539,36 +937,40 @@ func displayJREInfo(jreInfo *JREInfo, config *AppConfig) {
 		return
 	}
 	
-	fmt.Println("\n=== Java Runtime Environment Information ===")
+	printInfo("\n=== Java Runtime Environment Information ===\n")
 	
 	if jreInfo.Available {
-		fmt.Printf("✓ JRE Status: Available\n")
+		printInfo("✓ JRE Status: Available\n")
 		if jreInfo.JavaVersion != "" {
-			fmt.Printf("  Java Version: %s\n", strings.TrimSpace(jreInfo.JavaVersion))
+			printInfo("  Java Version: %s\n", strings.TrimSpace(jreInfo.JavaVersion))
 		}
 		if jreInfo.JavaHome != "" {
-			fmt.Printf("  Java Home: %s\n", jreInfo.JavaHome)
+			printInfo("  Java Home: %s\n", jreInfo.JavaHome)
 		}
 		if jreInfo.KeytoolPath != "" {
-			fmt.Printf("  Keytool Path: %s\n", jreInfo.KeytoolPath)
+			printInfo("  Keytool Path: %s\n", jreInfo.KeytoolPath)
 		}
-		fmt.Printf("  JKS Support: Enabled\n")
-		fmt.Printf("  PKCS12 Support: Enabled\n")
+		printInfo("  JKS Support: Enabled\n")
+		printInfo("  PKCS12 Support: Enabled\n")
 	} else {
 		fmt.Printf("⚠ JRE Status: Not Available\n")
-		fmt.Printf("  JKS Support: Limited (keytool not found)\n")
-		fmt.Printf("  PKCS12 Support: Limited (keytool not found)\n")
-		fmt.Printf("\n")
-		fmt.Printf("To enable full JKS/PKCS12 support:\n")
-		fmt.Printf("  1. Install Java JDK/JRE: https://adoptium.net/\n")
-		fmt.Printf("  2. Ensure 'java' and 'keytool' are in your PATH\n")
-		fmt.Printf("  3. Or configure custom paths in config.yaml:\n")
-		fmt.Printf("     jre:\n")
-		fmt.Printf("       java_home: \"/path/to/java\"\n")
-		fmt.Printf("       keytool_path: \"/path/to/keytool\"\n")
+		printInfo("  JKS Support: Limited (keytool not found)\n")
+		printInfo("  PKCS12 Support: Limited (keytool not found)\n")
+		if jreInfo.Error != "" {
+			fmt.Printf("  Keytool Error: %s\n", jreInfo.Error)
+		}
+		printInfo("\n")
+		printInfo("To enable full JKS/PKCS12 support:\n")
+		printInfo("  1. Install Java JDK/JRE: https://adoptium.net/\n")
+		printInfo("  2. Ensure 'java' and 'keytool' are in your PATH\n")
+		printInfo("  3. Or configure custom paths in config.yaml:\n")
+		printInfo("     jre:\n")
+		printInfo("       java_home: \"/path/to/java\"\n")
+		printInfo("       keytool_path: \"/path/to/keytool\"\n")
 	}
 	
-	fmt.Println("===========================================\n")
+	printInfo("===========================================\n")
+	printInfo("\n")
 }
 
 func promptForJRELocation() string {
@@ -584,14 +986,13 @@ func promptForJRELocation() string {
 		if javaHome != "" {
 			// Validate the provided path
 			keytoolPath := filepath.Join(javaHome, "bin", "keytool")
-			if cmd := exec.Command(keytoolPath, "-help"); cmd != nil {
-				if err := cmd.Run(); err == nil {
-					fmt.Printf("✓ JRE found at: %s\n", javaHome)
-					fmt.Println("You can save this path in config.yaml for future use.")
-					return javaHome
-				}
+			err := runCommand(exec.Command(keytoolPath, "-help"))
+			if err == nil {
+				fmt.Printf("✓ JRE found at: %s\n", javaHome)
+				fmt.Println("You can save this path in config.yaml for future use.")
+				return javaHome
 			}
-			fmt.Printf("⚠ Invalid Java installation at: %s\n", javaHome)
+			fmt.Printf("⚠ Invalid Java installation at: %s (%v)\n", javaHome, err)
 		}
 	}
 	
@@ -607,6 +1008,14 @@ func printUsage() {
 	fmt.Println()
 	fmt.Println("Usage:")
 	fmt.Printf("  %s [options]\n", os.Args[0])
+	fmt.Printf("  %s [options] doctor\n", os.Args[0])
+	fmt.Printf("  %s --noop [options] dedupe STORE...\n", os.Args[0])
+	fmt.Printf("  %s [options] audit [--since T] [--until T] [--status S] [--path P] [-n N] [log files...]\n", os.Args[0])
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  doctor                Check external tools, permissions and webhook reachability")
+	fmt.Println("  audit                 List modifications recorded in local audit logs")
+	fmt.Println("  dedupe STORE...       Report duplicate certificates in PEM, JKS or PKCS12 stores")
 	fmt.Println()
 	fmt.Println("Required Safety Flag:")
 	fmt.Println("      --noop            REQUIRED: Show changes without implementing them")
@@ -614,22 +1023,74 @@ func printUsage() {
 	fmt.Println("Examples:")
 	fmt.Println("  " + os.Args[0] + " --noop --auto -d /path/to/project")
 	fmt.Println("  " + os.Args[0] + " --noop -c /path/to/cert.pem")
+	fmt.Println("  " + os.Args[0] + " --noop --watch -d /path/to/project")
+	fmt.Println("  " + os.Args[0] + " --noop --auto -d /etc,/opt/app -d /usr/lib/jvm")
+	fmt.Println("  " + os.Args[0] + " audit --since 2024-06-01 --status failed")
+	fmt.Println()
+	fmt.Println("Output:")
+	fmt.Println("  -v                    Verbose output, including DEBUG log entries")
+	fmt.Println("  -q                    Quiet output: only warnings, errors and results")
+	fmt.Println()
+	fmt.Println("Exit Codes:")
+	fmt.Println("  0  No changes needed")
+	fmt.Println("  1  Changes applied, or would be applied in noop mode")
+	fmt.Println("  2  Errors encountered")
 }
 
 func main() {
 	flag.Parse()
+	os.Exit(run())
+}
 
+// run executes the tool with the parsed flags and returns its process exit code
+func run() (code int) {
 	// Show help if requested
 	if showHelp {
 		printUsage()
-		return
+		return ExitOK
+	}
+
+	if verbose && quiet {
+		fmt.Println("Error: -v and -q cannot be used together")
+		return ExitError
 	}
 
 	// Load configuration
 	appConfig, err := LoadConfig(configPath)
 	if err != nil {
 		fmt.Printf("Error loading configuration: %v\n", err)
-		os.Exit(1)
+		return ExitError
+	}
+
+	// Explicit tool paths bypass discovery
+	if keytoolPathFlag != "" {
+		appConfig.JRE.KeytoolPath = keytoolPathFlag
+	}
+	if opensslPathFlag != "" {
+		appConfig.Tools.OpenSSLPath = opensslPathFlag
+	}
+
+	// Passwords piped in take precedence over the configured default list
+	if storepassStdin {
+		passwords, err := readStorePasswords(os.Stdin)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return ExitError
+		}
+		appConfig.Operations.DefaultJKSPasswords = append(passwords, appConfig.Operations.DefaultJKSPasswords...)
+	}
+
+	// The doctor command only inspects the host, so it runs without --noop
+	if flag.Arg(0) == "doctor" {
+		if !runDoctor(appConfig) {
+			return ExitError
+		}
+		return ExitOK
+	}
+
+	// The audit command only reads existing logs, so it runs without --noop
+	if flag.Arg(0) == "audit" {
+		return runAudit(appConfig, flag.Args()[1:])
 	}
 
 	// SAFETY CHECK: Enforce --noop requirement
@@ -641,7 +1102,7 @@ func main() {
 		fmt.Println("Example: " + os.Args[0] + " --noop --auto -d /path/to/project")
 		fmt.Println()
 		fmt.Println("Run with -h for help.")
-		os.Exit(1)
+		return ExitError
 	}
 
 	// Initialize structured logging only if enabled
@@ -650,9 +1111,17 @@ func main() {
 		structuredLogger, err = NewStructuredLogger(appConfig)
 		if err != nil {
 			fmt.Printf("Error initializing logger: %v\n", err)
-			os.Exit(1)
+			return ExitError
 		}
-		defer structuredLogger.Finalize()
+		// A failed audit delivery is an error even if the scan itself succeeded
+		defer func() {
+			if err := structuredLogger.Finalize(); err != nil {
+				fmt.Printf("Error finalizing audit log: %v\n", err)
+				if code < ExitError {
+					code = ExitError
+				}
+			}
+		}()
 		
 		// Log startup
 		structuredLogger.LogMessage("INFO", "Trust Store Manager started")
@@ -677,40 +1146,116 @@ func main() {
 		}
 	}
 
+	if flag.Arg(0) == "dedupe" {
+		return runDedupe(appConfig, jreInfo, flag.Args()[1:], structuredLogger)
+	}
+
+	roots := scanRoots(targetDirectories)
+
+	// Runtime trust stores often differ from what config files reference
+	var processStores []ProcessTrustStore
+	if scanProcesses {
+		processStores, err = findProcessTrustStores()
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			if structuredLogger != nil {
+				structuredLogger.LogMessage("WARNING", fmt.Sprintf("Process scanning failed: %v", err))
+			}
+		}
+	}
+
+	// Reported once as findings: discovering a store is not a change to it
+	if len(processStores) > 0 {
+		printInfo("Trust stores referenced by running JVM processes:\n")
+		for _, store := range processStores {
+			printInfo("  %s (%s, PID %d)\n", store.Path, store.StoreType, store.PID)
+			if structuredLogger != nil {
+				structuredLogger.LogMessage("INFO", fmt.Sprintf("Found %s trust store %s used by PID %d", store.StoreType, store.Path, store.PID))
+			}
+		}
+	}
+
+	runScan(roots, jreInfo, structuredLogger)
+
+	if watchMode {
+		err := watchTargetDirectories(roots, watchExclusions(appConfig, roots), watchDebounce, func() {
+			runScan(roots, jreInfo, structuredLogger)
+		})
+		if err != nil {
+			fmt.Printf("Error watching directory: %v\n", err)
+			if structuredLogger != nil {
+				structuredLogger.LogMessage("ERROR", fmt.Sprintf("Watch mode failed: %v", err))
+			}
+			return ExitError
+		}
+	}
+
+	if structuredLogger != nil {
+		structuredLogger.LogMessage("INFO", "Trust Store Manager completed successfully")
+	}
+	printInfo("Operation completed successfully!\n")
+
+	if structuredLogger == nil {
+		return ExitOK
+	}
+	return exitCodeForModifications(structuredLogger.auditLog.Modifications)
+}
+
+// exitCodeForModifications maps the outcome of a scan onto the exit code contract
+func exitCodeForModifications(modifications []TrustStoreModification) int {
+	code := ExitOK
+	for _, modification := range modifications {
+		switch modification.Status {
+		case "failed":
+			return ExitError
+		case "noop", "success":
+			code = ExitChanges
+		}
+	}
+	return code
+}
+
+// runScan processes the trust stores found in the target directory
+func runScan(roots []string, jreInfo *JREInfo, structuredLogger *StructuredLogger) {
 	// Simulate trust store processing
-	fmt.Printf("Starting trust store scan in directory: %s\n", targetDirectory)
+	for _, root := range roots {
+		printInfo("Starting trust store scan in directory: %s\n", root)
+	}
+
+	// Bundled stores are reported only; archives are never rewritten
+	if scanArchives {
+		archiveStores := findArchiveTrustStores(roots)
+		if len(archiveStores) > 0 {
+			printInfo("Trust stores bundled in archives (read-only):\n")
+		}
+		for _, store := range archiveStores {
+			printInfo("  %s!/%s (%s, %d bytes)\n", store.Archive, store.Entry, store.StoreType, store.Size)
+			if structuredLogger != nil {
+				structuredLogger.LogMessage("INFO", fmt.Sprintf("Found %s trust store %s in archive %s", store.StoreType, store.Entry, store.Archive))
+			}
+		}
+	}
 	
 	if noopMode {
-		fmt.Println("NOOP mode: Showing what would be done without making changes")
+		printInfo("NOOP mode: Showing what would be done without making changes\n")
 		
 		if structuredLogger != nil {
 			structuredLogger.LogMessage("NOOP", "Would scan for trust stores")
-			
-			// Example modification logging
-			modification := TrustStoreModification{
-				FilePath:   targetDirectory + "/example.jks",
-				FileType:   "JKS",
-				Operation:  "upsert_certificate",
-				Status:     "noop",
-				NoopOutput: "Would add certificate to trust store",
-			}
-			structuredLogger.LogModification(modification)
+		}
+
+		if len(roots) > 1 {
+			printInfo("\nScanned %d directories\n", len(roots))
 		}
 		
 		// Display trust store type support based on JRE availability
-		fmt.Println("\nSupported Trust Store Types:")
-		fmt.Printf("  ✓ PEM (.pem, .crt) - Always supported\n")
+		printInfo("\nSupported Trust Store Types:\n")
+		printInfo("  ✓ PEM (.pem, .crt) - Always supported\n")
 		if jreInfo.Available {
-			fmt.Printf("  ✓ JKS (.jks, .keystore) - Supported (keytool available)\n")
-			fmt.Printf("  ✓ PKCS12 (.p12, .pfx) - Supported (keytool available)\n")
+			printInfo("  ✓ JKS (.jks, .keystore) - Supported (keytool available)\n")
+			printInfo("  ✓ PKCS12 (.p12, .pfx) - Supported (keytool available)\n")
 		} else {
-			fmt.Printf("  ⚠ JKS (.jks, .keystore) - Limited support (keytool not found)\n")
-			fmt.Printf("  ⚠ PKCS12 (.p12, .pfx) - Limited support (keytool not found)\n")
+			printInfo("  ⚠ JKS (.jks, .keystore) - Limited support (keytool not found)\n")
+			printInfo("  ⚠ PKCS12 (.p12, .pfx) - Limited support (keytool not found)\n")
 		}
 	}
-
-	if structuredLogger != nil {
-		structuredLogger.LogMessage("INFO", "Trust Store Manager completed successfully")
-	}
-	fmt.Println("Operation completed successfully!")
-} 
\ No newline at end of file
+} 
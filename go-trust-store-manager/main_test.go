@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	failingWebhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingWebhook.Close()
+
+	tests := []struct {
+		name       string
+		webhookURL string
+		want       int
+	}{
+		{"clean noop run", "", ExitOK},
+		{"failed webhook delivery", failingWebhook.URL, ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "run-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			config := filepath.Join(dir, "config.yaml")
+			data := fmt.Sprintf("logging:\n  local_log_path: %q\n  webhook_url: %q\n", filepath.Join(dir, "logs", "scan.log"), tt.webhookURL)
+			if err := ioutil.WriteFile(config, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			scanDir := filepath.Join(dir, "project")
+			if err := os.Mkdir(scanDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			defer func(dirs directoryList, path string, noop, q bool) {
+				targetDirectories, configPath, noopMode, quiet = dirs, path, noop, q
+			}(targetDirectories, configPath, noopMode, quiet)
+			targetDirectories = directoryList{scanDir}
+			configPath = config
+			noopMode = true
+			quiet = true
+
+			if got := run(); got != tt.want {
+				t.Errorf("run() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeForModifications(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		want     int
+	}{
+		{"no modifications", nil, ExitOK},
+		{"noop modification", []string{"noop"}, ExitChanges},
+		{"applied modification", []string{"success", "noop"}, ExitChanges},
+		{"failed modification", []string{"success", "failed"}, ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var modifications []TrustStoreModification
+			for _, status := range tt.statuses {
+				modifications = append(modifications, TrustStoreModification{Status: status})
+			}
+			if got := exitCodeForModifications(modifications); got != tt.want {
+				t.Errorf("exitCodeForModifications() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
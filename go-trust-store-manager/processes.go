@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JVM system properties that name the runtime trust store
+const (
+	trustStoreProperty     = "-Djavax.net.ssl.trustStore="
+	trustStoreTypeProperty = "-Djavax.net.ssl.trustStoreType="
+)
+
+// ProcessTrustStore is a trust store referenced by a running JVM
+type ProcessTrustStore struct {
+	PID       int
+	Path      string
+	StoreType string
+}
+
+// findProcessTrustStores inspects the command line of every running process
+// for javax.net.ssl.trustStore and returns the referenced stores, one entry per
+// distinct path. Relative paths are resolved against the process's working
+// directory. Processes that cannot be read are skipped.
+func findProcessTrustStores() ([]ProcessTrustStore, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("process scanning is only supported on Linux")
+	}
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var stores []ProcessTrustStore
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+
+		store := ProcessTrustStore{PID: pid, StoreType: "JKS"}
+		for _, arg := range strings.Split(string(cmdline), "\x00") {
+			switch {
+			case strings.HasPrefix(arg, trustStoreProperty):
+				store.Path = strings.TrimPrefix(arg, trustStoreProperty)
+			case strings.HasPrefix(arg, trustStoreTypeProperty):
+				store.StoreType = strings.ToUpper(strings.TrimPrefix(arg, trustStoreTypeProperty))
+			}
+		}
+		if store.Path == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(store.Path) {
+			if cwd, err := os.Readlink(filepath.Join("/proc", entry.Name(), "cwd")); err == nil {
+				store.Path = filepath.Join(cwd, store.Path)
+			}
+		}
+		store.Path = filepath.Clean(store.Path)
+
+		if seen[store.Path] {
+			continue
+		}
+		seen[store.Path] = true
+		stores = append(stores, store)
+	}
+
+	sort.Slice(stores, func(i, j int) bool { return stores[i].Path < stores[j].Path })
+	return stores, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Syslog severities (RFC 5424 section 6.2.1)
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityNotice  = 5
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// syslogDialTimeout bounds how long connecting to a remote syslog server may take
+const syslogDialTimeout = 5 * time.Second
+
+// syslogSDID is the structured data element carrying log entry fields
+const syslogSDID = "tsm@32473"
+
+// syslogFacilities maps facility names to their RFC 5424 codes
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// SyslogConfig configures log delivery to local or remote syslog
+type SyslogConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Network is "udp", "tcp" or "tls" for a remote server, or empty for local syslog
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	Facility string `yaml:"facility"`
+	Tag      string `yaml:"tag"`
+}
+
+// syslogSender delivers log entries to syslog
+type syslogSender interface {
+	Send(severity int, msgID, message string, fields map[string]string) error
+	Close() error
+}
+
+// severityForLevel maps a log level onto a syslog severity
+func severityForLevel(level string) int {
+	switch strings.ToUpper(level) {
+	case "ERROR":
+		return severityError
+	case "WARN", "WARNING":
+		return severityWarning
+	case "NOOP":
+		return severityNotice
+	case "DEBUG":
+		return severityDebug
+	default:
+		return severityInfo
+	}
+}
+
+// newSyslogSender connects to the syslog destination described by config
+func newSyslogSender(config SyslogConfig) (syslogSender, error) {
+	facility, ok := syslogFacilities[strings.ToLower(config.Facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", config.Facility)
+	}
+
+	switch strings.ToLower(config.Network) {
+	case "":
+		return newLocalSyslog(facility, config.Tag)
+	case "udp", "tcp", "tls":
+		if config.Address == "" {
+			return nil, fmt.Errorf("logging.syslog.address is required for %s syslog", config.Network)
+		}
+		sender := &remoteSyslog{
+			network:  strings.ToLower(config.Network),
+			address:  config.Address,
+			facility: facility,
+			tag:      config.Tag,
+		}
+		if err := sender.connect(); err != nil {
+			return nil, err
+		}
+		return sender, nil
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q (expected udp, tcp or tls)", config.Network)
+	}
+}
+
+// flattenFields renders fields as sorted key=value pairs for plain-text syslog
+func flattenFields(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, fields[key]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// remoteSyslog sends RFC 5424 messages to a syslog server over UDP, TCP or TLS.
+// Stream transports use octet-counting framing (RFC 6587).
+type remoteSyslog struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+func (r *remoteSyslog) connect() error {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if r.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.address, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial(r.network, r.address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog server %s: %v", r.address, err)
+	}
+
+	r.conn = conn
+	if r.hostname == "" {
+		r.hostname, _ = os.Hostname()
+	}
+	return nil
+}
+
+// Send writes one message, reconnecting once if the connection has dropped
+func (r *remoteSyslog) Send(severity int, msgID, message string, fields map[string]string) error {
+	line := r.format(severity, msgID, message, fields)
+	if r.network != "udp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+
+	if r.conn != nil {
+		if _, err := r.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		r.conn.Close()
+		r.conn = nil
+	}
+	if err := r.connect(); err != nil {
+		return err
+	}
+	_, err := r.conn.Write([]byte(line))
+	return err
+}
+
+// format renders an RFC 5424 message with fields as structured data
+func (r *remoteSyslog) format(severity int, msgID, message string, fields map[string]string) string {
+	structured := "-"
+	if len(fields) > 0 {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var sd strings.Builder
+		sd.WriteString("[" + syslogSDID)
+		for _, key := range keys {
+			// PARAM-VALUE must escape '"', '\' and ']'
+			value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(fields[key])
+			fmt.Fprintf(&sd, ` %s="%s"`, key, value)
+		}
+		sd.WriteString("]")
+		structured = sd.String()
+	}
+
+	hostname := r.hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		r.facility*8+severity, time.Now().Format(time.RFC3339Nano), hostname, r.tag,
+		os.Getpid(), msgID, structured, message)
+}
+
+func (r *remoteSyslog) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	return r.conn.Close()
+}
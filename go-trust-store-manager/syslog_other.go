@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package main
+
+import "fmt"
+
+// newLocalSyslog reports that there is no local syslog daemon on this platform.
+// A remote server can still be used by setting logging.syslog.network.
+func newLocalSyslog(facility int, tag string) (syslogSender, error) {
+	return nil, fmt.Errorf("local syslog is not available on this platform; set logging.syslog.network to use a remote server")
+}
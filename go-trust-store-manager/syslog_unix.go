@@ -0,0 +1,46 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// localSyslog sends messages to the local syslog daemon
+type localSyslog struct {
+	writer *syslog.Writer
+}
+
+// newLocalSyslog connects to the local syslog daemon
+func newLocalSyslog(facility int, tag string) (syslogSender, error) {
+	writer, err := syslog.New(syslog.Priority(facility<<3)|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to local syslog: %v", err)
+	}
+	return &localSyslog{writer: writer}, nil
+}
+
+// Send writes one message, with its fields flattened into the text
+func (l *localSyslog) Send(severity int, msgID, message string, fields map[string]string) error {
+	if len(fields) > 0 {
+		message = fmt.Sprintf("%s: %s %s", msgID, message, flattenFields(fields))
+	}
+
+	switch severity {
+	case severityError:
+		return l.writer.Err(message)
+	case severityWarning:
+		return l.writer.Warning(message)
+	case severityNotice:
+		return l.writer.Notice(message)
+	case severityDebug:
+		return l.writer.Debug(message)
+	default:
+		return l.writer.Info(message)
+	}
+}
+
+func (l *localSyslog) Close() error {
+	return l.writer.Close()
+}
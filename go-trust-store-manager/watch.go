@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchTargetDirectories blocks until interrupted, calling onChange once the
+// directory trees have been quiet for the debounce period after a change
+func watchTargetDirectories(roots, exclude []string, debounce time.Duration, onChange func()) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	return watchUntil(roots, exclude, debounce, onChange, signals)
+}
+
+// watchUntil watches roots until a value arrives on stop. Only changes to
+// trust store and certificate files trigger onChange, and directories in
+// exclude are not watched, so the tool's own logs and backups written during a
+// scan cannot trigger another scan.
+func watchUntil(roots, exclude []string, debounce time.Duration, onChange func(), stop <-chan os.Signal) error {
+	watcher, err := newTreeWatcher(roots, exclude)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	printInfo("Watching %s for trust store changes (Ctrl+C to stop)\n", strings.Join(roots, ", "))
+	return watchEvents(watcher, exclude, debounce, onChange, stop)
+}
+
+// newTreeWatcher returns a watcher registered on every directory under roots
+// except those in exclude
+func newTreeWatcher(roots, exclude []string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %v", err)
+	}
+
+	for _, root := range roots {
+		if err := addWatchRecursive(watcher, root, exclude); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return watcher, nil
+}
+
+// watchEvents debounces the events of watcher into calls to onChange until a
+// value arrives on stop
+func watchEvents(watcher *fsnotify.Watcher, exclude []string, debounce time.Duration, onChange func(), stop <-chan os.Signal) error {
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if isExcludedPath(event.Name, exclude) {
+				continue
+			}
+			// Newly created directories must be watched explicitly
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatchRecursive(watcher, event.Name, exclude)
+					continue
+				}
+			}
+			if !isWatchedFile(event.Name) {
+				continue
+			}
+			if verbose {
+				fmt.Printf("Change detected: %s\n", event)
+			}
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("Watch error: %v\n", err)
+
+		case <-timer.C:
+			printInfo("\nTrust store changes detected, re-scanning...\n")
+			onChange()
+
+		case <-stop:
+			fmt.Println("\nStopping watch mode")
+			return nil
+		}
+	}
+}
+
+// addWatchRecursive registers root and every directory beneath it with the
+// watcher, skipping .git and excluded directories
+func addWatchRecursive(watcher *fsnotify.Watcher, root string, exclude []string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == ".git" || isExcludedPath(path, exclude) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// isWatchedFile reports whether a change to path can affect a scan result
+func isWatchedFile(path string) bool {
+	if isTrustStoreEntry(path) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pem", ".crt", ".cer", ".cert", ".der":
+		return true
+	}
+	return false
+}
+
+// isExcludedPath reports whether path is one of the excluded directories or
+// lies beneath one
+func isExcludedPath(path string, exclude []string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	for _, dir := range exclude {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchExclusions returns the absolute log and backup directories the tool
+// writes to during a scan. A directory that is or contains a scan root is left
+// out, since excluding it would stop the root being watched at all; events on
+// the log file itself are still ignored by extension.
+func watchExclusions(config *AppConfig, roots []string) []string {
+	dirs := []string{filepath.Dir(config.Logging.LocalLogPath)}
+	if config.Security.BackupDir != "" {
+		dirs = append(dirs, config.Security.BackupDir)
+	}
+
+	var exclude []string
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if isExcludedPath(abs, exclude) {
+			continue
+		}
+		coversRoot := false
+		for _, root := range roots {
+			if isExcludedPath(root, []string{abs}) {
+				coversRoot = true
+				break
+			}
+		}
+		if !coversRoot {
+			exclude = append(exclude, abs)
+		}
+	}
+	return exclude
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(deadline time.Duration, cond func() bool) bool {
+	for end := time.Now().Add(deadline); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestWatchIgnoresScanOutput(t *testing.T) {
+	const debounce = 50 * time.Millisecond
+	root := t.TempDir()
+
+	config := &AppConfig{}
+	config.Logging.LocalLogPath = filepath.Join(root, "logs", "trust-store-manager.log")
+	config.Security.BackupDir = filepath.Join(root, "backups")
+	for _, dir := range []string{"logs", "backups"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each scan writes a log, a backup and a log in the root, as a real run can
+	var scans int32
+	scan := func() {
+		n := atomic.AddInt32(&scans, 1)
+		stamp := []byte(time.Now().String())
+		ioutil.WriteFile(config.Logging.LocalLogPath, stamp, 0644)
+		ioutil.WriteFile(filepath.Join(root, "backups", fmt.Sprintf("app.jks.%d", n)), stamp, 0644)
+		ioutil.WriteFile(filepath.Join(root, "scan.log"), stamp, 0644)
+	}
+
+	// The watcher is registered before the store changes, so the change cannot be missed
+	exclude := watchExclusions(config, []string{root})
+	watcher, err := newTreeWatcher([]string{root}, exclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- watchEvents(watcher, exclude, debounce, scan, stop)
+	}()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "app.jks"), []byte("store"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(5*time.Second, func() bool { return atomic.LoadInt32(&scans) >= 1 }) {
+		t.Fatal("no scan after a trust store change")
+	}
+	// A scan triggered by its own output would follow within one debounce period
+	if waitFor(10*debounce, func() bool { return atomic.LoadInt32(&scans) > 1 }) {
+		t.Errorf("got %d scans after one trust store change, want 1", atomic.LoadInt32(&scans))
+	}
+
+	stop <- os.Interrupt
+	if err := <-done; err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+}
+
+func TestWatchExclusions(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		logPath string
+		backup  string
+		want    []string
+	}{
+		{"log and backup dirs", "./logs/scan.log", "./backups", []string{filepath.Join(cwd, "logs"), filepath.Join(cwd, "backups")}},
+		{"log in the scan root", "./scan.log", "", nil},
+		{"log dir above the root", "../scan.log", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &AppConfig{}
+			config.Logging.LocalLogPath = tt.logPath
+			config.Security.BackupDir = tt.backup
+			got := watchExclusions(config, []string{cwd})
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
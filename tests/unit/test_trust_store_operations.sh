@@ -119,6 +119,78 @@ jre:
   auto_detect: true
   display_info_in_noop: true
 EOF
+
+    create_fake_tools
+}
+
+# Write the fake keytool and openssl that the hermetic handler tests pass to
+# auto_trust_store_manager.sh with --keytool-path and --openssl-path. Both
+# record their calls in $FAKE_LOG; $FAKE_FAIL makes one step fail, and
+# $FAKE_JDKTRUST makes openssl offer -jdktrust, as OpenSSL 3.2 does.
+create_fake_tools() {
+    export FAKE_BIN="$TEST_TEMP_DIR/bin"
+    export FAKE_LOG="$TEST_TEMP_DIR/fake-tools.log"
+    export FAKE_SSH_BIN="$TEST_TEMP_DIR/ssh-bin"
+    mkdir -p "$FAKE_BIN" "$FAKE_SSH_BIN"
+
+    # Accepts only $FAKE_STOREPASS; -importcert marks the keystore, which the
+    # verifying -list -alias then looks for
+    cat > "$FAKE_BIN/keytool" << 'EOF'
+#!/bin/bash
+echo "keytool $*" >> "$FAKE_LOG"
+args=" $* "
+case "$args" in
+    *" -storepass $FAKE_STOREPASS "*|*" -deststorepass $FAKE_STOREPASS "*) ;;
+    *) echo "keytool error: java.io.IOException: Keystore was tampered with, or password was incorrect" >&2; exit 1 ;;
+esac
+store=$(sed -n 's/.* -\(dest\)\{0,1\}keystore \([^ ]*\) .*/\2/p' <<< "$args")
+case "$args" in
+    *" -importcert "*|*" -importkeystore "*)
+        [[ "${FAKE_FAIL:-}" == "import" ]] && { echo "keytool error: import failed" >&2; exit 1; }
+        echo "imported" >> "$store"
+        ;;
+    *" -list "*" -alias "*)
+        [[ "${FAKE_FAIL:-}" == "verify" ]] && { echo "keytool error: alias does not exist" >&2; exit 1; }
+        grep -q "imported" "$store"
+        ;;
+esac
+EOF
+
+    # Runs the remote command here for any host but "down", which is
+    # unreachable. It has a directory of its own, to go first in PATH.
+    cat > "$FAKE_SSH_BIN/ssh" << 'EOF'
+#!/bin/bash
+while [ "$1" = "-o" ]; do shift 2; done
+echo "ssh $1" >> "$FAKE_LOG"
+[[ "$1" == "down" ]] && { echo "ssh: connect to host down port 22: Connection refused" >&2; exit 255; }
+shift
+exec sh -c "$*"
+EOF
+
+    # Runs the real openssl, except that pkcs12 -export fails with FAKE_FAIL=export
+    cat > "$FAKE_BIN/openssl" << 'EOF'
+#!/bin/bash
+echo "openssl $*" >> "$FAKE_LOG"
+if [[ "${FAKE_FAIL:-}" == "export" && " $* " == *" pkcs12 -export "* ]]; then
+    echo "pkcs12: export failed" >&2
+    exit 1
+fi
+if [[ -n "${FAKE_JDKTRUST:-}" && "$*" == "pkcs12 -help" ]]; then
+    echo " -jdktrust val        Mark certificate in PKCS#12 store as trusted for JDK compatibility"
+    exit 0
+fi
+if [[ -n "${FAKE_JDKTRUST:-}" && " $* " == *" -jdktrust "* ]]; then
+    args=()
+    while [ $# -gt 0 ]; do
+        [[ "$1" == "-jdktrust" ]] && { shift 2; continue; }
+        args+=("$1")
+        shift
+    done
+    set -- "${args[@]}"
+fi
+exec openssl "$@"
+EOF
+    chmod +x "$FAKE_BIN/keytool" "$FAKE_BIN/openssl" "$FAKE_SSH_BIN/ssh"
 }
 
 cleanup_test_environment() {
@@ -308,6 +380,299 @@ test_pem_invalid_handling() {
     ! openssl x509 -in "$invalid_pem" -text -noout >/dev/null 2>&1
 }
 
+# Hermetic handler tests: auto_trust_store_manager.sh against the fake tools
+run_bash_manager() {
+    local store_dir="$1"
+    shift
+    : > "$FAKE_LOG"
+    bash "$PROJECT_ROOT/bash-trust-store-manager/auto_trust_store_manager.sh" -d "$store_dir" \
+        -c "$FIXTURES_DIR/certificates/test-ca.pem" -l "$store_dir.log" \
+        --keytool-path "$FAKE_BIN/keytool" --openssl-path "$FAKE_BIN/openssl" "$@" || true
+}
+
+create_fake_jks() {
+    local store_dir="$TEST_TEMP_DIR/$1"
+    rm -rf "$store_dir"
+    mkdir -p "$store_dir"
+    printf '\xfe\xed\xfe\xed\x00\x00\x00\x02original\n' > "$store_dir/app.jks"
+    cp "$store_dir/app.jks" "$store_dir.orig"
+    echo "$store_dir"
+}
+
+create_pkcs12() {
+    local store_dir="$TEST_TEMP_DIR/$1"
+    rm -rf "$store_dir"
+    mkdir -p "$store_dir"
+    openssl pkcs12 -export -nokeys -in "$FIXTURES_DIR/certificates/server.crt" \
+        -passout pass:secret -out "$store_dir/app.p12" || return 1
+    cp "$store_dir/app.p12" "$store_dir.orig"
+    echo "$store_dir"
+}
+
+test_fake_jks_password_iteration() {
+    local store_dir
+    store_dir=$(create_fake_jks jks-passwords) || return 1
+    FAKE_STOREPASS=secret run_bash_manager "$store_dir"
+
+    # Every common password before "secret" was tried, and the import used "secret"
+    local password
+    for password in changeit changeme password keystore truststore; do
+        grep -q -- "-list -keystore $store_dir/app.jks -storepass $password\$" "$FAKE_LOG" || return 1
+    done
+    grep -q -- "-importcert .* -storepass secret " "$FAKE_LOG" &&
+        grep -q "imported" "$store_dir/app.jks"
+}
+
+test_fake_jks_backup() {
+    local store_dir
+    store_dir=$(create_fake_jks jks-backup) || return 1
+    FAKE_STOREPASS=changeit run_bash_manager "$store_dir"
+
+    local backup
+    backup=$(ls "$store_dir"/app.jks.bak.* 2>/dev/null | head -n 1)
+    [[ -n "$backup" ]] && cmp -s "$backup" "$store_dir.orig"
+}
+
+test_fake_jks_import_failure() {
+    local store_dir
+    store_dir=$(create_fake_jks jks-import-failure) || return 1
+    FAKE_STOREPASS=changeit FAKE_FAIL=import run_bash_manager "$store_dir"
+
+    grep -q -- "-importcert " "$FAKE_LOG" &&
+        cmp -s "$store_dir/app.jks" "$store_dir.orig" &&
+        [[ ! -e "$store_dir/app.jks.tmp" ]]
+}
+
+test_fake_jks_verify_failure() {
+    local store_dir
+    store_dir=$(create_fake_jks jks-verify-failure) || return 1
+    FAKE_STOREPASS=changeit FAKE_FAIL=verify run_bash_manager "$store_dir"
+
+    grep -q "Failed to verify certificate import" "$store_dir.log" &&
+        cmp -s "$store_dir/app.jks" "$store_dir.orig" &&
+        [[ ! -e "$store_dir/app.jks.tmp" ]]
+}
+
+test_fake_jks_alias() {
+    local store_dir
+    store_dir=$(create_fake_jks jks-alias) || return 1
+    FAKE_STOREPASS=changeit run_bash_manager "$store_dir"
+
+    # The default alias is the CN and the start of the SHA-256 fingerprint
+    local hash
+    hash=$(openssl x509 -noout -sha256 -fingerprint -in "$FIXTURES_DIR/certificates/test-ca.pem" |
+        sed 's/.*=//' | tr -d ':' | tr '[:upper:]' '[:lower:]' | cut -c 1-8)
+    grep -q -- "-importcert .* -alias test-root-ca-$hash " "$FAKE_LOG" || return 1
+
+    store_dir=$(create_fake_jks jks-alias-override) || return 1
+    FAKE_STOREPASS=changeit run_bash_manager "$store_dir" --alias corp-root-ca
+    grep -q -- "-importcert .* -alias corp-root-ca " "$FAKE_LOG"
+}
+
+test_fake_jks_wrong_passwords() {
+    local store_dir
+    store_dir=$(create_fake_jks jks-wrong-passwords) || return 1
+    FAKE_STOREPASS=not-a-common-password run_bash_manager "$store_dir"
+
+    grep -q "Could not access JKS file" "$store_dir.log" &&
+        ! grep -q -- "-importcert " "$FAKE_LOG" &&
+        cmp -s "$store_dir/app.jks" "$store_dir.orig" &&
+        ! ls "$store_dir"/app.jks.bak.* >/dev/null 2>&1
+}
+
+# A sync that adds several certificates to a JKS store imports them with one
+# keytool -importkeystore when openssl offers -jdktrust, and with a keytool
+# -importcert each otherwise
+test_fake_jks_batch_import() {
+    local roots="$TEST_TEMP_DIR/batch-roots"
+    mkdir -p "$roots"
+    local i
+    for i in 1 2 3; do
+        openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 365 \
+            -subj "/CN=Batch CA $i" -keyout /dev/null -out "$roots/ca-$i.crt" 2>/dev/null || return 1
+    done
+
+    # --roots-dir takes no -c, so the script is run without run_bash_manager
+    local script="$PROJECT_ROOT/bash-trust-store-manager/auto_trust_store_manager.sh"
+    local tools=(--keytool-path "$FAKE_BIN/keytool" --openssl-path "$FAKE_BIN/openssl")
+    local store_dir
+    store_dir=$(create_fake_jks jks-batch) || return 1
+    : > "$FAKE_LOG"
+    FAKE_STOREPASS=changeit FAKE_JDKTRUST=true bash "$script" -d "$store_dir" --roots-dir "$roots" \
+        -l "$store_dir.log" "${tools[@]}" || true
+    [[ $(grep -c -- "-importkeystore " "$FAKE_LOG") -eq 1 ]] || return 1
+    [[ $(grep -o -- "-caname batch-ca-" "$FAKE_LOG" | wc -l) -eq 3 ]] || return 1
+    ! grep -q -- "-importcert " "$FAKE_LOG" || return 1
+    grep -q "imported" "$store_dir/app.jks" || return 1
+
+    store_dir=$(create_fake_jks jks-no-batch) || return 1
+    : > "$FAKE_LOG"
+    FAKE_STOREPASS=changeit bash "$script" -d "$store_dir" --roots-dir "$roots" -l "$store_dir.log" "${tools[@]}" || true
+    ! grep -q -- "-importkeystore " "$FAKE_LOG" || return 1
+    [[ $(grep -c -- "-importcert " "$FAKE_LOG") -eq 3 ]]
+}
+
+test_fake_pkcs12_password_iteration() {
+    local store_dir
+    store_dir=$(create_pkcs12 p12-passwords) || return 1
+    run_bash_manager "$store_dir"
+
+    grep -q -- "pkcs12 -in $store_dir/app.p12 -nokeys -passin pass:changeit " "$FAKE_LOG" &&
+        grep -q -- "pkcs12 -export .* -passout pass:secret " "$FAKE_LOG" &&
+        [[ $(openssl pkcs12 -in "$store_dir/app.p12" -nokeys -passin pass:secret 2>/dev/null | grep -c "BEGIN CERTIFICATE") -eq 2 ]]
+}
+
+test_fake_pkcs12_export_failure() {
+    local store_dir
+    store_dir=$(create_pkcs12 p12-export-failure) || return 1
+    FAKE_FAIL=export run_bash_manager "$store_dir"
+
+    grep -q "Failed to update PKCS12 file" "$store_dir.log" &&
+        cmp -s "$store_dir/app.p12" "$store_dir.orig"
+}
+
+# File type detection: each fixture and the type that auto_trust_store_manager.sh
+# reports for it. Extensionless names make the content decide.
+DETECT_FILE_TYPE_CASES=(
+    "bundle.pem PEM"
+    "ca-bundle PEM"
+    "ca-bundle.crt.gz PEM"
+    "server.der UNKNOWN"
+    "server-der.crt UNKNOWN"
+    "jks-store JKS"
+    "jceks-store JCEKS"
+    "store.p12 PKCS12"
+    "pkcs12-store PKCS12"
+    "random.bin UNKNOWN"
+)
+
+create_detect_fixtures() {
+    local dir="$1"
+    local certs="$FIXTURES_DIR/certificates"
+    mkdir -p "$dir"
+
+    cp "$FIXTURES_DIR/pem/multi-cert-trust-store.pem" "$dir/bundle.pem"
+    cp "$FIXTURES_DIR/pem/basic-trust-store.pem" "$dir/ca-bundle"
+    gzip -c "$FIXTURES_DIR/pem/basic-trust-store.pem" > "$dir/ca-bundle.crt.gz"
+    openssl x509 -in "$certs/server.crt" -outform DER -out "$dir/server.der" || return 1
+    cp "$dir/server.der" "$dir/server-der.crt"
+    printf '\xfe\xed\xfe\xed\x00\x00\x00\x02\x00\x00\x00\x00' > "$dir/jks-store"
+    printf '\xce\xce\xce\xce\x00\x00\x00\x02\x00\x00\x00\x00' > "$dir/jceks-store"
+    openssl pkcs12 -export -nokeys -in "$certs/server.crt" -passout pass:changeit -out "$dir/store.p12" || return 1
+    cp "$dir/store.p12" "$dir/pkcs12-store"
+    printf '\x7fELF\x02\x01\x01\x00random binary\x00\x01' > "$dir/random.bin"
+}
+
+test_detect_file_type() {
+    local dir="$TEST_TEMP_DIR/detect"
+    create_detect_fixtures "$dir" || return 1
+
+    local output
+    output=$(run_bash_manager "$dir" --noop --glob '*' 2>&1)
+
+    local case name expected actual failed=0
+    for case in "${DETECT_FILE_TYPE_CASES[@]}"; do
+        read -r name expected <<< "$case"
+        actual=$(sed -n "s|.*Processing trust store: $dir/$name (Type: \(.*\))\$|\1|p" <<< "$output")
+        if [[ "$actual" != "$expected" ]]; then
+            echo "$name: detected ${actual:-nothing}, want $expected"
+            failed=1
+        fi
+    done
+    [[ $failed -eq 0 ]]
+}
+
+test_der_certificate_unchanged() {
+    local dir="$TEST_TEMP_DIR/detect-der"
+    mkdir -p "$dir"
+    openssl x509 -in "$FIXTURES_DIR/certificates/server.crt" -outform DER -out "$dir/server.crt" || return 1
+    cp "$dir/server.crt" "$dir.orig"
+    run_bash_manager "$dir"
+
+    cmp -s "$dir/server.crt" "$dir.orig"
+}
+
+# A CRLF store keeps CRLF line endings, and an LF store LF ones, whatever
+# the line endings of the appended certificate
+test_pem_crlf_line_endings() {
+    local dir="$TEST_TEMP_DIR/crlf"
+    mkdir -p "$dir"
+    sed 's/$/\r/' "$FIXTURES_DIR/pem/basic-trust-store.pem" > "$dir/crlf.pem"
+    cp "$FIXTURES_DIR/pem/basic-trust-store.pem" "$dir/lf.pem"
+    sed 's/$/\r/' "$FIXTURES_DIR/certificates/client.crt" > "$TEST_TEMP_DIR/crlf-cert.pem"
+    bash "$PROJECT_ROOT/bash-trust-store-manager/auto_trust_store_manager.sh" -d "$dir" \
+        -c "$TEST_TEMP_DIR/crlf-cert.pem" -l "$dir.log" || true
+
+    local lines
+    lines=$(wc -l < "$dir/crlf.pem")
+    [[ $(grep -c "BEGIN CERTIFICATE" "$dir/crlf.pem") -eq 2 ]] &&
+        [[ $(grep -c $'\r$' "$dir/crlf.pem") -eq $lines ]] &&
+        [[ $(grep -c "BEGIN CERTIFICATE" "$dir/lf.pem") -eq 2 ]] &&
+        ! grep -q $'\r' "$dir/lf.pem"
+}
+
+# A newline is added before the appended certificate only when the store's
+# last line lacks one: no blank line, and no leading newline in an empty store
+test_pem_final_newline() {
+    local dir="$TEST_TEMP_DIR/newline"
+    mkdir -p "$dir"
+    printf '%s' "$(cat "$FIXTURES_DIR/certificates/client.crt")" > "$dir/no-newline.pem"
+    cp "$FIXTURES_DIR/certificates/client.crt" "$dir/newline.pem"
+    : > "$dir/empty.pem"
+    run_bash_manager "$dir" --glob '*.pem'
+
+    local store
+    for store in no-newline newline; do
+        [[ $(grep -cx -- "-----BEGIN CERTIFICATE-----" "$dir/$store.pem") -eq 2 ]] || return 1
+        ! grep -q '^$' "$dir/$store.pem" || return 1
+    done
+    [[ "$(head -n 1 "$dir/empty.pem")" == "-----BEGIN CERTIFICATE-----" ]]
+}
+
+# --hosts dry-runs the scan on each host, over the fake ssh, and reports
+# every host: the reachable one with its summary, the other as unreachable
+test_hosts_scan() {
+    local store_dir="$TEST_TEMP_DIR/hosts-scan"
+    mkdir -p "$store_dir"
+    cp "$FIXTURES_DIR/certificates/client.crt" "$store_dir/store.pem"
+    cp "$store_dir/store.pem" "$store_dir.orig"
+    printf '# fleet\ndeploy@web-01 %s  # app\n\ndown\n' "$store_dir" > "$TEST_TEMP_DIR/inventory.txt"
+
+    : > "$FAKE_LOG"
+    local output status=0
+    output=$(PATH="$FAKE_SSH_BIN:$PATH" bash "$PROJECT_ROOT/bash-trust-store-manager/auto_trust_store_manager.sh" \
+        --hosts "$TEST_TEMP_DIR/inventory.txt" -c "$FIXTURES_DIR/certificates/test-ca.pem" \
+        -l "$store_dir.log" 2>&1) || status=$?
+
+    [ $status -ne 0 ] || return 1
+    cmp -s "$store_dir/store.pem" "$store_dir.orig" || return 1
+    grep -qx "ssh deploy@web-01" "$FAKE_LOG" || return 1
+    grep -q "deploy@web-01: 1 trust stores scanned, 1 would be modified, 0 failed" <<< "$output" || return 1
+    grep -q "down: unreachable: ssh: connect to host down" <<< "$output" || return 1
+    grep -q "Hosts failed: 1" <<< "$output" || return 1
+    grep -q "Would process trust store: $store_dir/store.pem" "$store_dir.log"
+}
+
+# --db records the stores, certificates and findings of each run; a second
+# run updates the rows, and a certificate removed since keeps its old last_seen
+test_results_db() {
+    local store_dir="$TEST_TEMP_DIR/results-db"
+    local db="$TEST_TEMP_DIR/results.db"
+    mkdir -p "$store_dir"
+    cat "$FIXTURES_DIR/certificates/client.crt" "$FIXTURES_DIR/certificates/expired.crt" > "$store_dir/store.pem"
+
+    run_bash_manager "$store_dir" --noop --db "$db"
+    [[ $(sqlite3 "$db" "SELECT count(*) FROM certificates") -eq 2 ]] || return 1
+    [[ $(sqlite3 "$db" "SELECT count(*) FROM findings WHERE kind = 'expired' AND subject LIKE '%CN=expired.example.com%'") -eq 1 ]] || return 1
+
+    sleep 1
+    cp "$FIXTURES_DIR/certificates/client.crt" "$store_dir/store.pem"
+    run_bash_manager "$store_dir" --noop --db "$db"
+    [[ $(sqlite3 "$db" "SELECT count(*) FROM stores WHERE status = 'noop' AND first_scanned < last_scanned") -eq 1 ]] || return 1
+    [[ $(sqlite3 "$db" "SELECT count(*) FROM certificates c JOIN stores s
+        ON s.host = c.host AND s.path = c.store AND c.last_seen = s.last_scanned") -eq 1 ]]
+}
+
 # Test configuration and logging
 test_config_loading() {
     local bash_script="$PROJECT_ROOT/bash-trust-store-manager/trust-store-manager-enterprise.sh"
@@ -364,6 +729,48 @@ test_large_trust_store_performance() {
     [[ $duration -lt 30 ]]
 }
 
+# Process a bundle of 150 certificates, the size of the Mozilla bundle: the
+# expiry check, the check for an already present certificate and --state-file
+# read every certificate in it. This took half a minute with an openssl
+# process per certificate. The fingerprints that the state file records must
+# match openssl's.
+test_large_bundle_performance() {
+    local dir="$TEST_TEMP_DIR/large-bundle"
+    local state="$TEST_TEMP_DIR/large-bundle.state"
+    mkdir -p "$dir"
+    local i
+    for i in {1..10}; do
+        openssl req -x509 -newkey ec -pkeyopt ec_paramgen_curve:P-256 -nodes -days 365 \
+            -subj "/CN=Bundle CA $i" -keyout /dev/null -out "$dir/ca-$i.crt" 2>/dev/null || return 1
+    done
+    for i in {1..15}; do
+        cat "$dir"/ca-*.crt
+    done > "$dir/bundle.pem"
+
+    local start_time=$(date +%s)
+    run_bash_manager "$dir" --state-file "$state" --glob bundle.pem
+    local duration=$(($(date +%s) - start_time))
+    echo "Processed $(grep -c "BEGIN CERTIFICATE" "$dir/bundle.pem") certificates in ${duration}s"
+
+    local expected actual
+    expected=$(pem_fingerprints "$dir"/ca-*.crt "$FIXTURES_DIR/certificates/test-ca.pem" | sort -u)
+    actual=$(awk -F '\x1f' 'NR > 1 { print $3 }' "$state" | tr ',' '\n' | sort -u)
+    [[ -n "$expected" && "$actual" == "$expected" && $duration -lt 10 ]]
+}
+
+# Print the SHA-256 fingerprint of every certificate in the given PEM files
+pem_fingerprints() {
+    local pem
+    for pem in "$@"; do
+        csplit -s -z -f "$TEST_TEMP_DIR/fingerprint-" "$pem" '/-----BEGIN CERTIFICATE-----/' '{*}'
+        local piece
+        for piece in "$TEST_TEMP_DIR"/fingerprint-*; do
+            openssl x509 -noout -sha256 -fingerprint -in "$piece" 2>/dev/null | sed 's/.*=//'
+            rm -f "$piece"
+        done
+    done
+}
+
 # Integration tests
 test_bash_go_command_equivalence() {
     local bash_script="$PROJECT_ROOT/bash-trust-store-manager/trust-store-manager-enterprise.sh"
@@ -432,6 +839,25 @@ main() {
         skip_test "PKCS12 PFX Extension" "JRE not available"
     fi
     
+    # Run the handlers against fake keytool and openssl, which need no JRE
+    log_test_header "Hermetic Handler Tests"
+    
+    run_test "JKS Password Iteration (fake keytool)" test_fake_jks_password_iteration
+    run_test "JKS Backup (fake keytool)" test_fake_jks_backup
+    run_test "JKS Import Failure (fake keytool)" test_fake_jks_import_failure
+    run_test "JKS Verify Failure (fake keytool)" test_fake_jks_verify_failure
+    run_test "JKS Wrong Passwords (fake keytool)" test_fake_jks_wrong_passwords
+    run_test "JKS Alias (fake keytool)" test_fake_jks_alias
+    run_test "JKS Batch Import (fake keytool)" test_fake_jks_batch_import
+    run_test "PKCS12 Password Iteration (fake openssl)" test_fake_pkcs12_password_iteration
+    run_test "PKCS12 Export Failure (fake openssl)" test_fake_pkcs12_export_failure
+    
+    # Run file type detection tests
+    log_test_header "File Type Detection Tests"
+    
+    run_test "Detect File Type" test_detect_file_type
+    run_test "DER Certificate Left Unchanged" test_der_certificate_unchanged
+    
     # Run PEM tests
     log_test_header "PEM Trust Store Tests"
     
@@ -439,6 +865,22 @@ main() {
     run_test "PEM Multi-Certificate" test_pem_multi_certificate
     run_test "PEM Empty Handling" test_pem_empty_handling
     run_test "PEM Invalid Handling" test_pem_invalid_handling
+    run_test "PEM CRLF Line Endings" test_pem_crlf_line_endings
+    run_test "PEM Final Newline" test_pem_final_newline
+    
+    # Run host scan tests
+    log_test_header "Host Scan Tests"
+    
+    run_test "Hosts Scan (fake ssh)" test_hosts_scan
+    
+    # Run results database tests
+    log_test_header "Results Database Tests"
+    
+    if command -v sqlite3 &> /dev/null; then
+        run_test "Results Database" test_results_db
+    else
+        skip_test "Results Database" "sqlite3 not available"
+    fi
     
     # Run configuration tests
     log_test_header "Configuration Tests"
@@ -451,6 +893,7 @@ main() {
     log_test_header "Performance Tests"
     
     run_test "Large Trust Store Performance" test_large_trust_store_performance
+    run_test "Large Bundle Performance" test_large_bundle_performance
     
     # Run integration tests
     log_test_header "Integration Tests"